@@ -1,17 +1,19 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/inoki/sgreen/internal/server"
 	"github.com/inoki/sgreen/internal/session"
 	"github.com/inoki/sgreen/internal/ui"
 	xterm "golang.org/x/term"
@@ -43,7 +45,7 @@ type Config struct {
 	LoginMode       string
 	Wipe            bool
 	Version         bool
-	SendCommand     string
+	SendCommand     []string
 	Multiuser       bool
 	FlowControl     string // "on", "off", "auto"
 	Interrupt       bool
@@ -57,10 +59,13 @@ type Config struct {
 	Hardstatus      string            // Hardstatus line configuration
 	Caption         string            // Caption line configuration
 	ShellTitle      string            // Shell title format
+	Zombie          string            // Keys to close and respawn dead windows
+	MaxWindows      int               // Number of window numbers (maxwin)
+	KillGrace       time.Duration     // Wait between kill signals (killgrace)
 }
 
 func main() {
-	if runDetachKeeperIfRequested() {
+	if server.RunIfRequested() {
 		return
 	}
 
@@ -76,6 +81,7 @@ func main() {
 		detach             = flag.Bool("d", false, "Detach a session")
 		list               = flag.Bool("ls", false, "List all sessions")
 		listAlt            = flag.Bool("list", false, "List all sessions (alternative)")
+		listJSON           = flag.Bool("json", false, "With -ls, list sessions as JSON")
 		sessionName        = flag.String("S", "", "Name the session")
 		helpLong           = flag.Bool("help", false, "Show help")
 		helpAlt            = flag.Bool("?", false, "Show help")
@@ -97,7 +103,6 @@ func main() {
 		// Other Options
 		version         = flag.Bool("v", false, "Print version information")
 		wipe            = flag.Bool("wipe", false, "Remove dead sessions from list")
-		sendCommand     = flag.String("X", "", "Send command to a running session")
 		ignoreSTY       = flag.Bool("m", false, "Ignore $STY environment variable")
 		optimalOutput   = flag.Bool("O", false, "Use optimal output mode")
 		preselectWindow = flag.String("p", "", "Preselect a window")
@@ -113,7 +118,8 @@ func main() {
 	)
 
 	flag.Usage = printUsage
-	if err := flag.CommandLine.Parse(normalizeArgs(os.Args[1:])); err != nil {
+	args, sendCommand, sendMode := splitSendCommand(normalizeArgs(os.Args[1:]))
+	if err := flag.CommandLine.Parse(args); err != nil || (sendMode != "" && len(sendCommand) == 0) {
 		printUsage()
 		os.Exit(1)
 	}
@@ -139,7 +145,7 @@ func main() {
 		WindowTitle:     *windowTitle,
 		Wipe:            *wipe,
 		Version:         *version,
-		SendCommand:     *sendCommand,
+		SendCommand:     sendCommand,
 		Multiuser:       *multiuser,
 		FlowControl:     *flowControl,
 		Interrupt:       *interrupt,
@@ -189,14 +195,20 @@ func main() {
 		os.Exit(handleWipe(config.Quiet))
 	}
 
-	// Handle send command (-X)
-	if *sendCommand != "" {
-		handleSendCommand(*sessionName, *sendCommand)
+	// Handle send command (-X) and query (-Q)
+	switch sendMode {
+	case "-X":
+		handleSendCommand(*sessionName, *preselectWindow, sendCommand)
 		return
+	case "-Q":
+		os.Exit(handleQuery(*sessionName, *preselectWindow, sendCommand))
 	}
 
 	// Handle list
 	if *list || *listAlt {
+		if *listJSON {
+			os.Exit(handleListJSON())
+		}
 		os.Exit(handleList(config.Quiet))
 	}
 
@@ -230,13 +242,13 @@ func main() {
 	// Handle power detach (-D)
 	if *powerDetach {
 		targetSession := resolvePowerDetachTarget(*sessionName, flag.Args())
-		handlePowerDetach(targetSession, config)
+		handlePowerDetach(*reattach, targetSession, config)
 		return
 	}
 
 	// Handle detach
 	if *detach {
-		handleDetach(*reattach, resolveSessionName(*sessionName, flag.Args()))
+		handleDetach(*reattach, resolveSessionName(*sessionName, flag.Args()), config)
 		return
 	}
 
@@ -302,47 +314,16 @@ func handleWipe(quiet bool) int {
 	removed := 0
 
 	for _, sess := range sessions {
-		// Check if session is dead
-		isDead := false
-
-		// Check all windows in the session
-		if len(sess.Windows) > 0 {
-			allWindowsDead := true
-			for _, win := range sess.Windows {
-				if win.GetPTYProcess() != nil && win.GetPTYProcess().IsAlive() {
-					allWindowsDead = false
-					break
-				}
-				// Try to reconnect if we have pts path
-				if win.PtsPath != "" {
-					if err := sess.ReconnectPTY(); err == nil {
-						allWindowsDead = false
-						break
-					}
-				}
-			}
-			if allWindowsDead {
-				isDead = true
-			}
-		} else {
-			// Fallback to old method for backward compatibility
-			if !isProcessAliveByPID(sess.Pid) {
-				// Try to reconnect first
-				if sess.PtsPath != "" {
-					if err := sess.ReconnectPTY(); err != nil {
-						isDead = true
-					}
-				} else {
-					isDead = true
-				}
-			}
-		}
-
-		if isDead {
+		switch sessionServerStatus(sess) {
+		case serverDead:
 			// Session is dead, remove it
 			if err := session.Delete(sess.ID); err == nil {
 				removed++
 			}
+		case serverUnreachable:
+			if !quiet {
+				fmt.Printf("Session %s is unreachable: its server does not accept connections.\n", sess.ID)
+			}
 		}
 	}
 
@@ -356,32 +337,67 @@ func handleWipe(quiet bool) int {
 	return 1
 }
 
-// handleSendCommand sends a command to a running session
-func handleSendCommand(sessionName, command string) {
-	var sess *session.Session
-	var err error
-
+// commandTarget finds the session -X or -Q send their command to: the
+// named session, or else the first running one.
+func commandTarget(sessionName string) (*session.Session, bool) {
 	if sessionName != "" {
-		sess, err = session.Load(sessionName)
-	} else {
-		sessions := session.List()
-		if len(sessions) == 0 {
-			_, _ = fmt.Fprintf(os.Stderr, "No screen session found.\n")
-			os.Exit(1)
-		}
-		sess = sessions[0]
+		sess, err := session.Load(sessionName)
+		return sess, err == nil
 	}
+	sessions := session.List()
+	if len(sessions) == 0 {
+		return nil, false
+	}
+	return sessions[0], true
+}
 
-	if err != nil {
+// handleSendCommand sends a command to a running session, to act on the
+// window selected with -p, and prints the messages of the command. It
+// exits with the status the command asks for, as wait does.
+func handleSendCommand(sessionName, window string, command []string) {
+	sess, ok := commandTarget(sessionName)
+	if !ok {
 		_, _ = fmt.Fprintln(os.Stderr, "No screen session found.")
 		os.Exit(1)
 	}
 
-	// Execute command in session
-	if err := session.ExecuteCommand(sess, command); err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error executing command: %v\n", err)
+	// Execute command in the session's server
+	reply, err := server.Command(sess.ID, window, command)
+	if err != nil {
+		if errors.Is(err, server.ErrNoServer) {
+			_, _ = fmt.Fprintln(os.Stderr, "No screen session found.")
+			os.Exit(1)
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "-X: %v\n", err)
 		os.Exit(1)
 	}
+	fmt.Print(reply.Output)
+	if reply.Status != 0 {
+		os.Exit(reply.Status)
+	}
+}
+
+// handleQuery runs a query command (-Q) in a running session and prints
+// its answer on stdout. It returns the exit code: 0 if the query
+// succeeded, 1 otherwise.
+func handleQuery(sessionName, window string, command []string) int {
+	sess, ok := commandTarget(sessionName)
+	if !ok {
+		_, _ = fmt.Fprintln(os.Stderr, "No screen session found.")
+		return 1
+	}
+
+	answer, err := server.Query(sess.ID, window, command)
+	if err != nil {
+		if errors.Is(err, server.ErrNoServer) {
+			_, _ = fmt.Fprintln(os.Stderr, "No screen session found.")
+			return 1
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "-Q: %v\n", err)
+		return 1
+	}
+	fmt.Print(answer)
+	return 0
 }
 
 // handleNew creates a new session
@@ -481,33 +497,24 @@ func handleNew(sessionName string, cmdArgs []string, config *Config) {
 		needsPidRename = true
 	}
 
-	// Create new session with config
-	sessConfig := &session.Config{
-		Term:            config.Term,
-		UTF8:            config.UTF8,
-		Encoding:        config.Encoding,
-		Scrollback:      config.Scrollback,
-		AllCapabilities: config.AllCapabilities,
+	// Start a server process owning the new session
+	opts := newServerOptions(sessionName, cmdPath, args, config)
+	if needsPidRename {
+		opts.PidName = requestedName
 	}
-	sess, err := session.NewWithConfig(sessionName, cmdPath, args, sessConfig)
+	id, err := server.Start(opts)
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "Error creating session: %v\n", err)
 		os.Exit(1)
 	}
-	if needsPidRename {
-		pidName := fmt.Sprintf("%d-%s", sess.Pid, requestedName)
-		if pidName != sessionName {
-			if err := sess.Rename(pidName); err != nil {
-				if !config.Quiet {
-					_, _ = fmt.Fprintf(os.Stderr, "Warning: created session %s, but failed to rename to %s: %v\n", sessionName, pidName, err)
-				}
-			} else if !config.Quiet {
-				_, _ = fmt.Fprintf(os.Stderr, "Session created as %s.\n", pidName)
-			}
-		}
+	if id != sessionName && !config.Quiet {
+		_, _ = fmt.Fprintf(os.Stderr, "Session created as %s.\n", id)
+	}
+	sess, err := session.Load(id)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error creating session: %v\n", err)
+		os.Exit(1)
 	}
-
-	applyWindowTitle(sess, config)
 
 	// Attach to the new session
 	attachToSession(sess, config)
@@ -557,27 +564,15 @@ func handleNewDetached(sessionName string, cmdArgs []string, config *Config) {
 		config.Encoding = detectEncodingFromLocale(false)
 	}
 
-	sessConfig := &session.Config{
-		Term:            config.Term,
-		UTF8:            config.UTF8,
-		Encoding:        config.Encoding,
-		Scrollback:      config.Scrollback,
-		AllCapabilities: config.AllCapabilities,
-	}
-	sess, err := session.NewWithConfig(sessionName, cmdPath, args, sessConfig)
-	if err != nil {
+	// The server keeps running after this process exits.
+	if _, err := server.Start(newServerOptions(sessionName, cmdPath, args, config)); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "Error creating session: %v\n", err)
 		os.Exit(1)
 	}
-	applyWindowTitle(sess, config)
-
-	// Keep PTY master alive after this process exits (same mechanism as detach).
-	startDetachKeeper(sess)
-	sess.ForceDetach()
 }
 
-// handleNewDetachedNoFork creates a detached session without spawning a keeper process.
-// This mirrors GNU screen -D -m behavior by waiting until the session command exits.
+// handleNewDetachedNoFork creates a detached session served by this process.
+// This mirrors GNU screen -D -m behavior by waiting until the session ends.
 func handleNewDetachedNoFork(sessionName string, cmdArgs []string, config *Config) {
 	if config == nil {
 		config = &Config{}
@@ -621,52 +616,44 @@ func handleNewDetachedNoFork(sessionName string, cmdArgs []string, config *Confi
 		config.Encoding = detectEncodingFromLocale(false)
 	}
 
-	sessConfig := &session.Config{
-		Term:            config.Term,
-		UTF8:            config.UTF8,
-		Encoding:        config.Encoding,
-		Scrollback:      config.Scrollback,
-		AllCapabilities: config.AllCapabilities,
-	}
-	sess, err := session.NewWithConfig(sessionName, cmdPath, args, sessConfig)
-	if err != nil {
+	if err := server.Run(newServerOptions(sessionName, cmdPath, args, config), nil); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "Error creating session: %v\n", err)
 		os.Exit(1)
 	}
-	applyWindowTitle(sess, config)
-
-	ptyProc := sess.GetPTYProcess()
-	sess.ForceDetach()
-	if ptyProc != nil {
-		_ = ptyProc.Wait()
-	}
 }
 
-func applyWindowTitle(sess *session.Session, config *Config) {
-	if sess == nil || config == nil || config.WindowTitle == "" {
-		return
+// newServerOptions describes a new session for the server that will own it.
+func newServerOptions(sessionName, cmdPath string, args []string, config *Config) server.Options {
+	return server.Options{
+		SessionID: sessionName,
+		CmdPath:   cmdPath,
+		CmdArgs:   args,
+		Title:     config.WindowTitle,
+		Config: &session.Config{
+			Term:            config.Term,
+			UTF8:            config.UTF8,
+			Encoding:        config.Encoding,
+			Scrollback:      config.Scrollback,
+			AllCapabilities: config.AllCapabilities,
+			Zombie:          config.Zombie,
+			MaxWindows:      config.MaxWindows,
+			KillGrace:       config.KillGrace,
+		},
+		Monitor: &ui.MonitorConfig{
+			Logging:        config.Logging,
+			Logfile:        config.Logfile,
+			ActivityMsg:    config.ActivityMsg,
+			SilenceMsg:     config.SilenceMsg,
+			SilenceTimeout: config.SilenceTimeout,
+		},
 	}
-	win := sess.GetCurrentWindow()
-	if win == nil {
-		return
-	}
-	win.Title = config.WindowTitle
-	_ = sess.Save()
 }
 
 func sessionHasAttachablePTY(sess *session.Session) bool {
 	if sess == nil {
 		return false
 	}
-	if ptyProc := sess.GetPTYProcess(); ptyProc != nil && ptyProc.IsAlive() {
-		return true
-	}
-	if sess.PtsPath != "" {
-		if err := sess.ReconnectPTY(); err == nil {
-			return true
-		}
-	}
-	return false
+	return server.Reachable(sess.ID)
 }
 
 func nextAvailableSessionName(base string) string {
@@ -718,12 +705,12 @@ func handleReattachWithConfig(sessionName string, config *Config) {
 	attachToSession(sess, config)
 }
 
+// isSessionAttached reports whether a terminal is attached to the session.
 func isSessionAttached(sess *session.Session) bool {
 	if sess == nil {
 		return false
 	}
-	ptyProc := sess.GetPTYProcess()
-	return ptyProc != nil && ptyProc.IsAlive()
+	return len(sess.AttachedClients()) > 0
 }
 
 func selectReattachSession(
@@ -848,23 +835,33 @@ func handleReattachOrCreateRR(sessionName string, cmdArgs []string, config *Conf
 		}
 	}
 
-	// Force detach if attached elsewhere, then attach
-	if sess.GetPTYProcess() != nil {
-		sess.ForceDetach()
+	// Detach from other terminals first, then attach
+	if isSessionAttached(sess) {
+		_ = server.Detach(sess.ID, false)
 	}
 
 	attachToSession(sess, config)
 }
 
-// handlePowerDetach implements -D flag: power detach (force detach from elsewhere)
-func handlePowerDetach(sessionName string, config *Config) {
+// handlePowerDetach implements -D flag: power detach the session from the
+// terminal it is attached to, hanging up that terminal's login shell, then
+// reattach here when -r was given.
+func handlePowerDetach(reattach bool, sessionName string, config *Config) {
+	detachSession(reattach, sessionName, true, config)
+}
+
+// handleDetach implements -d flag: detach the session from the terminal it
+// is attached to, then reattach here when -r was given.
+func handleDetach(reattach bool, sessionName string, config *Config) {
+	detachSession(reattach, sessionName, false, config)
+}
+
+func detachSession(reattach bool, sessionName string, power bool, config *Config) {
 	sessions := session.List()
-	_ = config
 
 	if len(sessions) == 0 {
 		_, _ = fmt.Fprintln(os.Stderr, noDetachableScreenMessage(sessionName))
 		os.Exit(1)
-		return
 	}
 
 	var sess *session.Session
@@ -875,60 +872,39 @@ func handlePowerDetach(sessionName string, config *Config) {
 		if err != nil {
 			_, _ = fmt.Fprintln(os.Stderr, noDetachableScreenMessage(sessionName))
 			os.Exit(1)
-			return
 		}
 	} else {
-		// Find first session (prefer detached, but any will do)
-		detached := findDetachedSessions(sessions)
-		if len(detached) > 0 {
+		// Find first attached session, or a detached one to reattach
+		attached := findAttachedSessions(sessions)
+		if len(attached) > 0 {
+			sess = attached[0]
+		} else if detached := findDetachedSessions(sessions); reattach && len(detached) > 0 {
 			sess = detached[0]
 		} else {
-			sess = sessions[0]
+			_, _ = fmt.Fprintln(os.Stderr, noDetachableScreenMessage(""))
+			os.Exit(1)
 		}
 	}
 
-	// Force detach: clear PTY process reference to allow reattachment
-	if sess.GetPTYProcess() != nil {
-		sess.ForceDetach()
-	}
-
-	// After detaching, attach to the session
-	attachToSession(sess, config)
-}
-
-// handleDetach detaches a session
-func handleDetach(reattach bool, sessionName string) {
-	sessions := session.List()
-
-	if len(sessions) == 0 {
-		_, _ = fmt.Fprintln(os.Stderr, noDetachableScreenMessage(sessionName))
-		os.Exit(1)
-	}
-
-	var sess *session.Session
-	var err error
-
-	if sessionName != "" {
-		sess, err = session.Load(sessionName)
-		if err != nil {
-			_, _ = fmt.Fprintln(os.Stderr, noDetachableScreenMessage(sessionName))
+	if isSessionAttached(sess) {
+		if err := server.Detach(sess.ID, power); err != nil && !reattach {
+			_, _ = fmt.Fprintf(os.Stderr, "Error detaching session %s: %v\n", sess.ID, err)
 			os.Exit(1)
 		}
-	} else {
-		// Find first attached session
-		attached := findAttachedSessions(sessions)
-		if len(attached) == 0 {
-			_, _ = fmt.Fprintln(os.Stderr, noDetachableScreenMessage(""))
-			os.Exit(1)
+		if !reattach {
+			if power {
+				fmt.Printf("[remote power detached from %s]\n", sess.ID)
+			} else {
+				fmt.Printf("[remote detached from %s]\n", sess.ID)
+			}
 		}
-		sess = attached[0]
+	} else if !reattach {
+		_, _ = fmt.Fprintln(os.Stderr, noDetachableScreenMessage(sessionName))
+		os.Exit(1)
 	}
 
-	// Detach is handled by the user pressing Ctrl+A, d
-	// This function just validates the session exists
-	// If reattach is also requested, attach after validation
 	if reattach {
-		attachToSession(sess, &Config{})
+		attachToSession(sess, config)
 	}
 }
 
@@ -943,35 +919,15 @@ func attachToSession(sess *session.Session, config *Config) {
 		}
 	}
 
-	// Check if PTY process is available, try to reconnect if needed
-	if sess.GetPTYProcess() == nil {
-		// Try to reconnect if we have a pts path
-		if sess.PtsPath != "" {
-			if err := sess.ReconnectPTY(); err == nil {
-				// Successfully reconnected
-			} else {
-				_, _ = fmt.Fprintf(os.Stderr, "Error: session %s has no active PTY process\n", sess.ID)
-				_, _ = fmt.Fprintf(os.Stderr, "Failed to reconnect: %v\n", err)
-				_, _ = fmt.Fprintf(os.Stderr, "The session process may have terminated\n")
-				os.Exit(1)
-			}
-		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "Error: session %s has no active PTY process\n", sess.ID)
-			_, _ = fmt.Fprintf(os.Stderr, "The session may have been created in a different process\n")
-			os.Exit(1)
-		}
+	// The session's server owns the windows; make sure it is running
+	if !server.Reachable(sess.ID) {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: session %s has no running server\n", sess.ID)
+		_, _ = fmt.Fprintf(os.Stderr, "The session process may have terminated\n")
+		os.Exit(1)
 	}
 
 	// Build attach config from main config
 	attachConfig := ui.DefaultAttachConfig()
-	startedKeeper := false
-	onDetach := func(detachSess *session.Session) {
-		if startedKeeper {
-			return
-		}
-		startedKeeper = true
-		startDetachKeeper(detachSess)
-	}
 	if config != nil {
 		// Parse command character
 		if config.CommandChar != "" {
@@ -986,8 +942,6 @@ func attachToSession(sess *session.Session, config *Config) {
 			}
 		}
 		attachConfig.AdaptSize = config.AdaptSize
-		attachConfig.Logging = config.Logging
-		attachConfig.Logfile = config.Logfile
 		attachConfig.Multiuser = config.Multiuser
 		attachConfig.OptimalOutput = config.OptimalOutput
 		attachConfig.AllCapabilities = config.AllCapabilities
@@ -1014,10 +968,6 @@ func attachToSession(sess *session.Session, config *Config) {
 		attachConfig.StartupMessage = config.StartupMessage
 		attachConfig.Bell = config.Bell
 		attachConfig.VBell = config.VBell
-		// Activity and silence monitoring
-		attachConfig.ActivityMsg = config.ActivityMsg
-		attachConfig.SilenceMsg = config.SilenceMsg
-		attachConfig.SilenceTimeout = config.SilenceTimeout
 		// Key bindings
 		if config.Bindings != nil {
 			attachConfig.Bindings = make(map[string]string)
@@ -1028,108 +978,15 @@ func attachToSession(sess *session.Session, config *Config) {
 		// Shell title format
 		attachConfig.ShellTitle = config.ShellTitle
 	}
-	attachConfig.OnDetach = onDetach
 
-	err := ui.AttachWithConfig(os.Stdin, os.Stdout, os.Stderr, sess, attachConfig)
-	if err == nil || err == ui.ErrDetach {
-		onDetach(sess)
+	err := server.Attach(sess.ID, os.Stdin, os.Stdout, attachConfig)
+	if err == nil || errors.Is(err, ui.ErrDetach) {
 		return
 	}
 	_, _ = fmt.Fprintf(os.Stderr, "Error attaching to session: %v\n", err)
 	os.Exit(1)
 }
 
-func runDetachKeeperIfRequested() bool {
-	if os.Getenv("SGREEN_DETACH_KEEPER") != "1" {
-		return false
-	}
-	debugDetachKeeper("keeper: starting")
-	fdStr := os.Getenv("SGREEN_HOLD_FD")
-	fd, err := strconv.Atoi(fdStr)
-	if err != nil || fd <= 0 {
-		debugDetachKeeper("keeper: invalid SGREEN_HOLD_FD=%q", fdStr)
-		return true
-	}
-	readyStr := os.Getenv("SGREEN_READY_FD")
-	readyFD, readyErr := strconv.Atoi(readyStr)
-	if readyErr == nil && readyFD > 0 {
-		if readyFile := os.NewFile(uintptr(readyFD), "sgreen-keeper-ready"); readyFile != nil {
-			_, _ = readyFile.Write([]byte("ready\n"))
-			_ = readyFile.Close()
-		}
-	}
-	file := os.NewFile(uintptr(fd), "sgreen-pty-master")
-	if file == nil {
-		debugDetachKeeper("keeper: failed to open fd=%d", fd)
-		return true
-	}
-	debugDetachKeeper("keeper: holding fd=%d", fd)
-	// Keep the PTY master open so detached processes do not receive SIGHUP.
-	select {}
-}
-
-func startDetachKeeper(sess *session.Session) {
-	if sess == nil {
-		return
-	}
-	ptyProc := sess.GetPTYProcess()
-	if ptyProc == nil {
-		if win := sess.GetCurrentWindow(); win != nil {
-			ptyProc = win.GetPTYProcess()
-		}
-	}
-	if ptyProc == nil || ptyProc.Pty == nil {
-		debugDetachKeeper("keeper: no PTY to hold for session %q", sess.ID)
-		return
-	}
-	selfPath, err := os.Executable()
-	if err != nil {
-		debugDetachKeeper("keeper: failed to get executable path: %v", err)
-		return
-	}
-	cmd := exec.Command(selfPath)
-	readyR, readyW, err := os.Pipe()
-	if err != nil {
-		debugDetachKeeper("keeper: failed to create ready pipe: %v", err)
-		return
-	}
-	defer readyR.Close()
-	cmd.Env = append(os.Environ(),
-		"SGREEN_DETACH_KEEPER=1",
-		"SGREEN_HOLD_FD=3",
-		"SGREEN_READY_FD=4",
-	)
-	cmd.Stdin = nil
-	cmd.Stdout = nil
-	cmd.Stderr = nil
-	cmd.ExtraFiles = []*os.File{ptyProc.Pty, readyW}
-	setDetachSysProcAttr(cmd)
-	if err := cmd.Start(); err != nil {
-		debugDetachKeeper("keeper: failed to start: %v", err)
-		_ = readyW.Close()
-		return
-	}
-	_ = readyW.Close()
-	waitForKeeperReady(readyR)
-	debugDetachKeeper("keeper: started pid=%d for session %q", cmd.Process.Pid, sess.ID)
-}
-
-func debugDetachKeeper(format string, args ...any) {
-	if os.Getenv("SGREEN_KEEPER_DEBUG") == "" {
-		return
-	}
-	_, _ = fmt.Fprintf(os.Stderr, format+"\n", args...)
-}
-
-func waitForKeeperReady(readyR *os.File) {
-	if readyR == nil {
-		return
-	}
-	buf := make([]byte, 16)
-	_ = readyR.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
-	_, _ = readyR.Read(buf)
-}
-
 // parseCommandChar parses a command character string (e.g., "^A" or "\x01")
 func parseCommandChar(s string) byte {
 	if len(s) == 0 {
@@ -1235,6 +1092,12 @@ func handleList(quiet bool) int {
 	for _, entry := range entries {
 		fmt.Println(entry)
 	}
+	for _, sess := range sessions {
+		if sessionServerStatus(sess) == serverDead {
+			fmt.Println("Remove dead screens with 'sgreen -wipe'.")
+			break
+		}
+	}
 	fmt.Printf("%d %s in %s.\n", len(entries), socketWord(len(entries)), screenSocketDirForDisplay())
 	return 0
 }
@@ -1245,9 +1108,7 @@ func listableSessions(sessions []*session.Session) []*session.Session {
 		if sess == nil {
 			continue
 		}
-		if isSessionAttached(sess) || sessionHasAliveProcess(sess) {
-			listable = append(listable, sess)
-		}
+		listable = append(listable, sess)
 	}
 	return listable
 }
@@ -1268,16 +1129,7 @@ func sessionListEntries(sessions []*session.Session) []string {
 
 	entries := make([]string, 0, len(sessions))
 	for _, sess := range sessions {
-		status := "Detached"
-		ptyProc := sess.GetPTYProcess()
-		if ptyProc != nil && ptyProc.IsAlive() {
-			status = "Attached"
-		} else if !sessionHasAliveProcess(sess) {
-			status = "Dead"
-		}
-		if status == "Dead" {
-			continue
-		}
+		status := listSessionState(sess).label()
 
 		// Format: PID.TTY (Status) DATE TIME (SESSIONNAME)
 		tty := "pts"
@@ -1312,6 +1164,132 @@ func sessionListEntries(sessions []*session.Session) []string {
 	return entries
 }
 
+// sessionState is the state of a session as listed by -ls
+type sessionState string
+
+const (
+	stateAttached    sessionState = "attached"
+	stateMulti       sessionState = "multi" // Attached to more than one terminal
+	stateDetached    sessionState = "detached"
+	stateUnreachable sessionState = "unreachable"
+	stateDead        sessionState = "dead"
+)
+
+func listSessionState(sess *session.Session) sessionState {
+	switch sessionServerStatus(sess) {
+	case serverDead:
+		return stateDead
+	case serverUnreachable:
+		return stateUnreachable
+	}
+	switch clients := len(sess.AttachedClients()); {
+	case clients > 1:
+		return stateMulti
+	case clients == 1:
+		return stateAttached
+	}
+	return stateDetached
+}
+
+// label returns the state as GNU screen prints it
+func (s sessionState) label() string {
+	switch s {
+	case stateAttached:
+		return "Attached"
+	case stateMulti:
+		return "Multi, attached"
+	case stateUnreachable:
+		return "Unreachable"
+	case stateDead:
+		return "Dead ???"
+	}
+	return "Detached"
+}
+
+// sessionListing describes a session for -ls --json
+type sessionListing struct {
+	ID        string           `json:"id"`
+	Pid       int              `json:"pid"`
+	ServerPid int              `json:"server_pid,omitempty"`
+	Owner     string           `json:"owner,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	State     sessionState     `json:"state"`
+	Clients   []session.Client `json:"clients"`
+	Windows   []windowListing  `json:"windows"`
+}
+
+// windowListing describes a window for -ls --json
+type windowListing struct {
+	Number     string    `json:"number"`
+	Title      string    `json:"title"`
+	Command    []string  `json:"command"`
+	Pid        int       `json:"pid"`
+	Alive      bool      `json:"alive"`
+	ExitStatus *int      `json:"exit_status,omitempty"`
+	EndedAt    time.Time `json:"ended_at,omitzero"`
+	Type       string    `json:"type,omitempty"`  // "group" for group windows
+	Group      string    `json:"group,omitempty"` // Number of the group window holding it
+}
+
+// handleListJSON lists the sessions shown by -ls as a JSON array. Unlike
+// -ls, an empty list is not an error.
+func handleListJSON() int {
+	sessions := listableSessions(session.List())
+	listings := make([]sessionListing, 0, len(sessions))
+	for _, sess := range sessions {
+		listings = append(listings, sessionListingFor(sess))
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(listings); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error listing sessions: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func sessionListingFor(sess *session.Session) sessionListing {
+	listing := sessionListing{
+		ID:        sess.ID,
+		Pid:       sess.Pid,
+		ServerPid: sess.ServerPid,
+		Owner:     sess.Owner,
+		CreatedAt: sess.CreatedAt,
+		State:     listSessionState(sess),
+		Clients:   sess.AttachedClients(),
+		Windows:   make([]windowListing, 0, len(sess.Windows)),
+	}
+	for _, win := range sess.Windows {
+		if win == nil {
+			continue
+		}
+		alive := win.ExitStatus == nil && win.Pid > 0 && isProcessAliveByPID(win.Pid)
+		if listing.State == stateDead {
+			alive = false
+		}
+		listing.Windows = append(listing.Windows, windowListing{
+			Number:     win.Number,
+			Title:      win.Title,
+			Command:    append([]string{win.CmdPath}, win.CmdArgs...),
+			Pid:        win.Pid,
+			Alive:      alive,
+			ExitStatus: win.ExitStatus,
+			EndedAt:    win.EndedAt,
+			Type:       win.Type,
+			Group:      groupNumber(sess, win),
+		})
+	}
+	return listing
+}
+
+// groupNumber returns the number of the group window holding win, or "".
+func groupNumber(sess *session.Session, win *session.Window) string {
+	if group := sess.GroupOf(win); group != nil {
+		return group.Number
+	}
+	return ""
+}
+
 func screenSocketDirForDisplay() string {
 	if screenDir := os.Getenv("SCREENDIR"); screenDir != "" {
 		return screenDir
@@ -1425,6 +1403,38 @@ func normalizeArgs(args []string) []string {
 	return normalized
 }
 
+// valueOptions lists the options of sgreen that take a separate value, so
+// that splitSendCommand can step over that value.
+var valueOptions = map[string]bool{
+	"-S": true, "-s": true, "-c": true, "-e": true, "-T": true,
+	"-Logfile": true, "-h": true, "-p": true, "-t": true, "-f": true,
+}
+
+// splitSendCommand separates the command given with -X or -Q from the
+// other arguments, and returns which of the two flags was given, or "".
+// Every argument after the flag belongs to the command, untouched, so
+// options such as -S and -p go before it (sgreen -S name -X quit). Only
+// sgreen's own options are searched: the first argument that is not an
+// option starts the window's program, whose arguments may well contain -X
+// (sgreen -dmS remote ssh -X host).
+func splitSendCommand(args []string) (rest, command []string, mode string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") || arg == "-" {
+			break
+		}
+		if valueOptions[arg] {
+			i++
+			continue
+		}
+		if arg != "-X" && arg != "-Q" {
+			continue
+		}
+		return args[:i], args[i+1:], arg
+	}
+	return args, nil, ""
+}
+
 func requiresTerminalForOperation(reattach bool, reattachOrCreate bool, reattachOrCreateRR bool, multiuser bool, detach bool) bool {
 	return reattach || reattachOrCreate || reattachOrCreateRR || multiuser || (detach && reattach)
 }
@@ -1507,11 +1517,8 @@ func sanitizeSessionNameComponent(s string) string {
 func findDetachedSessions(sessions []*session.Session) []*session.Session {
 	var detached []*session.Session
 	for _, sess := range sessions {
-		ptyProc := sess.GetPTYProcess()
-		if ptyProc == nil || !ptyProc.IsAlive() {
-			if sessionHasAliveProcess(sess) {
-				detached = append(detached, sess)
-			}
+		if !isSessionAttached(sess) && sessionHasAliveProcess(sess) {
+			detached = append(detached, sess)
 		}
 	}
 	return detached
@@ -1521,7 +1528,7 @@ func findDetachedSessions(sessions []*session.Session) []*session.Session {
 func findAttachedSessions(sessions []*session.Session) []*session.Session {
 	var attached []*session.Session
 	for _, sess := range sessions {
-		if sess.GetPTYProcess() != nil && sess.GetPTYProcess().IsAlive() {
+		if isSessionAttached(sess) {
 			attached = append(attached, sess)
 		}
 	}
@@ -1550,6 +1557,33 @@ func ensureInteractiveShellArgs(cmdPath string, args []string) []string {
 	}
 }
 
+// serverStatus tells whether clients can reach a session's server
+type serverStatus int
+
+const (
+	serverReachable   serverStatus = iota
+	serverUnreachable              // Still running, but not accepting clients
+	serverDead                     // Nothing left of the session
+)
+
+// sessionServerStatus checks the server of a session. Sessions recorded
+// without a server PID count as running while any of their processes is.
+func sessionServerStatus(sess *session.Session) serverStatus {
+	if server.Reachable(sess.ID) {
+		return serverReachable
+	}
+	if sess.ServerPid > 0 {
+		if isProcessAliveByPID(sess.ServerPid) {
+			return serverUnreachable
+		}
+		return serverDead
+	}
+	if sessionHasAliveProcess(sess) {
+		return serverUnreachable
+	}
+	return serverDead
+}
+
 func sessionHasAliveProcess(sess *session.Session) bool {
 	if sess == nil {
 		return false
@@ -1778,6 +1812,32 @@ func loadConfigFile(configFile string, config *Config) {
 				}
 			}
 
+		case "zombie", "defzombie":
+			// Keep dead windows, with keys to close and respawn them
+			if len(args) >= 1 {
+				if keys, err := ui.ParseZombieKeys(args[0]); err == nil {
+					config.Zombie = keys
+				}
+			} else {
+				config.Zombie = ""
+			}
+
+		case "maxwin":
+			// Number of window numbers new windows may get
+			if len(args) >= 1 {
+				if n, err := strconv.Atoi(args[0]); err == nil && n >= 1 && n <= session.MaxMaxWindows {
+					config.MaxWindows = n
+				}
+			}
+
+		case "killgrace":
+			// Wait between the SIGHUP, SIGTERM and SIGKILL of killed windows
+			if len(args) >= 1 {
+				if grace, err := ui.ParseKillGrace(args[0]); err == nil {
+					config.KillGrace = grace
+				}
+			}
+
 		case "shelltitle":
 			// Store shelltitle format
 			if len(args) >= 1 {
@@ -1843,9 +1903,12 @@ func printUsage() {
 	fmt.Println("  sgreen -v")
 	fmt.Println("    Print version information")
 	fmt.Println()
-	fmt.Println("  sgreen -X command [session]")
+	fmt.Println("  sgreen [-S session] [-p window] -X command [args]")
 	fmt.Println("    Send command to a running session")
 	fmt.Println()
+	fmt.Println("  sgreen [-S session] [-p window] -Q query [args]")
+	fmt.Println("    Print the answer of a query command on stdout")
+	fmt.Println()
 	fmt.Println("  sgreen -S name [cmd [args]]")
 	fmt.Println("    Create a named session")
 	fmt.Println()
@@ -1870,10 +1933,11 @@ func printUsage() {
 	fmt.Println("  -h num         Set scrollback buffer size")
 	fmt.Println("  -v             Print version information")
 	fmt.Println("  -wipe          Remove dead sessions from list")
-	fmt.Println("  -X command     Send command to a running session")
+	fmt.Println("  -X cmd [args]  Send command to a running session")
+	fmt.Println("  -Q cmd [args]  Query a running session: windows, info, title, number, select")
 	fmt.Println("  -m             Ignore $STY environment variable")
 	fmt.Println("  -O             Use optimal output mode")
-	fmt.Println("  -p window      Preselect a window")
+	fmt.Println("  -p window      Preselect a window, or name the window -X acts on")
 	fmt.Println("  -q             Quiet startup (suppress messages)")
 	fmt.Println("  -i             Interrupt output immediately when flow control is on")
 	fmt.Println("  -a             Include all capabilities in termcap")
@@ -1884,8 +1948,9 @@ func printUsage() {
 	fmt.Println("  -ln            Turn login mode off")
 	fmt.Println("  -i             Interrupt output immediately when flow control is on")
 	fmt.Println("  -O             Use optimal output mode")
-	fmt.Println("  -p window      Preselect a window")
+	fmt.Println("  -p window      Preselect a window, or name the window -X acts on")
 	fmt.Println("  -ls, -list     List all sessions")
+	fmt.Println("  -ls --json     List all sessions and their windows as JSON")
 	fmt.Println("  -help, -?      Show this help message")
 	fmt.Println()
 	fmt.Println("Inside a session, press Ctrl+A, d to detach")
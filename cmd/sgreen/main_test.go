@@ -249,3 +249,35 @@ func TestIsOwnerSessionTarget(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitSendCommand(t *testing.T) {
+	rest, command, mode := splitSendCommand([]string{"-S", "dev", "-X", "screen", "-t", "build", "make"})
+	if mode != "-X" || strings.Join(rest, " ") != "-S dev" || strings.Join(command, " ") != "screen -t build make" {
+		t.Fatalf("splitSendCommand: rest=%q command=%q mode=%q", rest, command, mode)
+	}
+
+	// Options after the flag belong to the command
+	rest, command, mode = splitSendCommand([]string{"-S", "dev", "-X", "stuff", "-p"})
+	if mode != "-X" || strings.Join(rest, " ") != "-S dev" || strings.Join(command, " ") != "stuff -p" {
+		t.Fatalf("splitSendCommand with -p in the command: rest=%q command=%q mode=%q", rest, command, mode)
+	}
+
+	rest, command, mode = splitSendCommand([]string{"-S", "dev", "-p", "1", "-Q", "select", "2"})
+	if mode != "-Q" || strings.Join(rest, " ") != "-S dev -p 1" || strings.Join(command, " ") != "select 2" {
+		t.Fatalf("splitSendCommand with -Q: rest=%q command=%q mode=%q", rest, command, mode)
+	}
+
+	rest, _, mode = splitSendCommand([]string{"-d", "-m", "-S", "remote", "ssh", "-X", "host"})
+	if mode != "" || strings.Join(rest, " ") != "-d -m -S remote ssh -X host" {
+		t.Fatalf("splitSendCommand with -X in the program: rest=%q mode=%q", rest, mode)
+	}
+
+	rest, command, mode = splitSendCommand([]string{"-S", "-X", "-X", "quit"})
+	if mode != "-X" || strings.Join(rest, " ") != "-S -X" || strings.Join(command, " ") != "quit" {
+		t.Fatalf("splitSendCommand with -X as a value: rest=%q command=%q mode=%q", rest, command, mode)
+	}
+
+	if _, _, mode := splitSendCommand([]string{"-ls"}); mode != "" {
+		t.Fatalf("splitSendCommand without -X: mode = %q", mode)
+	}
+}
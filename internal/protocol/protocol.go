@@ -0,0 +1,362 @@
+// Package protocol defines the messages exchanged between sgreen clients
+// and session servers over a session socket.
+//
+// Every message is a frame:
+//
+//	+--------+----------------------+-----------------+
+//	| type   | length (big endian)  | payload         |
+//	| 1 byte | 4 bytes              | length bytes    |
+//	+--------+----------------------+-----------------+
+//
+// A connection starts with a handshake. The client sends Hello with the
+// magic "SGRN", the newest protocol version it speaks and the oldest one it
+// still accepts. The server answers Welcome with the version both sides
+// will use, or Error if there is none, and closes the connection.
+//
+// After the handshake the client sends one request:
+//
+//   - Attach: the client becomes a display of the session. It then sends
+//     Input and Resize frames, and receives Output and Suspend frames until
+//     the server ends the display with Detach, Exit or Error.
+//   - Command: the server runs a command and answers Reply or Error.
+//   - Detach: the server detaches the displays attached to the session,
+//     hanging up their clients as the DetachRequest asks. It answers Reply
+//     once the displays are hung up, or Error if none is attached.
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Protocol versions spoken by this build
+const (
+	Version    = 1
+	MinVersion = 1
+)
+
+// MaxPayload is the largest payload accepted in a frame.
+const MaxPayload = 1 << 20
+
+const headerLen = 5
+
+var magic = [4]byte{'S', 'G', 'R', 'N'}
+
+// Type identifies the kind of a frame.
+type Type uint8
+
+// Frame types
+const (
+	TypeHello   Type = 1  // client -> server: magic, version, min version
+	TypeWelcome Type = 2  // server -> client: negotiated version
+	TypeError   Type = 3  // either way: error message, ends the request
+	TypeAttach  Type = 4  // client -> server: AttachRequest as JSON
+	TypeCommand Type = 5  // client -> server: CommandRequest as JSON
+	TypeReply   Type = 6  // server -> client: command succeeded, CommandReply as JSON
+	TypeInput   Type = 7  // client -> server: keyboard input
+	TypeOutput  Type = 8  // server -> client: terminal output
+	TypeResize  Type = 9  // client -> server: width, height (uint16 each)
+	TypeSuspend Type = 10 // server -> client: suspend the client (C-a s)
+	TypeDetach  Type = 11 // either way: DetachRequest as JSON, see there
+	TypeExit    Type = 12 // server -> client: the session ended
+)
+
+var typeNames = map[Type]string{
+	TypeHello:   "hello",
+	TypeWelcome: "welcome",
+	TypeError:   "error",
+	TypeAttach:  "attach",
+	TypeCommand: "command",
+	TypeReply:   "reply",
+	TypeInput:   "input",
+	TypeOutput:  "output",
+	TypeResize:  "resize",
+	TypeSuspend: "suspend",
+	TypeDetach:  "detach",
+	TypeExit:    "exit",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("type(%d)", uint8(t))
+}
+
+var (
+	// ErrFrameTooLarge is returned for frames with a payload over MaxPayload.
+	ErrFrameTooLarge = errors.New("frame too large")
+	// ErrBadHello is returned when the peer does not speak this protocol.
+	ErrBadHello = errors.New("peer does not speak the sgreen protocol")
+)
+
+// VersionError is returned when client and server share no protocol version.
+type VersionError struct {
+	Version    int // newest version of the peer
+	MinVersion int // oldest version of the peer
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("incompatible protocol version %d (supported: %d-%d)", e.Version, MinVersion, Version)
+}
+
+// RemoteError is an error reported by the peer in an Error frame.
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+// UnexpectedError is returned when a frame arrives out of order.
+type UnexpectedError struct {
+	Got  Type
+	Want []Type
+}
+
+func (e *UnexpectedError) Error() string {
+	return fmt.Sprintf("unexpected %s frame, want %v", e.Got, e.Want)
+}
+
+// Frame is a single protocol message.
+type Frame struct {
+	Type    Type
+	Payload []byte
+}
+
+// Err returns the error carried by an Error frame, or nil.
+func (f Frame) Err() error {
+	if f.Type != TypeError {
+		return nil
+	}
+	return &RemoteError{Message: string(f.Payload)}
+}
+
+// WriteFrame writes one frame to w.
+func WriteFrame(w io.Writer, f Frame) error {
+	if len(f.Payload) > MaxPayload {
+		return ErrFrameTooLarge
+	}
+	buf := make([]byte, headerLen+len(f.Payload))
+	buf[0] = byte(f.Type)
+	binary.BigEndian.PutUint32(buf[1:headerLen], uint32(len(f.Payload)))
+	copy(buf[headerLen:], f.Payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadFrame reads one frame from r.
+func ReadFrame(r io.Reader) (Frame, error) {
+	var header [headerLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Frame{}, err
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n > MaxPayload {
+		return Frame{}, ErrFrameTooLarge
+	}
+	f := Frame{Type: Type(header[0])}
+	if n > 0 {
+		f.Payload = make([]byte, n)
+		if _, err := io.ReadFull(r, f.Payload); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return Frame{}, err
+		}
+	}
+	return f, nil
+}
+
+// Conn exchanges frames over a connection. Send may be called from several
+// goroutines; Receive must only be called from one.
+type Conn struct {
+	r   *bufio.Reader
+	w   io.Writer
+	wmu sync.Mutex
+
+	// Version is the protocol version agreed on in the handshake.
+	Version int
+}
+
+// NewConn wraps rw for exchanging frames.
+func NewConn(rw io.ReadWriter) *Conn {
+	return &Conn{r: bufio.NewReader(rw), w: rw}
+}
+
+// Send writes a frame.
+func (c *Conn) Send(t Type, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return WriteFrame(c.w, Frame{Type: t, Payload: payload})
+}
+
+// Receive reads the next frame.
+func (c *Conn) Receive() (Frame, error) {
+	return ReadFrame(c.r)
+}
+
+// SendError sends an Error frame with the message of err.
+func (c *Conn) SendError(err error) error {
+	return c.Send(TypeError, []byte(err.Error()))
+}
+
+// SendJSON sends a frame with v encoded as JSON.
+func (c *Conn) SendJSON(t Type, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Send(t, data)
+}
+
+// SendResize sends a Resize frame.
+func (c *Conn) SendResize(width, height int) error {
+	return c.Send(TypeResize, EncodeSize(width, height))
+}
+
+// Handshake performs the client side of the handshake and returns the
+// negotiated version.
+func (c *Conn) Handshake() (int, error) {
+	hello := make([]byte, 0, len(magic)+4)
+	hello = append(hello, magic[:]...)
+	hello = binary.BigEndian.AppendUint16(hello, Version)
+	hello = binary.BigEndian.AppendUint16(hello, MinVersion)
+	if err := c.Send(TypeHello, hello); err != nil {
+		return 0, err
+	}
+
+	f, err := c.Receive()
+	if err != nil {
+		// Servers that predate the framed protocol drop the connection
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrFrameTooLarge) {
+			return 0, ErrBadHello
+		}
+		return 0, err
+	}
+	switch f.Type {
+	case TypeWelcome:
+		if len(f.Payload) != 2 {
+			return 0, ErrBadHello
+		}
+		version := int(binary.BigEndian.Uint16(f.Payload))
+		if version < MinVersion || version > Version {
+			return 0, &VersionError{Version: version, MinVersion: version}
+		}
+		c.Version = version
+		return version, nil
+	case TypeError:
+		return 0, f.Err()
+	default:
+		return 0, ErrBadHello
+	}
+}
+
+// Accept performs the server side of the handshake. When the client cannot
+// be served, an Error frame is sent before the error is returned.
+func (c *Conn) Accept() (int, error) {
+	f, err := c.Receive()
+	if err != nil && !errors.Is(err, ErrFrameTooLarge) {
+		return 0, err
+	}
+	if err != nil || f.Type != TypeHello || len(f.Payload) != len(magic)+4 || !bytes.Equal(f.Payload[:len(magic)], magic[:]) {
+		_ = c.SendError(ErrBadHello)
+		return 0, ErrBadHello
+	}
+	peerVersion := int(binary.BigEndian.Uint16(f.Payload[4:6]))
+	peerMin := int(binary.BigEndian.Uint16(f.Payload[6:8]))
+	version, err := negotiate(peerVersion, peerMin, Version, MinVersion)
+	if err != nil {
+		_ = c.SendError(err)
+		return 0, err
+	}
+	if err := c.Send(TypeWelcome, binary.BigEndian.AppendUint16(nil, uint16(version))); err != nil {
+		return 0, err
+	}
+	c.Version = version
+	return version, nil
+}
+
+// negotiate returns the newest version spoken both by a peer speaking
+// peerMin to peerVersion and by a side speaking minVersion to version, or
+// a *VersionError if there is none.
+func negotiate(peerVersion, peerMin, version, minVersion int) (int, error) {
+	if peerVersion < version {
+		version = peerVersion
+	}
+	if version < minVersion || version < peerMin {
+		return 0, &VersionError{Version: peerVersion, MinVersion: peerMin}
+	}
+	return version, nil
+}
+
+// AttachRequest is the payload of an Attach frame.
+type AttachRequest struct {
+	Width  int             `json:"width"`
+	Height int             `json:"height"`
+	Config json.RawMessage `json:"config,omitempty"`
+
+	// The attaching client, as listed by -ls
+	Pid  int    `json:"pid,omitempty"`
+	Tty  string `json:"tty,omitempty"`
+	User string `json:"user,omitempty"`
+}
+
+// CommandRequest is the payload of a Command frame.
+type CommandRequest struct {
+	Args []string `json:"args"` // The command name and its arguments
+	// Window names the window the command acts on by number or title, as
+	// given to -p. Empty or "=" means the current window.
+	Window string `json:"window,omitempty"`
+	// Query asks for a query command (-Q) that reports without changing
+	// the session.
+	Query bool `json:"query,omitempty"`
+}
+
+// CommandReply is the payload of a Reply frame.
+type CommandReply struct {
+	Output string `json:"output,omitempty"` // The messages of the command
+	// Status is the exit status the command asks the client to exit with,
+	// as wait does with the status of a window.
+	Status int `json:"status,omitempty"`
+}
+
+// DetachRequest is the payload of a Detach frame. A client sends it to
+// detach the displays attached to a session; the server sends it to each
+// client whose display was detached. An empty payload means a plain detach.
+type DetachRequest struct {
+	Power bool `json:"power,omitempty"` // Also hang up the client's controlling process
+}
+
+// EncodeSize encodes a terminal size for a Resize frame.
+func EncodeSize(width, height int) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint16(buf[0:2], clampSize(width))
+	binary.BigEndian.PutUint16(buf[2:4], clampSize(height))
+	return buf
+}
+
+// DecodeSize decodes the payload of a Resize frame.
+func DecodeSize(payload []byte) (width, height int, err error) {
+	if len(payload) != 4 {
+		return 0, 0, fmt.Errorf("invalid resize payload length %d", len(payload))
+	}
+	return int(binary.BigEndian.Uint16(payload[0:2])), int(binary.BigEndian.Uint16(payload[2:4])), nil
+}
+
+func clampSize(n int) uint16 {
+	if n < 0 {
+		return 0
+	}
+	if n > 0xffff {
+		return 0xffff
+	}
+	return uint16(n)
+}
@@ -0,0 +1,222 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	frames := []Frame{
+		{Type: TypeInput, Payload: []byte("echo hi\r")},
+		{Type: TypeOutput, Payload: bytes.Repeat([]byte{0x1b, 'x'}, 4096)},
+		{Type: TypeDetach},
+		{Type: TypeResize, Payload: EncodeSize(132, 43)},
+	}
+
+	var buf bytes.Buffer
+	for _, f := range frames {
+		if err := WriteFrame(&buf, f); err != nil {
+			t.Fatalf("WriteFrame(%s) error: %v", f.Type, err)
+		}
+	}
+	for _, want := range frames {
+		got, err := ReadFrame(&buf)
+		if err != nil {
+			t.Fatalf("ReadFrame error: %v", err)
+		}
+		if got.Type != want.Type || !bytes.Equal(got.Payload, want.Payload) {
+			t.Fatalf("ReadFrame = %s %q, want %s %q", got.Type, got.Payload, want.Type, want.Payload)
+		}
+	}
+	if _, err := ReadFrame(&buf); err != io.EOF {
+		t.Fatalf("ReadFrame at end = %v, want io.EOF", err)
+	}
+}
+
+func TestReadFrameRejectsOversizedAndTruncated(t *testing.T) {
+	header := []byte{byte(TypeOutput), 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[1:], MaxPayload+1)
+	if _, err := ReadFrame(bytes.NewReader(header)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("oversized frame error = %v, want ErrFrameTooLarge", err)
+	}
+
+	var buf bytes.Buffer
+	_ = WriteFrame(&buf, Frame{Type: TypeInput, Payload: []byte("abcdef")})
+	truncated := buf.Bytes()[:buf.Len()-2]
+	if _, err := ReadFrame(bytes.NewReader(truncated)); err != io.ErrUnexpectedEOF {
+		t.Fatalf("truncated frame error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestSizeEncoding(t *testing.T) {
+	width, height, err := DecodeSize(EncodeSize(200, 50))
+	if err != nil || width != 200 || height != 50 {
+		t.Fatalf("DecodeSize = %d, %d, %v; want 200, 50, nil", width, height, err)
+	}
+	if width, height, _ := DecodeSize(EncodeSize(-1, 1<<20)); width != 0 || height != 0xffff {
+		t.Fatalf("sizes not clamped: %d, %d", width, height)
+	}
+	if _, _, err := DecodeSize([]byte{1, 2}); err == nil {
+		t.Fatalf("DecodeSize accepted a short payload")
+	}
+}
+
+// handshake runs the server side of a handshake against a client that
+// sends the given Hello payload, and returns both results.
+func handshake(t *testing.T, hello []byte) (serverErr error, reply Frame) {
+	t.Helper()
+	clientSide, serverSide := net.Pipe()
+	defer func() {
+		_ = clientSide.Close()
+		_ = serverSide.Close()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewConn(serverSide).Accept()
+		done <- err
+	}()
+
+	client := NewConn(clientSide)
+	if err := client.Send(TypeHello, hello); err != nil {
+		t.Fatalf("sending hello: %v", err)
+	}
+	reply, err := client.Receive()
+	if err != nil {
+		t.Fatalf("reading handshake reply: %v", err)
+	}
+	return <-done, reply
+}
+
+func helloPayload(version, minVersion uint16) []byte {
+	p := append([]byte(nil), magic[:]...)
+	p = binary.BigEndian.AppendUint16(p, version)
+	return binary.BigEndian.AppendUint16(p, minVersion)
+}
+
+func TestHandshake(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer func() {
+		_ = clientSide.Close()
+		_ = serverSide.Close()
+	}()
+
+	server := NewConn(serverSide)
+	done := make(chan error, 1)
+	go func() {
+		_, err := server.Accept()
+		done <- err
+	}()
+
+	client := NewConn(clientSide)
+	version, err := client.Handshake()
+	if err != nil {
+		t.Fatalf("Handshake error: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	if version != Version || client.Version != Version || server.Version != Version {
+		t.Fatalf("negotiated versions client=%d server=%d, want %d", client.Version, server.Version, Version)
+	}
+}
+
+func TestHandshakeNegotiatesNewerClient(t *testing.T) {
+	// A newer client that still accepts our version settles on ours
+	serverErr, reply := handshake(t, helloPayload(Version+3, MinVersion))
+	if serverErr != nil {
+		t.Fatalf("Accept error: %v", serverErr)
+	}
+	if reply.Type != TypeWelcome || int(binary.BigEndian.Uint16(reply.Payload)) != Version {
+		t.Fatalf("reply = %s %v, want welcome %d", reply.Type, reply.Payload, Version)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := []struct {
+		name                 string
+		peerVersion, peerMin int
+		version, minVersion  int
+		want                 int
+		incompatible         bool
+	}{
+		{name: "same", peerVersion: 2, peerMin: 1, version: 2, minVersion: 1, want: 2},
+		{name: "older client", peerVersion: 2, peerMin: 1, version: 3, minVersion: 1, want: 2},
+		{name: "newer client", peerVersion: 4, peerMin: 2, version: 3, minVersion: 1, want: 3},
+		{name: "client too old", peerVersion: 1, peerMin: 1, version: 3, minVersion: 2, incompatible: true},
+		{name: "client too new", peerVersion: 5, peerMin: 4, version: 3, minVersion: 1, incompatible: true},
+	}
+	for _, c := range cases {
+		got, err := negotiate(c.peerVersion, c.peerMin, c.version, c.minVersion)
+		var verr *VersionError
+		if c.incompatible {
+			if !errors.As(err, &verr) {
+				t.Fatalf("%s: negotiate error = %v, want *VersionError", c.name, err)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Fatalf("%s: negotiate = %d, %v, want %d", c.name, got, err, c.want)
+		}
+	}
+}
+
+func TestHandshakeRefusesIncompatibleVersion(t *testing.T) {
+	serverErr, reply := handshake(t, helloPayload(Version+2, Version+1))
+	var verr *VersionError
+	if !errors.As(serverErr, &verr) {
+		t.Fatalf("Accept error = %v, want *VersionError", serverErr)
+	}
+	if reply.Type != TypeError || !strings.Contains(string(reply.Payload), "incompatible protocol version") {
+		t.Fatalf("reply = %s %q, want version error", reply.Type, reply.Payload)
+	}
+}
+
+func TestAcceptRefusesForeignClient(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer func() {
+		_ = clientSide.Close()
+		_ = serverSide.Close()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewConn(serverSide).Accept()
+		done <- err
+	}()
+
+	// Something that is not a frame at all, e.g. a JSON request
+	go func() {
+		_, _ = clientSide.Write([]byte(`{"type":"attach","width":80}` + "\n"))
+	}()
+	reply, err := ReadFrame(clientSide)
+	if err != nil {
+		t.Fatalf("reading reply: %v", err)
+	}
+	if reply.Type != TypeError {
+		t.Fatalf("reply = %s, want error", reply.Type)
+	}
+	if err := <-done; !errors.Is(err, ErrBadHello) {
+		t.Fatalf("Accept error = %v, want ErrBadHello", err)
+	}
+}
+
+func TestHandshakeWithServerThatHangsUp(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	go func() {
+		_, _ = ReadFrame(serverSide)
+		_ = serverSide.Close()
+	}()
+	defer func() {
+		_ = clientSide.Close()
+	}()
+
+	if _, err := NewConn(clientSide).Handshake(); !errors.Is(err, ErrBadHello) {
+		t.Fatalf("Handshake error = %v, want ErrBadHello", err)
+	}
+}
@@ -4,8 +4,15 @@
 package pty
 
 import (
+	"errors"
+	"fmt"
 	"os/exec"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 // setProcessGroup sets the process group for the command
@@ -19,3 +26,100 @@ func setProcessGroup(cmd *exec.Cmd) {
 	// Set process group ID to 0 (creates new group)
 	cmd.SysProcAttr.Pgid = 0
 }
+
+// processGroupOf returns the process group of a started command. It is
+// looked up right away, as it can't be once the process has been reaped.
+func processGroupOf(cmd *exec.Cmd) int {
+	if cmd.Process == nil {
+		return 0
+	}
+	pgid, err := syscall.Getpgid(cmd.Process.Pid)
+	if err != nil {
+		return 0
+	}
+	return pgid
+}
+
+// Signal sends sig to the process group of the command, so that programs
+// started by it get the signal too. A group that is gone is not an error.
+func (p *PTYProcess) Signal(sig syscall.Signal) error {
+	var err error
+	switch {
+	case p.pgid > 0:
+		err = syscall.Kill(-p.pgid, sig)
+	case p.Cmd != nil && p.Cmd.Process != nil:
+		err = syscall.Kill(p.Cmd.Process.Pid, sig)
+	}
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
+
+// SignalForeground sends sig to the foreground job of the terminal, or to
+// the process group of the command if the job can't be found.
+func (p *PTYProcess) SignalForeground(sig syscall.Signal) error {
+	if p.Pty != nil {
+		if fg, err := unix.IoctlGetInt(int(p.Pty.Fd()), unix.TIOCGPGRP); err == nil && fg > 0 {
+			if err := syscall.Kill(-fg, sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+				return err
+			}
+			return nil
+		}
+	}
+	return p.Signal(sig)
+}
+
+// Terminate ends the process group of the command: it sends SIGHUP, then
+// SIGTERM, then SIGKILL, each one grace after the last while any process
+// of the group is left.
+func (p *PTYProcess) Terminate(grace time.Duration) error {
+	for _, sig := range []syscall.Signal{syscall.SIGHUP, syscall.SIGTERM} {
+		if err := p.Signal(sig); err != nil {
+			return err
+		}
+		if p.waitGroupExit(grace) {
+			return nil
+		}
+	}
+	return p.Signal(syscall.SIGKILL)
+}
+
+// waitGroupExit waits up to timeout for the process group to be empty and
+// reports whether it is.
+func (p *PTYProcess) waitGroupExit(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if !p.groupAlive() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// groupAlive reports whether any process of the group is left
+func (p *PTYProcess) groupAlive() bool {
+	if p.pgid <= 0 {
+		return p.IsAlive()
+	}
+	return !errors.Is(syscall.Kill(-p.pgid, 0), syscall.ESRCH)
+}
+
+// ParseSignal parses a signal given as a name, with or without SIG, or as
+// a number, like kill(1) does.
+func ParseSignal(name string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	upper := strings.ToUpper(name)
+	if !strings.HasPrefix(upper, "SIG") {
+		upper = "SIG" + upper
+	}
+	if sig := unix.SignalNum(upper); sig != 0 {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unknown signal %s", name)
+}
@@ -3,10 +3,61 @@
 
 package pty
 
-import "os/exec"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
 
 // setProcessGroup is a no-op on Windows
 func setProcessGroup(cmd *exec.Cmd) {
 	// Windows doesn't have process groups in the same way
 	// No-op
 }
+
+// processGroupOf returns 0 on Windows, which has no process groups
+func processGroupOf(cmd *exec.Cmd) int {
+	return 0
+}
+
+// Signal kills the process on Windows, which can't deliver other signals
+func (p *PTYProcess) Signal(sig syscall.Signal) error {
+	err := p.Kill()
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
+
+// SignalForeground kills the process on Windows, which has no jobs
+func (p *PTYProcess) SignalForeground(sig syscall.Signal) error {
+	return p.Signal(sig)
+}
+
+// Terminate kills the process on Windows, without a grace period
+func (p *PTYProcess) Terminate(grace time.Duration) error {
+	return p.Signal(syscall.SIGKILL)
+}
+
+// ParseSignal parses the signal names Windows knows, or a number
+func ParseSignal(name string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "HUP":
+		return syscall.SIGHUP, nil
+	case "INT":
+		return syscall.SIGINT, nil
+	case "KILL":
+		return syscall.SIGKILL, nil
+	case "TERM":
+		return syscall.SIGTERM, nil
+	}
+	return 0, fmt.Errorf("unknown signal %s", name)
+}
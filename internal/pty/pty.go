@@ -17,6 +17,7 @@ type PTYProcess struct {
 	Cmd     *exec.Cmd
 	Pty     *os.File
 	PtsPath string // Path to the PTY slave device
+	pgid    int    // Process group of the command, 0 if unknown
 }
 
 // Start creates a new PTY process with the given command and arguments
@@ -26,9 +27,8 @@ func Start(cmdPath string, args []string) (*PTYProcess, error) {
 
 // StartWithEnv creates a new PTY process with custom environment variables
 func StartWithEnv(cmdPath string, args []string, envOverrides map[string]string) (*PTYProcess, error) {
-	wrappedCmdPath, wrappedArgs := wrapCommandForDetach(cmdPath, args)
 	buildCmd := func(withProcessGroup bool) *exec.Cmd {
-		cmd := exec.Command(wrappedCmdPath, wrappedArgs...)
+		cmd := exec.Command(cmdPath, args...)
 		if withProcessGroup {
 			// Set process group management (Unix only)
 			setProcessGroup(cmd)
@@ -83,6 +83,7 @@ func StartWithEnv(cmdPath string, args []string, envOverrides map[string]string)
 		Cmd:     cmd,
 		Pty:     ptyFile,
 		PtsPath: ptsPath,
+		pgid:    processGroupOf(cmd),
 	}, nil
 }
 
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/inoki/sgreen/internal/protocol"
+	"github.com/inoki/sgreen/internal/session"
+	"github.com/inoki/sgreen/internal/ui"
+)
+
+var (
+	// ErrNoServer is returned when no server is listening for a session.
+	ErrNoServer = errors.New("no server for session")
+	// ErrPowerDetach is returned by Attach when the display was power
+	// detached. It matches ui.ErrDetach.
+	ErrPowerDetach = ui.ErrPowerDetach
+)
+
+const dialTimeout = 2 * time.Second
+
+// dial connects to the server of the session with the given ID and
+// performs the protocol handshake.
+func dial(id string) (net.Conn, *protocol.Conn, error) {
+	rw, err := net.DialTimeout("unix", session.SocketPath(id), dialTimeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w %s: %v", ErrNoServer, id, err)
+	}
+	conn := protocol.NewConn(rw)
+	_ = rw.SetDeadline(time.Now().Add(dialTimeout))
+	if _, err := conn.Handshake(); err != nil {
+		_ = rw.Close()
+		return nil, nil, fmt.Errorf("session %s: %w", id, err)
+	}
+	_ = rw.SetDeadline(time.Time{})
+	return rw, conn, nil
+}
+
+// Reachable reports whether a server is accepting clients for the session.
+// A server speaking an incompatible protocol version is still reachable;
+// requests to it fail with a version error.
+func Reachable(id string) bool {
+	rw, err := net.DialTimeout("unix", session.SocketPath(id), dialTimeout)
+	if err != nil {
+		return false
+	}
+	_ = rw.Close()
+	return true
+}
+
+// Command asks the session's server to run a command, and returns its
+// reply once the command is done. The command acts on the window named by
+// window, as given to -p, or on the current window if window is empty.
+func Command(id, window string, args []string) (*protocol.CommandReply, error) {
+	return request(id, &protocol.CommandRequest{Args: args, Window: window})
+}
+
+// Query asks the session's server to run a query command, as for -Q, and
+// returns its answer.
+func Query(id, window string, args []string) (string, error) {
+	reply, err := request(id, &protocol.CommandRequest{Args: args, Window: window, Query: true})
+	if err != nil {
+		return "", err
+	}
+	return reply.Output, nil
+}
+
+// request sends a command request to the session's server and returns its
+// reply.
+func request(id string, req *protocol.CommandRequest) (*protocol.CommandReply, error) {
+	rw, conn, err := dial(id)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rw.Close()
+	}()
+
+	if err := conn.SendJSON(protocol.TypeCommand, req); err != nil {
+		return nil, err
+	}
+	f, err := conn.Receive()
+	if err != nil {
+		return nil, fmt.Errorf("no reply from session %s: %w", id, err)
+	}
+	switch f.Type {
+	case protocol.TypeReply:
+		var reply protocol.CommandReply
+		if err := json.Unmarshal(f.Payload, &reply); err != nil {
+			return nil, fmt.Errorf("invalid reply from session %s: %w", id, err)
+		}
+		return &reply, nil
+	case protocol.TypeError:
+		return nil, f.Err()
+	default:
+		return nil, &protocol.UnexpectedError{Got: f.Type, Want: []protocol.Type{protocol.TypeReply, protocol.TypeError}}
+	}
+}
+
+// Detach detaches the displays attached to the session from whichever
+// terminals they are on, and waits until they are gone. A power detach also
+// hangs up the controlling process of each client, like GNU screen -D.
+func Detach(id string, power bool) error {
+	rw, conn, err := dial(id)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rw.Close()
+	}()
+
+	if err := conn.SendJSON(protocol.TypeDetach, &protocol.DetachRequest{Power: power}); err != nil {
+		return err
+	}
+	reply, err := conn.Receive()
+	if err != nil {
+		return fmt.Errorf("no reply from session %s: %w", id, err)
+	}
+	switch reply.Type {
+	case protocol.TypeReply:
+		return nil
+	case protocol.TypeError:
+		return reply.Err()
+	default:
+		return &protocol.UnexpectedError{Got: reply.Type, Want: []protocol.Type{protocol.TypeReply, protocol.TypeError}}
+	}
+}
+
+// Attach connects the terminal in/out to the session's server and relays
+// keyboard input, output and size changes until the display detaches or
+// the session ends. It returns ui.ErrDetach when the display detached, and
+// ErrPowerDetach after hanging up its parent process on a power detach.
+func Attach(id string, in, out *os.File, config *ui.AttachConfig) error {
+	rw, conn, err := dial(id)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rw.Close()
+	}()
+	// Deferred first so that the terminal is restored before the hangup
+	powerDetached := false
+	defer func() {
+		if powerDetached {
+			hangupParent()
+		}
+	}()
+
+	req := protocol.AttachRequest{
+		Pid:  os.Getpid(),
+		Tty:  ttyName(in),
+		User: session.CurrentUser(),
+	}
+	req.Width, req.Height = terminalSize(out)
+	if config != nil {
+		if req.Config, err = json.Marshal(config); err != nil {
+			return err
+		}
+	}
+	if err := conn.SendJSON(protocol.TypeAttach, &req); err != nil {
+		return err
+	}
+
+	restoreModes := ui.SetupTerminal(out)
+	defer func() {
+		restoreModes()
+	}()
+
+	// Save original terminal state
+	oldState, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = term.Restore(int(in.Fd()), oldState)
+	}()
+
+	// Forward keyboard input
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := in.Read(buf)
+			if n > 0 {
+				if sendErr := conn.Send(protocol.TypeInput, buf[:n]); sendErr != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Forward terminal size changes
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	defer stopResize(resized)
+	go func() {
+		for range resized {
+			_ = conn.SendResize(terminalSize(out))
+		}
+	}()
+
+	for {
+		f, err := conn.Receive()
+		if err != nil {
+			return fmt.Errorf("lost connection to session %s: %w", id, err)
+		}
+		switch f.Type {
+		case protocol.TypeOutput:
+			if _, err := out.Write(f.Payload); err != nil {
+				return err
+			}
+		case protocol.TypeSuspend:
+			_ = term.Restore(int(in.Fd()), oldState)
+			restoreModes()
+			suspendSelf()
+			restoreModes = ui.SetupTerminal(out)
+			if _, err := term.MakeRaw(int(in.Fd())); err != nil {
+				return err
+			}
+			_ = conn.SendResize(terminalSize(out))
+		case protocol.TypeDetach:
+			var detach protocol.DetachRequest
+			if len(f.Payload) > 0 {
+				_ = json.Unmarshal(f.Payload, &detach)
+			}
+			if detach.Power {
+				powerDetached = true
+				return ErrPowerDetach
+			}
+			return ui.ErrDetach
+		case protocol.TypeExit:
+			return nil
+		case protocol.TypeError:
+			return f.Err()
+		}
+	}
+}
+
+// ttyName returns the device name of the terminal f, or "" if it is not
+// known.
+func ttyName(f *os.File) string {
+	name, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", f.Fd()))
+	if err != nil || !strings.HasPrefix(name, "/dev/") {
+		return ""
+	}
+	return name
+}
+
+// terminalSize returns the size of the terminal behind f, or 80x24.
+func terminalSize(f *os.File) (width, height int) {
+	width, height, err := term.GetSize(int(f.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
@@ -0,0 +1,463 @@
+// Package server runs the long-lived process behind each sgreen session.
+//
+// The server owns the PTY master of every window in the session and keeps
+// the programs running while no terminal is attached. Clients talk to it
+// over a per-session Unix socket (see session.SocketPath): attaching clients
+// forward keyboard input and terminal size changes and receive the output
+// rendered by the UI, which runs inside the server for each display.
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/inoki/sgreen/internal/protocol"
+	"github.com/inoki/sgreen/internal/session"
+	"github.com/inoki/sgreen/internal/ui"
+)
+
+const (
+	serverEnv  = "SGREEN_SERVER"
+	optionsEnv = "SGREEN_SERVER_OPTIONS"
+	readyFDEnv = "SGREEN_READY_FD"
+
+	// How long Start waits for a new server to report readiness
+	startTimeout = 10 * time.Second
+	// How long a terminating server waits for displays to see the end
+	drainTimeout = time.Second
+)
+
+// Options describes the session a server creates.
+type Options struct {
+	SessionID string            `json:"session_id"`
+	CmdPath   string            `json:"cmd_path"`
+	CmdArgs   []string          `json:"cmd_args"`
+	Title     string            `json:"title,omitempty"`    // Title of the first window
+	PidName   string            `json:"pid_name,omitempty"` // Rename the session to <pid>-<PidName> once started
+	Config    *session.Config   `json:"config,omitempty"`
+	Monitor   *ui.MonitorConfig `json:"monitor,omitempty"` // Logging and notifications, kept up while detached
+}
+
+// readyMessage is written by a background server once it accepts clients
+type readyMessage struct {
+	SessionID string `json:"session_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type server struct {
+	sess     *session.Session
+	config   *session.Config // Settings for new windows
+	monitor  *ui.Monitor
+	listener *net.UnixListener
+	conns    sync.WaitGroup
+	done     chan struct{}
+	doneOnce sync.Once
+
+	mu          sync.Mutex
+	attachments map[*attachment]bool
+}
+
+// attachment is a display attached through a client connection
+type attachment struct {
+	display *ui.Display
+	power   bool          // Detached by a power detach
+	done    chan struct{} // Closed once the display's UI has stopped
+}
+
+// Run creates the session described by opts and serves it until the
+// programs in all of its windows have exited. ready, if not nil, is called
+// once with the final session ID when clients can connect, or with the
+// error that prevented the session from starting.
+func Run(opts Options, ready func(id string, err error)) error {
+	notify := func(id string, err error) {
+		if ready != nil {
+			ready(id, err)
+		}
+	}
+
+	sess, err := session.NewWithConfig(opts.SessionID, opts.CmdPath, opts.CmdArgs, opts.Config)
+	if err != nil {
+		notify("", err)
+		return err
+	}
+	if opts.PidName != "" {
+		pidName := fmt.Sprintf("%d-%s", sess.Pid, opts.PidName)
+		if pidName != sess.ID {
+			_ = sess.Rename(pidName)
+		}
+	}
+	if opts.Title != "" {
+		if win := sess.GetCurrentWindow(); win != nil {
+			sess.SetTitleOf(win, opts.Title)
+			_ = sess.Save()
+		}
+	}
+
+	socketPath := session.SocketPath(sess.ID)
+	_ = os.Remove(socketPath)
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	if err != nil {
+		_ = session.Delete(sess.ID)
+		err = fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+		notify("", err)
+		return err
+	}
+	// The socket follows the session on rename; removal is done below.
+	listener.SetUnlinkOnClose(false)
+	_ = os.Chmod(socketPath, 0700)
+
+	srv := &server{
+		sess:     sess,
+		config:   opts.Config,
+		monitor:  ui.NewMonitor(sess, opts.Monitor),
+		listener: listener,
+		done:     make(chan struct{}),
+	}
+	defer func() {
+		_ = srv.monitor.Close()
+	}()
+	sess.SetWindowExitHandler(func(*session.Window) {
+		if !sess.IsActive() {
+			srv.shutdown()
+		}
+	})
+	if !sess.IsActive() {
+		srv.shutdown()
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+	go func() {
+		select {
+		case <-sigChan:
+			// Deleting the session on the way out ends the process group
+			// of every window, from SIGHUP up to SIGKILL
+			srv.shutdown()
+		case <-srv.done:
+		}
+	}()
+
+	notify(sess.ID, nil)
+	go srv.acceptLoop()
+
+	<-srv.done
+	_ = listener.Close()
+	srv.waitForConns(drainTimeout)
+
+	id := sess.ID
+	_ = session.Delete(id)
+	_ = os.Remove(session.SocketPath(id))
+	return nil
+}
+
+// shutdown stops the server; Run cleans up and returns.
+func (s *server) shutdown() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *server) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.conns.Add(1)
+		go func() {
+			defer s.conns.Done()
+			s.handleConn(conn)
+		}()
+	}
+}
+
+func (s *server) waitForConns(timeout time.Duration) {
+	finished := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(timeout):
+	}
+}
+
+// handleConn serves one client connection.
+func (s *server) handleConn(rw net.Conn) {
+	defer func() {
+		_ = rw.Close()
+	}()
+	conn := protocol.NewConn(rw)
+	if _, err := conn.Accept(); err != nil {
+		return
+	}
+
+	req, err := conn.Receive()
+	if err != nil {
+		return
+	}
+	switch req.Type {
+	case protocol.TypeAttach:
+		s.serveAttach(conn, req.Payload)
+	case protocol.TypeCommand:
+		var command protocol.CommandRequest
+		if err := json.Unmarshal(req.Payload, &command); err != nil {
+			_ = conn.SendError(fmt.Errorf("invalid command request: %w", err))
+			return
+		}
+		var win *session.Window
+		if command.Window != "" && command.Window != "=" {
+			if win = s.sess.FindWindow(command.Window); win == nil {
+				_ = conn.SendError(errors.New("could not find pre-select window"))
+				return
+			}
+		}
+		var out bytes.Buffer
+		ctx := &ui.CommandContext{
+			Session:      s.sess,
+			Window:       win,
+			Out:          &out,
+			Query:        command.Query,
+			WindowConfig: s.config,
+			Detach: func(power bool) error {
+				s.detachDisplays(power)
+				return nil
+			},
+		}
+		if err := ui.RunCommand(ctx, command.Args); err != nil {
+			_ = conn.SendError(err)
+			return
+		}
+		_ = conn.SendJSON(protocol.TypeReply, &protocol.CommandReply{Output: out.String(), Status: ctx.Status})
+	case protocol.TypeDetach:
+		var detach protocol.DetachRequest
+		if len(req.Payload) > 0 {
+			if err := json.Unmarshal(req.Payload, &detach); err != nil {
+				_ = conn.SendError(fmt.Errorf("invalid detach request: %w", err))
+				return
+			}
+		}
+		if s.detachDisplays(detach.Power) == 0 {
+			_ = conn.SendError(fmt.Errorf("session %s is not attached", s.sess.ID))
+			return
+		}
+		_ = conn.Send(protocol.TypeReply, nil)
+	default:
+		_ = conn.SendError(fmt.Errorf("unexpected request: %s", req.Type))
+	}
+}
+
+// serveAttach runs the UI for an attached client until it detaches, hangs
+// up, or the session ends.
+func (s *server) serveAttach(conn *protocol.Conn, payload []byte) {
+	var req protocol.AttachRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		_ = conn.SendError(fmt.Errorf("invalid attach request: %w", err))
+		return
+	}
+	config := ui.DefaultAttachConfig()
+	if len(req.Config) > 0 {
+		if err := json.Unmarshal(req.Config, config); err != nil {
+			_ = conn.SendError(fmt.Errorf("invalid attach config: %w", err))
+			return
+		}
+	}
+
+	display := ui.NewDisplay(&outputWriter{conn: conn}, req.Width, req.Height)
+	display.OnSuspend = func() {
+		_ = conn.Send(protocol.TypeSuspend, nil)
+	}
+	display.Monitor = s.monitor
+	defer display.Hangup()
+
+	a := &attachment{display: display, done: make(chan struct{})}
+	s.mu.Lock()
+	if s.attachments == nil {
+		s.attachments = make(map[*attachment]bool)
+	}
+	s.attachments[a] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.attachments, a)
+		s.mu.Unlock()
+		close(a.done)
+	}()
+
+	display.Client = session.Client{Pid: req.Pid, Tty: req.Tty, User: req.User, AttachedAt: time.Now()}
+	removeClient := s.sess.AddClient(display.Client)
+	defer removeClient()
+
+	go func() {
+		for {
+			f, err := conn.Receive()
+			if err != nil {
+				display.Hangup()
+				return
+			}
+			switch f.Type {
+			case protocol.TypeInput:
+				display.Feed(f.Payload)
+			case protocol.TypeResize:
+				if width, height, err := protocol.DecodeSize(f.Payload); err == nil {
+					display.Resize(width, height)
+				}
+			}
+		}
+	}()
+
+	err := ui.AttachWithConfig(display, s.sess, config)
+	switch {
+	case err == nil:
+		_ = conn.Send(protocol.TypeExit, nil)
+	case errors.Is(err, ui.ErrDetach):
+		s.mu.Lock()
+		power := a.power || errors.Is(err, ui.ErrPowerDetach)
+		s.mu.Unlock()
+		_ = conn.SendJSON(protocol.TypeDetach, &protocol.DetachRequest{Power: power})
+	default:
+		_ = conn.SendError(err)
+	}
+}
+
+// detachDisplays detaches every attached display and waits for their UIs
+// to stop. It returns the number of displays detached.
+func (s *server) detachDisplays(power bool) int {
+	s.mu.Lock()
+	detached := make([]*attachment, 0, len(s.attachments))
+	for a := range s.attachments {
+		a.power = power
+		detached = append(detached, a)
+	}
+	s.mu.Unlock()
+
+	timeout := time.After(drainTimeout)
+	for _, a := range detached {
+		a.display.Hangup()
+		select {
+		case <-a.done:
+		case <-timeout:
+		}
+	}
+	return len(detached)
+}
+
+// outputWriter sends display output to the client as Output frames
+type outputWriter struct {
+	conn *protocol.Conn
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > protocol.MaxPayload {
+			chunk = chunk[:protocol.MaxPayload]
+		}
+		if err := w.conn.Send(protocol.TypeOutput, chunk); err != nil {
+			return 0, err
+		}
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// RunIfRequested runs a background server when the current process was
+// started by Start, and reports whether it did.
+func RunIfRequested() bool {
+	if os.Getenv(serverEnv) != "1" {
+		return false
+	}
+	rawOpts := os.Getenv(optionsEnv)
+	readyFD, _ := strconv.Atoi(os.Getenv(readyFDEnv))
+	// Keep the server's environment out of the windows it starts
+	_ = os.Unsetenv(serverEnv)
+	_ = os.Unsetenv(optionsEnv)
+	_ = os.Unsetenv(readyFDEnv)
+
+	var readyFile *os.File
+	if readyFD > 0 {
+		readyFile = os.NewFile(uintptr(readyFD), "sgreen-server-ready")
+	}
+	ready := func(id string, err error) {
+		if readyFile == nil {
+			return
+		}
+		msg := readyMessage{SessionID: id}
+		if err != nil {
+			msg.Error = err.Error()
+		}
+		_ = json.NewEncoder(readyFile).Encode(&msg)
+		_ = readyFile.Close()
+	}
+
+	var opts Options
+	if err := json.Unmarshal([]byte(rawOpts), &opts); err != nil {
+		ready("", fmt.Errorf("invalid server options: %w", err))
+		os.Exit(1)
+	}
+	if err := Run(opts, ready); err != nil {
+		os.Exit(1)
+	}
+	return true
+}
+
+// Start launches a background server process for a new session and waits
+// until it accepts clients. It returns the final session ID.
+func Start(opts Options) (string, error) {
+	selfPath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to get executable path: %w", err)
+	}
+	data, err := json.Marshal(&opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode server options: %w", err)
+	}
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return "", fmt.Errorf("failed to create ready pipe: %w", err)
+	}
+	defer func() {
+		_ = readyR.Close()
+	}()
+
+	cmd := exec.Command(selfPath)
+	cmd.Env = append(os.Environ(),
+		serverEnv+"=1",
+		optionsEnv+"="+string(data),
+		readyFDEnv+"=3",
+	)
+	cmd.Stdin = nil
+	cmd.Stdout = nil
+	cmd.Stderr = nil
+	cmd.ExtraFiles = []*os.File{readyW}
+	setDetachSysProcAttr(cmd)
+	if err := cmd.Start(); err != nil {
+		_ = readyW.Close()
+		return "", fmt.Errorf("failed to start session server: %w", err)
+	}
+	_ = readyW.Close()
+	_ = cmd.Process.Release()
+
+	_ = readyR.SetReadDeadline(time.Now().Add(startTimeout))
+	var msg readyMessage
+	if err := json.NewDecoder(readyR).Decode(&msg); err != nil {
+		return "", fmt.Errorf("session server did not start: %w", err)
+	}
+	if msg.Error != "" {
+		return "", errors.New(msg.Error)
+	}
+	return msg.SessionID, nil
+}
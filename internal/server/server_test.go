@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/inoki/sgreen/internal/protocol"
+	"github.com/inoki/sgreen/internal/session"
+)
+
+// connect serves one connection to a server for sess and returns the
+// client side after the handshake.
+func connect(t *testing.T, sess *session.Session) *protocol.Conn {
+	t.Helper()
+	clientSide, serverSide := net.Pipe()
+	t.Cleanup(func() {
+		_ = clientSide.Close()
+	})
+
+	srv := &server{sess: sess, done: make(chan struct{})}
+	go srv.handleConn(serverSide)
+
+	conn := protocol.NewConn(clientSide)
+	if _, err := conn.Handshake(); err != nil {
+		t.Fatalf("Handshake error: %v", err)
+	}
+	return conn
+}
+
+// receiveUntil skips output frames and returns the first other frame.
+func receiveUntil(t *testing.T, conn *protocol.Conn) protocol.Frame {
+	t.Helper()
+	for {
+		f, err := conn.Receive()
+		if err != nil {
+			t.Fatalf("Receive error: %v", err)
+		}
+		if f.Type != protocol.TypeOutput {
+			return f
+		}
+	}
+}
+
+func TestCommandRequest(t *testing.T) {
+	sess := &session.Session{ID: "proto-test"}
+
+	conn := connect(t, sess)
+	if err := conn.SendJSON(protocol.TypeCommand, &protocol.CommandRequest{Args: []string{"detach"}}); err != nil {
+		t.Fatalf("SendJSON error: %v", err)
+	}
+	if f := receiveUntil(t, conn); f.Type != protocol.TypeReply {
+		t.Fatalf("reply = %s %q, want reply", f.Type, f.Payload)
+	}
+
+	conn = connect(t, sess)
+	if err := conn.SendJSON(protocol.TypeCommand, &protocol.CommandRequest{Args: []string{"bogus", "arg"}}); err != nil {
+		t.Fatalf("SendJSON error: %v", err)
+	}
+	f := receiveUntil(t, conn)
+	if f.Type != protocol.TypeError || !strings.Contains(f.Err().Error(), "unknown command 'bogus'") {
+		t.Fatalf("reply = %s %q, want unknown command error", f.Type, f.Payload)
+	}
+}
+
+func TestAttachRequestWithoutWindows(t *testing.T) {
+	conn := connect(t, &session.Session{ID: "proto-test"})
+	if err := conn.SendJSON(protocol.TypeAttach, &protocol.AttachRequest{Width: 80, Height: 24}); err != nil {
+		t.Fatalf("SendJSON error: %v", err)
+	}
+	f := receiveUntil(t, conn)
+	if f.Type != protocol.TypeError || !strings.Contains(f.Err().Error(), "PTY process not available") {
+		t.Fatalf("reply = %s %q, want PTY error", f.Type, f.Payload)
+	}
+}
+
+func TestUnexpectedRequest(t *testing.T) {
+	conn := connect(t, &session.Session{ID: "proto-test"})
+	if err := conn.Send(protocol.TypeInput, []byte("ls\r")); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	f := receiveUntil(t, conn)
+	if f.Type != protocol.TypeError || !strings.Contains(f.Err().Error(), "unexpected request: input") {
+		t.Fatalf("reply = %s %q, want unexpected request error", f.Type, f.Payload)
+	}
+}
+
+func TestDetachRequestWithoutDisplays(t *testing.T) {
+	conn := connect(t, &session.Session{ID: "proto-test"})
+	if err := conn.SendJSON(protocol.TypeDetach, &protocol.DetachRequest{Power: true}); err != nil {
+		t.Fatalf("SendJSON error: %v", err)
+	}
+	f := receiveUntil(t, conn)
+	if f.Type != protocol.TypeError || !strings.Contains(f.Err().Error(), "is not attached") {
+		t.Fatalf("reply = %s %q, want not attached error", f.Type, f.Payload)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// setDetachSysProcAttr starts the server in its own session, away from the
+// terminal it was launched from.
+func setDetachSysProcAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// notifyResize delivers terminal size changes (SIGWINCH) to c.
+func notifyResize(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGWINCH)
+}
+
+func stopResize(c chan<- os.Signal) {
+	signal.Stop(c)
+}
+
+// hangupParent hangs up the process that started the client, normally the
+// login shell of its terminal.
+func hangupParent() {
+	_ = syscall.Kill(os.Getppid(), syscall.SIGHUP)
+}
+
+// suspendSelf stops the client process until it is continued.
+func suspendSelf() {
+	_ = syscall.Kill(os.Getpid(), syscall.SIGTSTP)
+}
@@ -0,0 +1,22 @@
+//go:build windows
+// +build windows
+
+package server
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setDetachSysProcAttr(cmd *exec.Cmd) {}
+
+// notifyResize is a no-op: Windows consoles do not signal size changes.
+func notifyResize(c chan<- os.Signal) {}
+
+func stopResize(c chan<- os.Signal) {}
+
+// hangupParent is a no-op: Windows has no terminal hangup.
+func hangupParent() {}
+
+// suspendSelf is a no-op: Windows has no job control.
+func suspendSelf() {}
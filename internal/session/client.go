@@ -0,0 +1,61 @@
+package session
+
+import "time"
+
+// Client describes a terminal attached to a session
+type Client struct {
+	Pid        int       `json:"pid"`           // Process ID of the attached sgreen client
+	Tty        string    `json:"tty,omitempty"` // Terminal device of the client
+	User       string    `json:"user,omitempty"`
+	AttachedAt time.Time `json:"attached_at"`
+	ReadOnly   bool      `json:"read_only,omitempty"` // The client may only watch the windows
+
+	id int // Identifies the client for removal
+}
+
+// AddClient records an attached client and saves the session, so that other
+// sgreen processes can tell whether the session is attached. The returned
+// function removes the client again.
+func (s *Session) AddClient(c Client) (remove func()) {
+	if c.AttachedAt.IsZero() {
+		c.AttachedAt = time.Now()
+	}
+	s.mu.Lock()
+	s.nextClient++
+	c.id = s.nextClient
+	s.Clients = append(s.Clients, c)
+	s.mu.Unlock()
+	s.SaveIfOpen()
+
+	return func() {
+		s.mu.Lock()
+		for i := range s.Clients {
+			if s.Clients[i].id == c.id {
+				s.Clients = append(s.Clients[:i], s.Clients[i+1:]...)
+				break
+			}
+		}
+		s.mu.Unlock()
+		s.SaveIfOpen()
+	}
+}
+
+// AttachedClients returns the clients attached to the session.
+func (s *Session) AttachedClients() []Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clients := make([]Client, len(s.Clients))
+	copy(clients, s.Clients)
+	return clients
+}
+
+// SaveIfOpen saves the session unless it was deleted, which happens while
+// the last displays are still leaving.
+func (s *Session) SaveIfOpen() {
+	sessionsMu.RLock()
+	open := sessions[s.ID] == s
+	sessionsMu.RUnlock()
+	if open {
+		_ = s.save()
+	}
+}
@@ -0,0 +1,26 @@
+package session
+
+import "testing"
+
+func TestAddClientRemovesTheRightClient(t *testing.T) {
+	s := &Session{ID: "clients"}
+	removeFirst := s.AddClient(Client{Pid: 1})
+	removeSecond := s.AddClient(Client{Pid: 2})
+	if got := len(s.AttachedClients()); got != 2 {
+		t.Fatalf("clients = %d, want 2", got)
+	}
+
+	removeFirst()
+	removeFirst()
+	clients := s.AttachedClients()
+	if len(clients) != 1 || clients[0].Pid != 2 {
+		t.Fatalf("clients after removing the first = %+v, want only pid 2", clients)
+	}
+	if clients[0].AttachedAt.IsZero() {
+		t.Fatalf("client attach time not set")
+	}
+	removeSecond()
+	if got := len(s.AttachedClients()); got != 0 {
+		t.Fatalf("clients = %d, want 0", got)
+	}
+}
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"fmt"
+	"time"
+)
+
+// WindowTypeGroup is the type of group windows. A group window runs no
+// program; it holds other windows, like the groups of GNU screen, and new
+// windows join the group of the current window.
+const WindowTypeGroup = "group"
+
+// IsGroup reports whether w is a group window.
+func (w *Window) IsGroup() bool {
+	return w.Type == WindowTypeGroup
+}
+
+// CreateGroup creates a group window titled title in the group of the
+// current window, with window number number if it is free, or else the
+// next higher free one, like screen //group.
+func (s *Session) CreateGroup(number int, title string) (*Window, error) {
+	return s.createGroup(s.View(), number, title)
+}
+
+func (s *Session) createGroup(v *View, number int, title string) (*Window, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.freeNumberLocked(number)
+	if id < 0 {
+		return nil, fmt.Errorf("maximum number of windows (%d) reached", s.maxWindowsLocked())
+	}
+	window := &Window{
+		ID:        id,
+		Number:    windowNumberToString(id),
+		Title:     title,
+		Type:      WindowTypeGroup,
+		CmdPath:   "//group",
+		Group:     v.groupLocked(),
+		CreatedAt: time.Now(),
+	}
+	s.insertWindowLocked(window)
+	v.switchLocked(window)
+	return window, nil
+}
+
+// GroupOf returns the group window win belongs to, or nil at the top
+// level.
+func (s *Session) GroupOf(win *Window) *Window {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.groupOfLocked(win)
+}
+
+func (s *Session) groupOfLocked(win *Window) *Window {
+	if win.Group == nil {
+		return nil
+	}
+	for _, w := range s.Windows {
+		if w.ID == *win.Group {
+			return w
+		}
+	}
+	return nil
+}
+
+// SetGroup moves win into the group window group, or to the top level for
+// a nil group.
+func (s *Session) SetGroup(win, group *Window) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if group == nil {
+		win.setGroup(nil)
+		return nil
+	}
+	if !group.IsGroup() {
+		return fmt.Errorf("window %s is not a group", group.Number)
+	}
+	for g := group; g != nil; g = s.groupOfLocked(g) {
+		if g == win {
+			return fmt.Errorf("window %s cannot be in a group it holds", win.Number)
+		}
+	}
+	id := group.ID
+	win.setGroup(&id)
+	return nil
+}
+
+// setGroup sets the number of the group window holding w.
+func (w *Window) setGroup(group *int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.Group = group
+}
+
+// sameGroup reports whether two windows with the given groups are in the
+// same group.
+func sameGroup(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,59 @@
+package session
+
+import "testing"
+
+func TestGroupsScopeNextAndFollowNumbers(t *testing.T) {
+	s := &Session{}
+	shell := &Window{}
+	shell.setNumber(0)
+	s.Windows = []*Window{shell}
+
+	// New windows join the current group window, or the current window's
+	// group
+	dev, err := s.CreateGroup(0, "dev")
+	if err != nil || dev.ID != 1 || dev.Group != nil {
+		t.Fatalf("CreateGroup = %+v, %v", dev, err)
+	}
+	editor, err := s.CreateGroup(0, "editor")
+	if err != nil || s.GroupOf(editor) != dev {
+		t.Fatalf("group of editor = %+v, %v; want dev", s.GroupOf(editor), err)
+	}
+	build := &Window{}
+	build.setNumber(3)
+	s.Windows = append(s.Windows, build)
+	if err := s.SetGroup(build, dev); err != nil {
+		t.Fatalf("SetGroup: %v", err)
+	}
+	if err := s.SetGroup(dev, editor); err == nil {
+		t.Fatalf("SetGroup put dev into a group it holds")
+	}
+
+	// next and prev stay in the group of the current window
+	s.CurrentWindow = 2
+	s.NextWindow()
+	if got := s.GetCurrentWindow(); got != build {
+		t.Fatalf("next from editor = %s, want 3", got.Number)
+	}
+	s.NextWindow()
+	if got := s.GetCurrentWindow(); got != editor {
+		t.Fatalf("next from 3 = %s, want editor", got.Number)
+	}
+	s.PrevWindow()
+	if got := s.GetCurrentWindow(); got != build {
+		t.Fatalf("prev from editor = %s, want 3", got.Number)
+	}
+
+	// Members follow a renumbered group, and move up when it is removed
+	if err := s.SetWindowNumber(dev, 7); err != nil {
+		t.Fatalf("SetWindowNumber: %v", err)
+	}
+	if s.GroupOf(build) != dev || s.GroupOf(editor) != dev {
+		t.Fatalf("members lost group 7")
+	}
+	if err := s.KillWindow(dev); err != nil {
+		t.Fatalf("KillWindow: %v", err)
+	}
+	if s.GroupOf(build) != nil || s.GroupOf(editor) != nil {
+		t.Fatalf("members of a removed group should be at the top level")
+	}
+}
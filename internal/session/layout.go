@@ -0,0 +1,211 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Layout is a named arrangement of regions, like a layout of GNU screen.
+// Layouts belong to the session and are saved with it; each display shows
+// one at a time.
+type Layout struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	// Autosave saves the regions of a display into the layout when the
+	// display leaves it or detaches
+	Autosave bool `json:"autosave"`
+	// Root is the region tree, nil until the layout is first saved
+	Root *LayoutNode `json:"root,omitempty"`
+	// Focus is the index of the focused region, top left to bottom right
+	Focus int `json:"focus,omitempty"`
+}
+
+// LayoutNode is a region of a layout or, when it has children, a split of
+// its area into rows or side-by-side columns.
+type LayoutNode struct {
+	Vertical bool          `json:"vertical,omitempty"` // Children are side by side
+	Size     int           `json:"size,omitempty"`     // Rows or columns in the parent split
+	Children []*LayoutNode `json:"children,omitempty"`
+	Window   *int          `json:"window,omitempty"` // Number of the window shown, nil when blank
+}
+
+// LayoutList is the layouts of a session. Sessions saved before layouts
+// kept regions stored a map from names to windows, which is dropped.
+type LayoutList []*Layout
+
+// UnmarshalJSON reads a list of layouts, ignoring the old map.
+func (l *LayoutList) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		*l = nil
+		return nil
+	}
+	return json.Unmarshal(data, (*[]*Layout)(l))
+}
+
+// copy returns a copy of the layout; the region tree is shared, as it is
+// replaced rather than changed.
+func (l *Layout) copy() *Layout {
+	c := *l
+	return &c
+}
+
+// LayoutsByNumber returns copies of the layouts of the session, by number.
+func (s *Session) LayoutsByNumber() []*Layout {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Layout, 0, len(s.Layouts))
+	for _, l := range s.Layouts {
+		out = append(out, l.copy())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Number < out[j].Number })
+	return out
+}
+
+// FindLayout returns a copy of the layout named by number or, failing
+// that, by title, or nil if there is none.
+func (s *Session) FindLayout(name string) *Layout {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if n, err := strconv.Atoi(name); err == nil {
+		if l := s.layoutLocked(n); l != nil {
+			return l.copy()
+		}
+	}
+	for _, l := range s.Layouts {
+		if l.Title == name {
+			return l.copy()
+		}
+	}
+	return nil
+}
+
+// LayoutNumbered returns a copy of layout n, or nil if there is none.
+func (s *Session) LayoutNumbered(n int) *Layout {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if l := s.layoutLocked(n); l != nil {
+		return l.copy()
+	}
+	return nil
+}
+
+func (s *Session) layoutLocked(n int) *Layout {
+	for _, l := range s.Layouts {
+		if l.Number == n {
+			return l
+		}
+	}
+	return nil
+}
+
+// NewLayout creates a layout with the lowest free number and autosave on.
+// An empty title is the number.
+func (s *Session) NewLayout(title string) *Layout {
+	s.mu.Lock()
+	n := 0
+	for s.layoutLocked(n) != nil {
+		n++
+	}
+	if title == "" {
+		title = strconv.Itoa(n)
+	}
+	l := &Layout{Number: n, Title: title, Autosave: true}
+	s.Layouts = append(s.Layouts, l)
+	s.mu.Unlock()
+	s.SaveIfOpen()
+	return l.copy()
+}
+
+// SaveLayoutRegions stores a region tree and its focused region in layout
+// n.
+func (s *Session) SaveLayoutRegions(n int, root *LayoutNode, focus int) error {
+	return s.changeLayout(n, func(l *Layout) error {
+		l.Root, l.Focus = root, focus
+		return nil
+	})
+}
+
+// SetLayoutTitle sets the title of layout n.
+func (s *Session) SetLayoutTitle(n int, title string) error {
+	return s.changeLayout(n, func(l *Layout) error {
+		l.Title = title
+		return nil
+	})
+}
+
+// SetLayoutAutosave turns the autosave of layout n on or off.
+func (s *Session) SetLayoutAutosave(n int, on bool) error {
+	return s.changeLayout(n, func(l *Layout) error {
+		l.Autosave = on
+		return nil
+	})
+}
+
+// SetLayoutNumber gives layout n the number to. A layout already numbered
+// to gets number n, as with windows.
+func (s *Session) SetLayoutNumber(n, to int) error {
+	if to < 0 {
+		return fmt.Errorf("layout number %d out of range", to)
+	}
+	return s.changeLayout(n, func(l *Layout) error {
+		if other := s.layoutLocked(to); other != nil {
+			other.Number = n
+		}
+		l.Number = to
+		return nil
+	})
+}
+
+// LastLayoutNumber returns the number of the layout a display showed last,
+// which new displays start with, or -1.
+func (s *Session) LastLayoutNumber() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.LastLayout
+}
+
+// SetLastLayout records that a display shows layout n, or none for -1.
+func (s *Session) SetLastLayout(n int) {
+	s.mu.Lock()
+	s.LastLayout = n
+	s.mu.Unlock()
+	s.SaveIfOpen()
+}
+
+// RemoveLayout removes layout n.
+func (s *Session) RemoveLayout(n int) error {
+	s.mu.Lock()
+	idx := -1
+	for i, l := range s.Layouts {
+		if l.Number == n {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		s.mu.Unlock()
+		return fmt.Errorf("no layout %d", n)
+	}
+	s.Layouts = append(s.Layouts[:idx], s.Layouts[idx+1:]...)
+	s.mu.Unlock()
+	s.SaveIfOpen()
+	return nil
+}
+
+// changeLayout runs change on layout n and saves the session.
+func (s *Session) changeLayout(n int, change func(l *Layout) error) error {
+	s.mu.Lock()
+	l := s.layoutLocked(n)
+	if l == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("no layout %d", n)
+	}
+	err := change(l)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.SaveIfOpen()
+	return nil
+}
@@ -0,0 +1,50 @@
+package session
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLayoutsSaveAndRenumber(t *testing.T) {
+	s := &Session{LastLayout: -1}
+	first := s.NewLayout("")
+	second := s.NewLayout("editing")
+	if first.Number != 0 || first.Title != "0" || second.Number != 1 || !second.Autosave {
+		t.Fatalf("new layouts = %+v, %+v", first, second)
+	}
+	win := 3
+	root := &LayoutNode{Vertical: true, Children: []*LayoutNode{{Size: 39, Window: &win}, {Size: 40}}}
+	if err := s.SaveLayoutRegions(1, root, 1); err != nil {
+		t.Fatalf("save regions: %v", err)
+	}
+
+	// Numbering a layout like another swaps their numbers
+	if err := s.SetLayoutNumber(1, 0); err != nil {
+		t.Fatalf("number: %v", err)
+	}
+	if l := s.FindLayout("editing"); l == nil || l.Number != 0 || l.Focus != 1 {
+		t.Fatalf("layout editing = %+v, want number 0 with focus 1", l)
+	}
+
+	data, err := json.Marshal(s.Layouts)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var loaded LayoutList
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	s = &Session{Layouts: loaded}
+	l := s.LayoutNumbered(0)
+	if l == nil || l.Root == nil || len(l.Root.Children) != 2 || *l.Root.Children[0].Window != 3 {
+		t.Fatalf("loaded layout 0 = %+v", l)
+	}
+	if err := s.RemoveLayout(1); err != nil || len(s.LayoutsByNumber()) != 1 {
+		t.Fatalf("remove: %v, layouts %d", err, len(s.LayoutsByNumber()))
+	}
+
+	// Sessions saved before layouts kept regions had a map of names
+	if err := json.Unmarshal([]byte(`{"main": 2}`), &loaded); err != nil || loaded != nil {
+		t.Fatalf("old layouts = %v, %v; want none", loaded, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -20,29 +21,50 @@ type Config struct {
 	UTF8            bool
 	Scrollback      int
 	AllCapabilities bool
-	Encoding        string // Window encoding (e.g., UTF-8, ISO-8859-1)
+	Encoding        string        // Window encoding (e.g., UTF-8, ISO-8859-1)
+	Zombie          string        // Keys to close and respawn dead windows, see Session.ZombieKeys
+	MaxWindows      int           // Number of window numbers, see Session.MaxWindows
+	KillGrace       time.Duration // Wait between kill signals, see Session.KillGrace
 }
 
 // Session represents a screen session
 type Session struct {
-	ID           string         `json:"id"`
-	CmdPath      string         `json:"cmd_path"`
-	CmdArgs      []string       `json:"cmd_args"`
-	Pid          int            `json:"pid"`
-	PtsPath      string         `json:"pts_path,omitempty"`
-	CreatedAt    time.Time      `json:"created_at"`
-	Owner        string         `json:"owner,omitempty"`
-	AllowedUsers []string       `json:"allowed_users,omitempty"`
-	Layouts      map[string]int `json:"layouts,omitempty"`
+	ID           string     `json:"id"`
+	CmdPath      string     `json:"cmd_path"`
+	CmdArgs      []string   `json:"cmd_args"`
+	Pid          int        `json:"pid"`
+	PtsPath      string     `json:"pts_path,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Owner        string     `json:"owner,omitempty"`
+	AllowedUsers []string   `json:"allowed_users,omitempty"`
+	Layouts      LayoutList `json:"layouts,omitempty"`
+	ServerPid    int        `json:"server_pid,omitempty"` // PID of the server process that owns the windows
+	// Two keys: the first closes a dead window and the second reruns its
+	// program. Dead windows are kept only when set (screen's zombie).
+	ZombieKeys string `json:"zombie_keys,omitempty"`
+	// New windows get numbers below MaxWindows; 0 means DefaultMaxWindows.
+	MaxWindows int `json:"max_windows,omitempty"`
+	// Number of the layout last shown by a display, -1 for none
+	LastLayout int `json:"last_layout"`
+	// Killed windows get SIGHUP, SIGTERM and SIGKILL, KillGrace apart; 0
+	// means DefaultKillGrace.
+	KillGrace time.Duration `json:"kill_grace,omitempty"`
 
 	// Window management
 	Windows       []*Window `json:"windows,omitempty"`     // All windows in this session
 	CurrentWindow int       `json:"current_window"`        // Index of current window
 	LastWindow    int       `json:"last_window,omitempty"` // Index of last window (for C-a C-a)
 
+	// Terminals attached to the session, kept up to date by its server
+	Clients []Client `json:"clients,omitempty"`
+
 	// Runtime fields (not persisted)
-	PTYProcess *pty.PTYProcess `json:"-"` // Deprecated: use Windows[CurrentWindow] instead
-	mu         sync.RWMutex    `json:"-"`
+	PTYProcess     *pty.PTYProcess             `json:"-"` // Deprecated: use Windows[CurrentWindow] instead
+	onWindowExit   func(*Window)               `json:"-"`
+	onWindowOutput func(*Window, []byte, bool) `json:"-"`
+	nextClient     int                         `json:"-"`
+	mu             sync.RWMutex                `json:"-"`
+	saveMu         sync.Mutex                  `json:"-"` // Saves share a temporary file
 }
 
 var (
@@ -180,14 +202,23 @@ func NewWithConfig(id, cmdPath string, args []string, config *Config) (*Session,
 		CmdPath:       cmdPath,
 		CmdArgs:       args,
 		Pid:           ptyProc.Cmd.Process.Pid,
-		PtsPath:       ptyProc.PtsPath, // Store PTY path for reconnection (backward compat)
+		PtsPath:       ptyProc.PtsPath, // Kept for backward compatibility
 		CreatedAt:     time.Now(),
 		Owner:         CurrentUser(),
+		ServerPid:     os.Getpid(), // Sessions are created by the server process that owns them
 		Windows:       []*Window{window},
 		CurrentWindow: 0,
 		LastWindow:    0,
+		LastLayout:    -1,
 		PTYProcess:    ptyProc, // Deprecated: kept for backward compatibility
 	}
+	if config != nil {
+		sess.ZombieKeys = config.Zombie
+		sess.MaxWindows = config.MaxWindows
+		sess.KillGrace = config.KillGrace
+	}
+	window.onExit = sess.windowExited
+	window.onOutput = sess.windowOutput
 
 	// Store in memory
 	sessions[id] = sess
@@ -199,6 +230,7 @@ func NewWithConfig(id, cmdPath string, args []string, config *Config) (*Session,
 		_ = ptyProc.Kill()
 		return nil, fmt.Errorf("failed to save session: %w", err)
 	}
+	window.startOutputPump(ptyProc)
 
 	return sess, nil
 }
@@ -209,18 +241,6 @@ func Load(id string) (*Session, error) {
 	// Check in-memory first
 	if sess, exists := sessions[id]; exists {
 		sessionsMu.RUnlock()
-		// Check if the process is still alive
-		if sess.PTYProcess != nil && !sess.PTYProcess.IsAlive() {
-			// Process died, try to reconnect if we have a pts path
-			if sess.PtsPath != "" {
-				sessionsMu.Lock()
-				if err := sess.ReconnectPTY(); err == nil {
-					sessionsMu.Unlock()
-					return sess, nil
-				}
-				sessionsMu.Unlock()
-			}
-		}
 		return sess, nil
 	}
 	sessionsMu.RUnlock()
@@ -231,13 +251,6 @@ func Load(id string) (*Session, error) {
 		return nil, err
 	}
 
-	// Try to reconnect to the PTY if we have a path and process is still alive
-	if sess.PtsPath != "" && isProcessAlive(sess.Pid) {
-		if err := sess.ReconnectPTY(); err != nil {
-			_ = err
-		}
-	}
-
 	sessionsMu.Lock()
 	sessions[id] = sess
 	sessionsMu.Unlock()
@@ -245,24 +258,6 @@ func Load(id string) (*Session, error) {
 	return sess, nil
 }
 
-// ReconnectPTY attempts to reconnect to an existing PTY
-func (s *Session) ReconnectPTY() error {
-	if s.PtsPath == "" {
-		return fmt.Errorf("no PTY path available")
-	}
-
-	ptyProc, err := pty.Reconnect(s.PtsPath)
-	if err != nil {
-		return fmt.Errorf("failed to reconnect to PTY: %w", err)
-	}
-
-	s.mu.Lock()
-	s.PTYProcess = ptyProc
-	s.mu.Unlock()
-
-	return nil
-}
-
 // isProcessAlive checks if a process with the given PID is still running
 func isProcessAlive(pid int) bool {
 	process, err := os.FindProcess(pid)
@@ -344,15 +339,6 @@ func List() []*Session {
 
 	// Add memory sessions first
 	for _, sess := range memorySessions {
-		// Clean up dead sessions
-		if sess.PTYProcess != nil && !sess.PTYProcess.IsAlive() {
-			// Try to reconnect if we have a pts path
-			if sess.PtsPath != "" && isProcessAlive(sess.Pid) {
-				if err := sess.ReconnectPTY(); err != nil {
-					_ = err
-				}
-			}
-		}
 		result = append(result, sess)
 		seen[sess.ID] = true
 	}
@@ -360,21 +346,6 @@ func List() []*Session {
 	// Add disk sessions that aren't in memory
 	for _, sess := range diskSessions {
 		if !seen[sess.ID] {
-			// Try to reconnect windows if processes are still alive
-			hasAliveWindow := false
-			for _, win := range sess.Windows {
-				if win.PtsPath != "" && isProcessAlive(win.Pid) {
-					if err := sess.ReconnectPTY(); err == nil {
-						hasAliveWindow = true
-					}
-				}
-			}
-			// Also try old method for backward compatibility
-			if !hasAliveWindow && sess.PtsPath != "" && isProcessAlive(sess.Pid) {
-				if err := sess.ReconnectPTY(); err != nil {
-					_ = err
-				}
-			}
 			result = append(result, sess)
 		}
 	}
@@ -410,6 +381,8 @@ func loadAllFromDisk() ([]*Session, error) {
 
 // save persists the session to disk
 func (s *Session) save() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -482,40 +455,62 @@ func loadFromDisk(id string) (*Session, error) {
 	return &sess, nil
 }
 
-// Delete removes a session from memory and disk
+// Delete removes a session from memory and disk. Sessions only known from
+// disk, such as those of a dead server, just have their files removed.
 func Delete(id string) error {
 	sessionsMu.Lock()
 	defer sessionsMu.Unlock()
 
+	filePath := filepath.Join(sessionsDir, id+".json")
 	sess, exists := sessions[id]
 	if !exists {
-		return fmt.Errorf("session %s not found", id)
-	}
+		if _, err := os.Stat(filePath); err != nil {
+			return fmt.Errorf("session %s not found", id)
+		}
+	} else {
+		// The windows get their grace periods without holding up other
+		// users of the session list, such as the window exit handler
+		sessionsMu.Unlock()
+		sess.terminateWindows()
+		sessionsMu.Lock()
 
-	// Kill all processes in all windows
-	for _, win := range sess.Windows {
-		if win.GetPTYProcess() != nil {
-			_ = win.GetPTYProcess().Kill()
+		// Also kill legacy PTY process if exists
+		if sess.PTYProcess != nil {
+			_ = sess.PTYProcess.Kill()
 		}
-	}
 
-	// Also kill legacy PTY process if exists
-	if sess.PTYProcess != nil {
-		_ = sess.PTYProcess.Kill()
+		// Remove from memory
+		delete(sessions, id)
 	}
 
-	// Remove from memory
-	delete(sessions, id)
-
 	// Remove from disk
-	filePath := filepath.Join(sessionsDir, id+".json")
 	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove session file: %w", err)
 	}
+	_ = os.Remove(SocketPath(id))
 
 	return nil
 }
 
+// terminateWindows ends the process groups of all windows at once and
+// waits until they are gone.
+func (s *Session) terminateWindows() {
+	grace := s.KillGraceDuration()
+	s.mu.RLock()
+	windows := append([]*Window(nil), s.Windows...)
+	s.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, win := range windows {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = win.Kill(grace)
+		}()
+	}
+	wg.Wait()
+}
+
 // CleanupOrphanedProcesses cleans up orphaned processes from dead sessions
 func CleanupOrphanedProcesses() error {
 	sessionsMu.Lock()
@@ -535,7 +530,11 @@ func CleanupOrphanedProcesses() error {
 	for _, sess := range diskSessions {
 		// Check if session is in memory
 		if _, inMemory := sessions[sess.ID]; !inMemory {
-			// Session not in memory, check if processes are orphaned
+			// Window processes are only orphaned once the server that owns
+			// their PTYs is gone
+			if sess.ServerPid <= 0 || isProcessAlive(sess.ServerPid) {
+				continue
+			}
 			hasAliveProcess := false
 
 			// Check windows
@@ -561,6 +560,7 @@ func CleanupOrphanedProcesses() error {
 			if !hasAliveProcess {
 				filePath := filepath.Join(sessionsDir, sess.ID+".json")
 				_ = os.Remove(filePath)
+				_ = os.Remove(SocketPath(sess.ID))
 			}
 		}
 	}
@@ -615,6 +615,13 @@ func (s *Session) GetCurrentWindow() *Window {
 	return s.Windows[s.CurrentWindow]
 }
 
+// ListWindows returns the windows of the session in list order.
+func (s *Session) ListWindows() []*Window {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Window(nil), s.Windows...)
+}
+
 // GetWindow returns a window by its number (0-9, A-Z)
 func (s *Session) GetWindow(number string) *Window {
 	s.mu.RLock()
@@ -631,36 +638,70 @@ func (s *Session) GetWindow(number string) *Window {
 	return nil
 }
 
-// CreateWindow creates a new window in the session
+// FindWindow returns the window named by a window number (0-9, A-Z) or,
+// failing that, by its title, or nil if there is none.
+func (s *Session) FindWindow(name string) *Window {
+	if win := s.GetWindow(name); win != nil {
+		return win
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, win := range s.Windows {
+		if win.Title == name {
+			return win
+		}
+	}
+	return nil
+}
+
+// WindowNumbered returns the window with number id, or nil if there is
+// none.
+func (s *Session) WindowNumbered(id int) *Window {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, win := range s.Windows {
+		if win.ID == id {
+			return win
+		}
+	}
+	return nil
+}
+
+// DefaultKillGrace is how long a killed window gets to exit before the
+// next, stronger signal
+const DefaultKillGrace = 2 * time.Second
+
+// Limits of the number of window numbers (screen's maxwin)
+const (
+	DefaultMaxWindows = 36 // 0-9 and A-Z
+	MaxMaxWindows     = 1000
+)
+
+// CreateWindow creates a new window in the session, with the lowest free
+// window number
 func (s *Session) CreateWindow(cmdPath string, args []string, config *Config) (*Window, error) {
+	return s.CreateWindowAt(0, cmdPath, args, config)
+}
+
+// CreateWindowAt creates a new window in the session, with window number
+// number if it is free, or else the next higher free one, like screen N
+func (s *Session) CreateWindowAt(number int, cmdPath string, args []string, config *Config) (*Window, error) {
+	return s.createWindow(s.View(), number, cmdPath, args, config)
+}
+
+// createWindow creates a window in the group of view v and makes it the
+// current window of v.
+func (s *Session) createWindow(v *View, number int, cmdPath string, args []string, config *Config) (*Window, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Find next available window number
-	nextID := len(s.Windows)
-	if nextID >= 36 {
-		return nil, fmt.Errorf("maximum number of windows (36) reached")
-	}
-
-	// Build environment overrides
-	envOverrides := make(map[string]string)
-	if config != nil {
-		if config.Term != "" {
-			envOverrides["TERM"] = config.Term
-		} else {
-			envOverrides["TERM"] = "screen"
-		}
-		if config.AllCapabilities {
-			if envOverrides["TERM"] == "screen" {
-				envOverrides["TERM"] = "screen-256color"
-			}
-		}
-	} else {
-		envOverrides["TERM"] = "screen"
+	nextID := s.freeNumberLocked(number)
+	if nextID < 0 {
+		return nil, fmt.Errorf("maximum number of windows (%d) reached", s.maxWindowsLocked())
 	}
 
 	// Start PTY process
-	ptyProc, err := pty.StartWithEnv(cmdPath, args, envOverrides)
+	ptyProc, err := pty.StartWithEnv(cmdPath, args, windowEnv(config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to start PTY: %w", err)
 	}
@@ -694,114 +735,315 @@ func (s *Session) CreateWindow(cmdPath string, args []string, config *Config) (*
 		CreatedAt:      time.Now(),
 		ScrollbackSize: scrollbackSize,
 		Encoding:       encoding,
+		Group:          v.groupLocked(),
 		PTYProcess:     ptyProc,
 	}
 
+	window.onExit = s.windowExited
+	window.onOutput = s.windowOutput
+	window.startOutputPump(ptyProc)
+
 	// Add to session
-	s.Windows = append(s.Windows, window)
-	s.LastWindow = s.CurrentWindow
-	s.CurrentWindow = nextID
+	s.insertWindowLocked(window)
+	v.switchLocked(window)
 
 	return window, nil
 }
 
-// SwitchToWindow switches to a window by number
-func (s *Session) SwitchToWindow(number string) error {
+// freeNumberLocked returns the lowest window number from number on that no
+// window uses, or -1 if there is none.
+func (s *Session) freeNumberLocked(number int) int {
+	used := make(map[int]bool, len(s.Windows))
+	for _, win := range s.Windows {
+		used[win.ID] = true
+	}
+	for n := max(number, 0); n < s.maxWindowsLocked(); n++ {
+		if !used[n] {
+			return n
+		}
+	}
+	return -1
+}
+
+// maxWindowsLocked returns the number of window numbers new windows may
+// get.
+func (s *Session) maxWindowsLocked() int {
+	if s.MaxWindows <= 0 {
+		return DefaultMaxWindows
+	}
+	return s.MaxWindows
+}
+
+// MaxWindowCount returns the number of window numbers new windows may get.
+func (s *Session) MaxWindowCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.maxWindowsLocked()
+}
+
+// SetMaxWindows sets the number of window numbers new windows may get, like
+// screen's maxwin. Existing windows keep their numbers.
+func (s *Session) SetMaxWindows(n int) error {
+	if n < 1 || n > MaxMaxWindows {
+		return fmt.Errorf("maxwin must be between 1 and %d", MaxMaxWindows)
+	}
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.MaxWindows = n
+	s.mu.Unlock()
+	s.SaveIfOpen()
+	return nil
+}
 
-	id, err := windowStringToNumber(number)
-	if err != nil {
-		return err
+// KillGraceDuration returns how long a killed window gets to exit before
+// the next, stronger signal.
+func (s *Session) KillGraceDuration() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.KillGrace <= 0 {
+		return DefaultKillGrace
 	}
+	return s.KillGrace
+}
 
-	// Find window
-	foundIdx := -1
-	for i, win := range s.Windows {
-		if win.ID == id {
-			foundIdx = i
+// SetKillGrace sets how long a killed window gets to exit before the next,
+// stronger signal.
+func (s *Session) SetKillGrace(grace time.Duration) error {
+	if grace <= 0 {
+		return fmt.Errorf("kill grace must be positive")
+	}
+	s.mu.Lock()
+	s.KillGrace = grace
+	s.mu.Unlock()
+	s.SaveIfOpen()
+	return nil
+}
+
+// insertWindowLocked adds a window to the list, which is kept in window
+// number order, and returns its index. The current and last window stay
+// the same windows.
+func (s *Session) insertWindowLocked(win *Window) int {
+	idx := len(s.Windows)
+	for i, w := range s.Windows {
+		if w.ID > win.ID {
+			idx = i
 			break
 		}
 	}
+	s.Windows = append(s.Windows, nil)
+	copy(s.Windows[idx+1:], s.Windows[idx:])
+	s.Windows[idx] = win
+	if len(s.Windows) > 1 {
+		if s.CurrentWindow >= idx {
+			s.CurrentWindow++
+		}
+		if s.LastWindow >= idx {
+			s.LastWindow++
+		}
+	}
+	return idx
+}
 
-	if foundIdx == -1 {
-		return fmt.Errorf("window %s not found", number)
+// SetWindowNumber gives a window another number. A window already using the
+// number gets the window's old number, like screen's number command.
+func (s *Session) SetWindowNumber(win *Window, number int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if number < 0 || number >= s.maxWindowsLocked() {
+		return fmt.Errorf("window number %d out of range", number)
 	}
 
-	s.LastWindow = s.CurrentWindow
-	s.CurrentWindow = foundIdx
+	current := s.currentLocked()
+	last := s.windowAtLocked(s.LastWindow)
+	old := win.ID
+	for _, w := range s.Windows {
+		if w != win && w.ID == number {
+			w.setNumber(old)
+		}
+		// Members follow their group to its new number
+		switch {
+		case w.Group == nil:
+		case *w.Group == old:
+			w.setGroup(&number)
+		case *w.Group == number:
+			w.setGroup(&old)
+		}
+	}
+	win.setNumber(number)
+	sort.SliceStable(s.Windows, func(i, j int) bool {
+		return s.Windows[i].ID < s.Windows[j].ID
+	})
+	for i, w := range s.Windows {
+		if w == current {
+			s.CurrentWindow = i
+		}
+		if w == last {
+			s.LastWindow = i
+		}
+	}
 	return nil
 }
 
-// NextWindow switches to the next window
-func (s *Session) NextWindow() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if len(s.Windows) == 0 {
-		return
+// currentLocked returns the current window, or nil.
+func (s *Session) currentLocked() *Window {
+	return s.windowAtLocked(s.CurrentWindow)
+}
+
+// windowAtLocked returns the window at index idx of the list, or nil.
+func (s *Session) windowAtLocked(idx int) *Window {
+	if idx < 0 || idx >= len(s.Windows) {
+		return nil
 	}
-	s.LastWindow = s.CurrentWindow
-	s.CurrentWindow = (s.CurrentWindow + 1) % len(s.Windows)
+	return s.Windows[idx]
 }
 
-// PrevWindow switches to the previous window
-func (s *Session) PrevWindow() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if len(s.Windows) == 0 {
-		return
+// windowEnv returns the environment overrides for a window's program.
+func windowEnv(config *Config) map[string]string {
+	envOverrides := make(map[string]string)
+	if config != nil {
+		if config.Term != "" {
+			envOverrides["TERM"] = config.Term
+		} else {
+			envOverrides["TERM"] = "screen"
+		}
+		if config.AllCapabilities {
+			if envOverrides["TERM"] == "screen" {
+				envOverrides["TERM"] = "screen-256color"
+			}
+		}
+	} else {
+		envOverrides["TERM"] = "screen"
 	}
-	s.LastWindow = s.CurrentWindow
-	s.CurrentWindow = (s.CurrentWindow + len(s.Windows) - 1) % len(s.Windows)
+	return envOverrides
+}
+
+// RespawnWindow reruns the program of a dead window in place, keeping its
+// number, title and screen.
+func (s *Session) RespawnWindow(win *Window, config *Config) error {
+	if win.IsGroup() {
+		return fmt.Errorf("window %s is a group", win.Number)
+	}
+	if win.IsAlive() {
+		return fmt.Errorf("window %s is still running", win.Number)
+	}
+	cmdPath, cmdArgs := win.Command()
+	ptyProc, err := pty.StartWithEnv(cmdPath, cmdArgs, windowEnv(config))
+	if err != nil {
+		return fmt.Errorf("failed to start PTY: %w", err)
+	}
+	win.SetPTYProcess(ptyProc)
+	s.SaveIfOpen()
+	return nil
+}
+
+// SwitchToWindow switches to a window by number
+func (s *Session) SwitchToWindow(number string) error {
+	return s.View().SwitchTo(number)
+}
+
+// NextWindow switches to the next window in the group of the current
+// window
+func (s *Session) NextWindow() {
+	s.View().Next()
+}
+
+// PrevWindow switches to the previous window in the group of the current
+// window
+func (s *Session) PrevWindow() {
+	s.View().Prev()
+}
+
+// NextAliveWindow switches to the next window with a running program, in
+// the group of the current window if there is one there.
+func (s *Session) NextAliveWindow() {
+	s.View().NextAlive()
 }
 
 // ToggleLastWindow switches to the last window
 func (s *Session) ToggleLastWindow() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if len(s.Windows) == 0 {
-		return
-	}
-	s.CurrentWindow, s.LastWindow = s.LastWindow, s.CurrentWindow
+	s.View().ToggleLast()
 }
 
 // KillCurrentWindow kills the current window
 func (s *Session) KillCurrentWindow() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if len(s.Windows) == 0 || s.CurrentWindow < 0 || s.CurrentWindow >= len(s.Windows) {
+	win := s.GetCurrentWindow()
+	if win == nil {
 		return fmt.Errorf("no current window")
 	}
+	return s.KillWindow(win)
+}
+
+// KillWindow kills a window of the session and removes it. The programs of
+// the window get SIGHUP, SIGTERM and then SIGKILL, see KillGrace.
+func (s *Session) KillWindow(win *Window) error {
+	s.mu.RLock()
+	idx := s.windowIndexLocked(win)
+	count := len(s.Windows)
+	s.mu.RUnlock()
+	if idx < 0 {
+		return fmt.Errorf("no such window")
+	}
 
 	// Don't allow killing the last window
-	if len(s.Windows) == 1 {
+	if count == 1 {
 		return fmt.Errorf("cannot kill the last window")
 	}
 
-	win := s.Windows[s.CurrentWindow]
-	if err := win.Kill(); err != nil {
+	if err := win.Kill(s.KillGraceDuration()); err != nil {
 		return err
 	}
 
-	// Remove window from list
-	s.Windows = append(s.Windows[:s.CurrentWindow], s.Windows[s.CurrentWindow+1:]...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if idx := s.windowIndexLocked(win); idx >= 0 {
+		s.removeWindowLocked(idx)
+	}
+	return nil
+}
 
-	// Renumber windows
+// HasWindow reports whether win is one of the windows of the session.
+func (s *Session) HasWindow(win *Window) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.windowIndexLocked(win) >= 0
+}
+
+// windowIndexLocked returns the index of win in the window list, or -1.
+func (s *Session) windowIndexLocked(win *Window) int {
 	for i, w := range s.Windows {
-		w.ID = i
-		w.Number = windowNumberToString(i)
+		if w == win {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeWindowLocked removes the window at index idx from the list.
+func (s *Session) removeWindowLocked(idx int) {
+	// The other windows keep their numbers; those of a removed group move
+	// to its group
+	removed := s.Windows[idx]
+	s.Windows = append(s.Windows[:idx], s.Windows[idx+1:]...)
+	if removed.IsGroup() {
+		for _, w := range s.Windows {
+			if w.Group != nil && *w.Group == removed.ID {
+				w.setGroup(removed.Group)
+			}
+		}
 	}
 
-	// Adjust current window index
+	// Keep the current and last window where they were
+	if s.CurrentWindow > idx {
+		s.CurrentWindow--
+	}
+	if s.LastWindow > idx {
+		s.LastWindow--
+	}
 	if s.CurrentWindow >= len(s.Windows) {
 		s.CurrentWindow = len(s.Windows) - 1
 	}
 	if s.LastWindow >= len(s.Windows) {
 		s.LastWindow = len(s.Windows) - 1
 	}
-
-	return nil
 }
 
 // SetWindowTitle sets the title of the current window
@@ -810,11 +1052,60 @@ func (s *Session) SetWindowTitle(title string) {
 	defer s.mu.Unlock()
 	if len(s.Windows) > 0 && s.CurrentWindow < len(s.Windows) {
 		if win := s.Windows[s.CurrentWindow]; win != nil {
-			win.Title = title
+			win.setTitle(title)
 		}
 	}
 }
 
+// CloseWindow removes a dead window from the session, even the last one,
+// which ends the session. It reports the window like an exit to the
+// window exit handler, which checks whether the session is still active.
+func (s *Session) CloseWindow(win *Window) error {
+	if win.IsAlive() {
+		return fmt.Errorf("window %s is still running", win.Number)
+	}
+	s.mu.Lock()
+	idx := -1
+	for i, w := range s.Windows {
+		if w == win {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		s.mu.Unlock()
+		return fmt.Errorf("no such window")
+	}
+	s.removeWindowLocked(idx)
+	s.mu.Unlock()
+	s.windowExited(win)
+	return nil
+}
+
+// Zombie returns the keys closing and respawning dead windows, or ""
+// if dead windows go away.
+func (s *Session) Zombie() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ZombieKeys
+}
+
+// SetZombie sets the keys closing and respawning dead windows; "" lets
+// dead windows go away.
+func (s *Session) SetZombie(keys string) {
+	s.mu.Lock()
+	s.ZombieKeys = keys
+	s.mu.Unlock()
+	s.SaveIfOpen()
+}
+
+// SetTitleOf sets the title of a window of the session
+func (s *Session) SetTitleOf(win *Window, title string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	win.setTitle(title)
+}
+
 // Rename renames the session
 func (s *Session) Rename(newID string) error {
 	if newID == "" {
@@ -864,18 +1155,81 @@ func (s *Session) Rename(newID string) error {
 		return fmt.Errorf("failed to rename session file: %w", err)
 	}
 
+	// Move the server socket along with the session file
+	if err := os.Rename(SocketPath(oldID), SocketPath(newID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rename session socket: %w", err)
+	}
+
 	// Save updated session
 	return s.save()
 }
 
-// ForceDetach forces a detach by clearing the PTY process reference
-// This allows the session to be reattached from another terminal
-func (s *Session) ForceDetach() {
+// SetWindowExitHandler registers fn to be called whenever the program in one
+// of the session's windows exits, and when a dead window is closed.
+func (s *Session) SetWindowExitHandler(fn func(*Window)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onWindowExit = fn
+}
+
+// windowExited records a window exit and forwards it to the registered
+// handler.
+func (s *Session) windowExited(win *Window) {
+	s.SaveIfOpen()
+	s.mu.RLock()
+	fn := s.onWindowExit
+	s.mu.RUnlock()
+	if fn != nil {
+		fn(win)
+	}
+}
+
+// SetWindowOutputHandler registers fn to be called with everything the
+// programs in the session's windows write, whether or not a display is
+// attached. bell tells whether the output rang the terminal bell.
+func (s *Session) SetWindowOutputHandler(fn func(win *Window, p []byte, bell bool)) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	// Clear the PTY process reference but keep the session alive
-	// The process continues running, we just lose the reference
-	s.PTYProcess = nil
+	s.onWindowOutput = fn
+}
+
+// windowOutput forwards window output to the registered handler.
+func (s *Session) windowOutput(win *Window, p []byte, bell bool) {
+	s.mu.RLock()
+	fn := s.onWindowOutput
+	s.mu.RUnlock()
+	if fn != nil {
+		fn(win, p, bell)
+	}
+}
+
+// IsActive reports whether the session has a window to show: one with a
+// running program or, with zombie keys set, a dead window kept around.
+// Group windows alone do not keep a session.
+func (s *Session) IsActive() bool {
+	if s.Zombie() != "" {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		for _, win := range s.Windows {
+			if !win.IsGroup() {
+				return true
+			}
+		}
+		return false
+	}
+	return s.HasAliveWindow()
+}
+
+// HasAliveWindow reports whether any window still has a running program.
+func (s *Session) HasAliveWindow() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, win := range s.Windows {
+		if win.IsAlive() {
+			return true
+		}
+	}
+	return false
 }
 
 // Save persists session to disk.
@@ -932,86 +1286,6 @@ func (s *Session) RemoveUser(username string) error {
 	return s.save()
 }
 
-// SaveLayout stores the current window index under a layout name.
-func (s *Session) SaveLayout(name string) error {
-	if name == "" {
-		return fmt.Errorf("layout name cannot be empty")
-	}
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.Layouts == nil {
-		s.Layouts = make(map[string]int)
-	}
-	s.Layouts[name] = s.CurrentWindow
-	return s.save()
-}
-
-// SelectLayout switches to the window saved under a layout name.
-func (s *Session) SelectLayout(name string) error {
-	if name == "" {
-		return fmt.Errorf("layout name cannot be empty")
-	}
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.Layouts == nil {
-		return fmt.Errorf("no layouts available")
-	}
-	idx, ok := s.Layouts[name]
-	if !ok {
-		return fmt.Errorf("layout %s not found", name)
-	}
-	if idx < 0 || idx >= len(s.Windows) {
-		return fmt.Errorf("layout %s references invalid window", name)
-	}
-	s.LastWindow = s.CurrentWindow
-	s.CurrentWindow = idx
-	return s.save()
-}
-
-// ListLayouts returns layout names.
-func (s *Session) ListLayouts() []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	if len(s.Layouts) == 0 {
-		return nil
-	}
-	names := make([]string, 0, len(s.Layouts))
-	for name := range s.Layouts {
-		names = append(names, name)
-	}
-	return names
-}
-
-// ExecuteCommand executes a command in a session
-func ExecuteCommand(sess *Session, command string) error {
-	// Parse command and execute it
-	// For now, support basic commands like "quit", "detach", etc.
-	parts := strings.Fields(command)
-	if len(parts) == 0 {
-		return fmt.Errorf("empty command")
-	}
-
-	cmd := parts[0]
-
-	switch cmd {
-	case "quit", "exit":
-		// Quit the session
-		if sess.PTYProcess != nil {
-			_ = sess.PTYProcess.Kill()
-		}
-		return Delete(sess.ID)
-	case "detach":
-		// Detach (already handled by Ctrl+A, d)
-		return nil
-	case "log":
-		// Toggle logging (would need to implement)
-		return nil
-	default:
-		// Unknown command
-		return fmt.Errorf("unknown command: %s", cmd)
-	}
-}
-
 func isValidSessionChar(r rune) bool {
 	return (r >= 'a' && r <= 'z') ||
 		(r >= 'A' && r <= 'Z') ||
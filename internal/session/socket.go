@@ -0,0 +1,30 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// maxSocketPathLen is the longest Unix socket path we create. sun_path is
+// 104 bytes on BSD/macOS and 108 on Linux, including the terminating NUL.
+const maxSocketPathLen = 100
+
+// SocketPath returns the path of the Unix socket served by the session's
+// server process. Sockets live next to the session files; when that path
+// would be too long for a Unix socket, a short name under the temp
+// directory derived from the full path is used instead.
+func SocketPath(id string) string {
+	path := filepath.Join(sessionsDir, id+".sock")
+	if len(path) <= maxSocketPathLen {
+		return path
+	}
+	sum := sha256.Sum256([]byte(path))
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("sgreen-%d", os.Getuid()))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: failed to create socket directory: %v\n", err)
+	}
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".sock")
+}
@@ -0,0 +1,175 @@
+package session
+
+import "fmt"
+
+// View is where one display of a session is: its current and last window.
+// Each display has a view of its own, so that the users of a multiuser
+// session switch windows independently, as in GNU screen. The session has
+// a view too, kept in CurrentWindow and LastWindow: commands sent without a
+// display act on its current window, and new displays start there. A
+// display switching windows moves the view of the session along.
+type View struct {
+	sess *Session
+	own  bool // The view of the session itself
+	// Windows of a display's view; nil once they are gone
+	current, last *Window
+}
+
+// NewView returns a view for a display, starting at the current and last
+// window of the session.
+func (s *Session) NewView() *View {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &View{sess: s, current: s.currentLocked(), last: s.windowAtLocked(s.LastWindow)}
+}
+
+// View returns the view of the session itself.
+func (s *Session) View() *View {
+	return &View{sess: s, own: true}
+}
+
+// Session returns the session the view is of.
+func (v *View) Session() *Session {
+	return v.sess
+}
+
+// Current returns the current window of the view. A display whose window
+// is gone moves to the current window of the session.
+func (v *View) Current() *Window {
+	v.sess.mu.Lock()
+	defer v.sess.mu.Unlock()
+	return v.currentLocked()
+}
+
+func (v *View) currentLocked() *Window {
+	s := v.sess
+	if v.own {
+		return s.currentLocked()
+	}
+	if v.current == nil || s.windowIndexLocked(v.current) < 0 {
+		v.current = s.currentLocked()
+	}
+	return v.current
+}
+
+// Last returns the window the view showed before the current one, or nil.
+func (v *View) Last() *Window {
+	v.sess.mu.Lock()
+	defer v.sess.mu.Unlock()
+	return v.lastLocked()
+}
+
+func (v *View) lastLocked() *Window {
+	s := v.sess
+	if v.own {
+		return s.windowAtLocked(s.LastWindow)
+	}
+	if v.last != nil && s.windowIndexLocked(v.last) < 0 {
+		v.last = nil
+	}
+	return v.last
+}
+
+// Switch makes win the current window of the view.
+func (v *View) Switch(win *Window) {
+	v.sess.mu.Lock()
+	defer v.sess.mu.Unlock()
+	v.switchLocked(win)
+}
+
+func (v *View) switchLocked(win *Window) {
+	s := v.sess
+	cur := v.currentLocked()
+	if win == nil || win == cur || s.windowIndexLocked(win) < 0 {
+		return
+	}
+	v.current, v.last = win, cur
+	s.CurrentWindow = s.windowIndexLocked(win)
+	if cur != nil {
+		s.LastWindow = s.windowIndexLocked(cur)
+	}
+}
+
+// SwitchTo switches the view to the window named by number or title.
+func (v *View) SwitchTo(name string) error {
+	win := v.sess.FindWindow(name)
+	if win == nil {
+		return fmt.Errorf("window %s not found", name)
+	}
+	v.Switch(win)
+	return nil
+}
+
+// Next switches to the next window in the group of the current window.
+func (v *View) Next() {
+	v.cycle(1, false)
+}
+
+// Prev switches to the previous window in the group of the current window.
+func (v *View) Prev() {
+	v.cycle(-1, false)
+}
+
+// NextAlive switches to the next window with a running program, in the
+// group of the current window if there is one there.
+func (v *View) NextAlive() {
+	v.cycle(1, true)
+}
+
+// cycle switches to the window step places on in the group of the current
+// window, or with alive to the nearest window in that direction with a
+// running program, anywhere if none in the group has one.
+func (v *View) cycle(step int, alive bool) {
+	s := v.sess
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.Windows)
+	cur := v.currentLocked()
+	at := s.windowIndexLocked(cur)
+	var group *int
+	if cur != nil {
+		group = cur.Group
+	}
+	for _, anyGroup := range []bool{false, alive} {
+		for i := 1; i < n; i++ {
+			w := s.Windows[((at+step*i)%n+n)%n]
+			if (anyGroup || sameGroup(w.Group, group)) && (!alive || w.IsAlive()) {
+				v.switchLocked(w)
+				return
+			}
+		}
+	}
+}
+
+// ToggleLast switches to the window the view showed before.
+func (v *View) ToggleLast() {
+	v.sess.mu.Lock()
+	defer v.sess.mu.Unlock()
+	v.switchLocked(v.lastLocked())
+}
+
+// CreateWindowAt creates a window like Session.CreateWindowAt, in the group
+// of the view, and makes it the current window of the view.
+func (v *View) CreateWindowAt(number int, cmdPath string, args []string, config *Config) (*Window, error) {
+	return v.sess.createWindow(v, number, cmdPath, args, config)
+}
+
+// CreateGroup creates a group window like Session.CreateGroup, in the group
+// of the view, and makes it the current window of the view.
+func (v *View) CreateGroup(number int, title string) (*Window, error) {
+	return v.sess.createGroup(v, number, title)
+}
+
+// groupLocked returns the group new windows of the view join: the current
+// window if it is a group, or else the group of the current window.
+func (v *View) groupLocked() *int {
+	cur := v.currentLocked()
+	if cur == nil {
+		return nil
+	}
+	if cur.IsGroup() {
+		id := cur.ID
+		return &id
+	}
+	return cur.Group
+}
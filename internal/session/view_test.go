@@ -0,0 +1,42 @@
+package session
+
+import "testing"
+
+func TestViewsSwitchIndependently(t *testing.T) {
+	s := &Session{}
+	for i := 0; i < 3; i++ {
+		w := &Window{}
+		w.setNumber(i)
+		s.Windows = append(s.Windows, w)
+	}
+	zero, one, two := s.Windows[0], s.Windows[1], s.Windows[2]
+
+	// New views start at the current window of the session
+	a, b := s.NewView(), s.NewView()
+	b.Next()
+	if a.Current() != zero || b.Current() != one {
+		t.Fatalf("views at %s and %s, want 0 and 1", a.Current().Number, b.Current().Number)
+	}
+	// The session follows the display switching last
+	if s.GetCurrentWindow() != one {
+		t.Fatalf("session at %s, want 1", s.GetCurrentWindow().Number)
+	}
+	if err := a.SwitchTo("2"); err != nil {
+		t.Fatalf("SwitchTo: %v", err)
+	}
+	b.ToggleLast()
+	if a.Current() != two || a.Last() != zero || b.Current() != zero || b.Last() != one {
+		t.Fatalf("views at %s and %s, want 2 and 0", a.Current().Number, b.Current().Number)
+	}
+	if s.NewView().Current() != zero {
+		t.Fatalf("a new view should start at window 0")
+	}
+
+	// A view whose window is gone moves to the current window of the session
+	if err := s.KillWindow(two); err != nil {
+		t.Fatalf("KillWindow: %v", err)
+	}
+	if a.Current() != s.GetCurrentWindow() {
+		t.Fatalf("view of the killed window at %s, want %s", a.Current().Number, s.GetCurrentWindow().Number)
+	}
+}
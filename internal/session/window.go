@@ -1,13 +1,24 @@
 package session
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/inoki/sgreen/internal/pty"
+	"github.com/inoki/sgreen/internal/vt"
 )
 
+// defaultScrollbackSize is the history kept for windows without a
+// configured scrollback size
+const defaultScrollbackSize = 1000
+
 // Window represents a window within a session
 type Window struct {
 	ID             int       `json:"id"`       // Window number (0-9, then 10-35 for A-Z)
@@ -20,10 +31,24 @@ type Window struct {
 	CreatedAt      time.Time `json:"created_at"`
 	ScrollbackSize int       `json:"scrollback_size,omitempty"` // Scrollback buffer size
 	Encoding       string    `json:"encoding,omitempty"`        // Window encoding (e.g., UTF-8, ISO-8859-1)
+	ExitStatus     *int      `json:"exit_status,omitempty"`     // Exit status of the program, once it has exited
+	EndedAt        time.Time `json:"ended_at,omitzero"`         // When the program exited
+	Type           string    `json:"type,omitempty"`            // WindowTypeGroup for group windows
+	Group          *int      `json:"group,omitempty"`           // Number of the group window holding the window
 
 	// Runtime fields (not persisted)
 	PTYProcess *pty.PTYProcess `json:"-"`
+	ptyClosed  bool            // PTYProcess has exited and its PTY is closed
 	mu         sync.RWMutex    `json:"-"`
+
+	// Output fan-out, fed by the window's output pump
+	outMu      sync.Mutex
+	screen     *vt.Screen
+	outputs    map[int]io.Writer
+	nextOutput int
+	exited     chan struct{}
+	onExit     func(*Window)
+	onOutput   func(w *Window, p []byte, bell bool)
 }
 
 // GetPTYProcess returns the PTY process for this window
@@ -36,22 +61,267 @@ func (w *Window) GetPTYProcess() *pty.PTYProcess {
 // SetPTYProcess sets the PTY process for this window
 func (w *Window) SetPTYProcess(ptyProc *pty.PTYProcess) {
 	w.mu.Lock()
-	defer w.mu.Unlock()
 	w.PTYProcess = ptyProc
+	w.ptyClosed = false
 	if ptyProc != nil && ptyProc.Cmd != nil && ptyProc.Cmd.Process != nil {
 		w.Pid = ptyProc.Cmd.Process.Pid
 		w.PtsPath = ptyProc.PtsPath
+		w.ExitStatus = nil
+		w.EndedAt = time.Time{}
 	}
+	w.mu.Unlock()
+	if ptyProc != nil {
+		w.startOutputPump(ptyProc)
+	}
+}
+
+// Command returns the program the window runs and its arguments.
+func (w *Window) Command() (cmdPath string, args []string) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.CmdPath, w.CmdArgs
 }
 
-// Kill kills the window's process
-func (w *Window) Kill() error {
+// SetCommand sets the program the window runs and its arguments.
+func (w *Window) SetCommand(cmdPath string, args []string) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	if w.PTYProcess != nil {
-		return w.PTYProcess.Kill()
+	w.CmdPath = cmdPath
+	w.CmdArgs = args
+}
+
+// Screen returns the terminal emulator holding the window's screen
+// contents and history.
+func (w *Window) Screen() *vt.Screen {
+	w.outMu.Lock()
+	defer w.outMu.Unlock()
+	return w.screenLocked()
+}
+
+func (w *Window) screenLocked() *vt.Screen {
+	if w.screen == nil {
+		scrollback := w.ScrollbackSize
+		if scrollback <= 0 {
+			scrollback = defaultScrollbackSize
+		}
+		w.screen = vt.NewScreen(80, 24, scrollback)
+	}
+	return w.screen
+}
+
+// Resize sets the size of the window's terminal: the PTY and the screen.
+// Once the program has exited only the screen is resized.
+func (w *Window) Resize(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid window size %dx%d", width, height)
+	}
+	w.Screen().Resize(width, height)
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.ptyClosed {
+		return nil
+	}
+	if w.PTYProcess == nil {
+		return fmt.Errorf("PTY process not available")
+	}
+	return w.PTYProcess.SetSize(uint16(height), uint16(width))
+}
+
+// AddOutput registers out to receive everything the window's program writes
+// until remove is called. The returned channel is closed when the program's
+// PTY reaches end of file.
+func (w *Window) AddOutput(out io.Writer) (exited <-chan struct{}, remove func()) {
+	w.outMu.Lock()
+	defer w.outMu.Unlock()
+	return w.addOutputLocked(out)
+}
+
+// AttachOutput is like AddOutput, but also returns a repaint of the window's
+// screen taken together with the registration: writing repaint and then
+// everything out receives to a terminal reproduces the window exactly.
+func (w *Window) AttachOutput(out io.Writer) (repaint []byte, exited <-chan struct{}, remove func()) {
+	w.outMu.Lock()
+	defer w.outMu.Unlock()
+	var buf bytes.Buffer
+	_ = w.screenLocked().Render(&buf)
+	exited, remove = w.addOutputLocked(out)
+	return buf.Bytes(), exited, remove
+}
+
+func (w *Window) addOutputLocked(out io.Writer) (exited <-chan struct{}, remove func()) {
+	if w.outputs == nil {
+		w.outputs = make(map[int]io.Writer)
+	}
+	id := w.nextOutput
+	w.nextOutput++
+	w.outputs[id] = out
+	return w.exitedLocked(), func() {
+		w.outMu.Lock()
+		defer w.outMu.Unlock()
+		delete(w.outputs, id)
+	}
+}
+
+// Exited returns a channel that is closed when the window's program exits.
+// If the program is replaced meanwhile, as by exec, the channel is closed
+// without the window having exited.
+func (w *Window) Exited() <-chan struct{} {
+	w.outMu.Lock()
+	defer w.outMu.Unlock()
+	return w.exitedLocked()
+}
+
+func (w *Window) exitedLocked() chan struct{} {
+	if w.exited == nil {
+		// No pump is running (e.g. a window loaded from disk)
+		w.exited = make(chan struct{})
+		close(w.exited)
+	}
+	return w.exited
+}
+
+// ExitState returns the exit status of the window's program and when it
+// exited. ok is false while the program runs.
+func (w *Window) ExitState() (status int, endedAt time.Time, ok bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.ExitStatus == nil {
+		return 0, time.Time{}, false
 	}
-	return nil
+	return *w.ExitStatus, w.EndedAt, true
+}
+
+// MarshalJSON encodes the window under its lock, as the output pump updates
+// the exit fields while the session is being saved.
+func (w *Window) MarshalJSON() ([]byte, error) {
+	type window Window // Without the MarshalJSON method
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return json.Marshal((*window)(w))
+}
+
+// exitCode returns the exit status of a process the way shells report it:
+// 128 plus the signal number for a process killed by a signal.
+func exitCode(state *os.ProcessState) int {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return state.ExitCode()
+}
+
+// startOutputPump reads the PTY of ptyProc until its program exits,
+// forwarding output to the registered writers. Reading continuously keeps
+// programs from blocking on a full PTY while nobody is attached.
+func (w *Window) startOutputPump(ptyProc *pty.PTYProcess) {
+	exited := make(chan struct{})
+	w.outMu.Lock()
+	w.exited = exited
+	width, height := w.screenLocked().Size()
+	w.outMu.Unlock()
+	// Programs see the size of the screen until a display resizes it
+	_ = ptyProc.SetSize(uint16(height), uint16(width))
+
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := ptyProc.Pty.Read(buf)
+			if n > 0 {
+				w.writeOutput(buf[:n])
+			}
+			if err != nil {
+				break
+			}
+		}
+		_ = ptyProc.Wait()
+
+		// Close under the lock so that Resize never sizes a closed PTY, and
+		// only report the exit if the process was not replaced (e.g. by exec)
+		w.mu.Lock()
+		_ = ptyProc.Close()
+		current := w.PTYProcess == ptyProc
+		if current {
+			w.ptyClosed = true
+		}
+		if current && ptyProc.Cmd != nil && ptyProc.Cmd.ProcessState != nil {
+			status := exitCode(ptyProc.Cmd.ProcessState)
+			w.ExitStatus = &status
+			w.EndedAt = time.Now()
+		}
+		onExit := w.onExit
+		w.mu.Unlock()
+		close(exited)
+		if current && onExit != nil {
+			onExit(w)
+		}
+	}()
+}
+
+// writeOutput feeds p to the screen and copies it to every registered
+// output, then reports it to the output handler. Write errors are ignored so
+// that one broken display does not stall the others.
+func (w *Window) writeOutput(p []byte) {
+	w.outMu.Lock()
+	bells := w.screen.Bells()
+	_, _ = w.screen.Write(p)
+	bell := w.screen.Bells() != bells
+	outputs := make([]io.Writer, 0, len(w.outputs))
+	for _, out := range w.outputs {
+		outputs = append(outputs, out)
+	}
+	w.outMu.Unlock()
+	for _, out := range outputs {
+		_, _ = out.Write(p)
+	}
+
+	w.mu.RLock()
+	onOutput := w.onOutput
+	w.mu.RUnlock()
+	if onOutput != nil {
+		onOutput(w, p, bell)
+	}
+}
+
+// Kill ends the window's process group with SIGHUP, SIGTERM and SIGKILL,
+// grace apart, and waits until it is gone. Killing a dead window is not an
+// error.
+func (w *Window) Kill(grace time.Duration) error {
+	ptyProc := w.GetPTYProcess()
+	if ptyProc == nil {
+		return nil
+	}
+	return ptyProc.Terminate(grace)
+}
+
+// Signal sends sig to the foreground job of the window.
+func (w *Window) Signal(sig syscall.Signal) error {
+	ptyProc := w.GetPTYProcess()
+	if ptyProc == nil {
+		return fmt.Errorf("window %s has no program", w.Number)
+	}
+	return ptyProc.SignalForeground(sig)
+}
+
+// Ident returns the number of the window, as ID and display string, and
+// its title.
+func (w *Window) Ident() (id int, number, title string) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.ID, w.Number, w.Title
+}
+
+// setTitle sets the title of the window.
+func (w *Window) setTitle(title string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.Title = title
+}
+
+// setNumber sets the window number, as ID and display string.
+func (w *Window) setNumber(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ID = n
+	w.Number = windowNumberToString(n)
 }
 
 // IsAlive checks if the window's process is alive
@@ -64,15 +334,17 @@ func (w *Window) IsAlive() bool {
 	return w.PTYProcess.IsAlive()
 }
 
-// windowNumberToString converts a window ID (0-35) to display string (0-9, A-Z)
+// windowNumberToString converts a window ID to its display string: 0-9,
+// then A-Z for 10-35, and the number itself from 36 on
 func windowNumberToString(id int) string {
-	if id < 10 {
-		return fmt.Sprintf("%d", id)
+	if id < 10 || id >= DefaultMaxWindows {
+		return strconv.Itoa(id)
 	}
 	return string(rune('A' + (id - 10)))
 }
 
-// windowStringToNumber converts a display string (0-9, A-Z) to window ID
+// windowStringToNumber converts a display string (0-9, A-Z) or a window
+// number to a window ID
 func windowStringToNumber(s string) (int, error) {
 	if len(s) == 0 {
 		return -1, fmt.Errorf("empty window number")
@@ -93,9 +365,7 @@ func windowStringToNumber(s string) (int, error) {
 	}
 
 	// Try to parse as integer
-	var id int
-	_, err := fmt.Sscanf(s, "%d", &id)
-	if err == nil && id >= 0 && id <= 35 {
+	if id, err := strconv.Atoi(s); err == nil && id >= 0 && id < MaxMaxWindows {
 		return id, nil
 	}
 
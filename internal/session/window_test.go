@@ -1,6 +1,14 @@
 package session
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/inoki/sgreen/internal/pty"
+	"github.com/inoki/sgreen/internal/vt"
+)
 
 func TestWindowNumberConversion(t *testing.T) {
 	cases := []struct {
@@ -12,6 +20,8 @@ func TestWindowNumberConversion(t *testing.T) {
 		{10, "A"},
 		{11, "B"},
 		{35, "Z"},
+		{36, "36"},
+		{120, "120"},
 	}
 
 	for _, c := range cases {
@@ -29,6 +39,86 @@ func TestWindowNumberConversion(t *testing.T) {
 	}
 }
 
+func TestFindWindow(t *testing.T) {
+	s := &Session{Windows: []*Window{
+		{ID: 0, Number: "0", Title: "shell"},
+		{ID: 1, Number: "1", Title: "2"},
+		{ID: 2, Number: "2", Title: "build"},
+	}}
+	cases := []struct {
+		name string
+		want *Window
+	}{
+		{"0", s.Windows[0]},
+		{"build", s.Windows[2]},
+		{"2", s.Windows[2]}, // Numbers win over titles
+		{"logs", nil},
+		{"7", nil},
+	}
+	for _, c := range cases {
+		if got := s.FindWindow(c.name); got != c.want {
+			t.Fatalf("FindWindow(%q) = %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+// windowNumbers returns the numbers of the session's windows in list order.
+func windowNumbers(s *Session) string {
+	numbers := ""
+	for _, win := range s.Windows {
+		numbers += win.Number
+	}
+	return numbers
+}
+
+func TestWindowNumbersStayStable(t *testing.T) {
+	s := &Session{}
+	for _, n := range []int{0, 1, 2, 3} {
+		win := &Window{}
+		win.setNumber(n)
+		s.Windows = append(s.Windows, win)
+	}
+	s.CurrentWindow = 3
+
+	if err := s.KillWindow(s.Windows[1]); err != nil {
+		t.Fatalf("KillWindow error: %v", err)
+	}
+	if got := windowNumbers(s); got != "023" {
+		t.Fatalf("numbers after killing window 1 = %s, want 023", got)
+	}
+	if got := s.GetCurrentWindow().Number; got != "3" {
+		t.Fatalf("current window after killing window 1 = %s, want 3", got)
+	}
+
+	// New windows fill the gap, or take the next free number from the one asked for
+	if n := s.freeNumberLocked(0); n != 1 {
+		t.Fatalf("lowest free number = %d, want 1", n)
+	}
+	if n := s.freeNumberLocked(2); n != 4 {
+		t.Fatalf("free number from 2 = %d, want 4", n)
+	}
+	win := &Window{}
+	win.setNumber(1)
+	if idx := s.insertWindowLocked(win); idx != 1 || windowNumbers(s) != "0123" {
+		t.Fatalf("inserting window 1: index %d, numbers %s", idx, windowNumbers(s))
+	}
+	if got := s.GetCurrentWindow().Number; got != "3" {
+		t.Fatalf("current window after inserting window 1 = %s, want 3", got)
+	}
+
+	// Taking a used number swaps, a free one moves
+	current := s.GetCurrentWindow()
+	if err := s.SetWindowNumber(current, 0); err != nil {
+		t.Fatalf("SetWindowNumber error: %v", err)
+	}
+	if s.Windows[0] != current || s.Windows[3].Number != "3" || s.GetCurrentWindow() != current {
+		t.Fatalf("after swapping window 3 with 0: numbers %s, current %s", windowNumbers(s), s.GetCurrentWindow().Number)
+	}
+	if err := s.SetWindowNumber(current, 7); err != nil || windowNumbers(s) != "1237" {
+		t.Fatalf("after moving window 0 to 7: numbers %s, error %v", windowNumbers(s), err)
+	}
+}
+
 func TestDetectEncodingFromLocale(t *testing.T) {
 	t.Setenv("LC_ALL", "en_US.ISO-8859-1")
 	if got := detectEncodingFromLocale(); got != "ISO-8859-1" {
@@ -40,3 +130,71 @@ func TestDetectEncodingFromLocale(t *testing.T) {
 		t.Fatalf("detectEncodingFromLocale() = %s, want UTF-8", got)
 	}
 }
+
+func TestAttachOutputRepaintsScreen(t *testing.T) {
+	w := &Window{}
+	w.Screen().Resize(20, 3)
+	w.writeOutput([]byte("\x1b[1mone\x1b[0m\r\n"))
+
+	var out bytes.Buffer
+	repaint, _, remove := w.AttachOutput(&out)
+	w.writeOutput([]byte("two"))
+	remove()
+	w.writeOutput([]byte(" three"))
+
+	// A terminal fed the repaint and the output shows the window
+	term := vt.NewScreen(20, 3, 0)
+	_, _ = term.Write(repaint)
+	_, _ = term.Write(out.Bytes())
+	lines := term.Lines()
+	if lines[0] != "one" || lines[1] != "two" {
+		t.Fatalf("terminal lines = %q, want one, two", lines)
+	}
+	if c := term.Cell(0, 0); c.Style.Attr != vt.AttrBold {
+		t.Fatalf("repainted cell style = %+v, want bold", c.Style)
+	}
+	if x, y := term.Cursor(); x != 3 || y != 1 {
+		t.Fatalf("terminal cursor = %d,%d, want 3,1", x, y)
+	}
+}
+
+func TestResizeAfterExit(t *testing.T) {
+	ptyProc, err := pty.Start("/bin/sh", []string{"-c", "exit 3"})
+	if err != nil {
+		t.Skipf("cannot start a program on a PTY: %v", err)
+	}
+	w := &Window{}
+	w.SetPTYProcess(ptyProc)
+	select {
+	case <-w.Exited():
+	case <-time.After(5 * time.Second):
+		t.Fatal("window program did not exit")
+	}
+
+	// The PTY is closed: only the screen follows the new size
+	if err := w.Resize(40, 10); err != nil {
+		t.Fatalf("Resize after exit: %v", err)
+	}
+	if width, height := w.Screen().Size(); width != 40 || height != 10 {
+		t.Fatalf("screen size after exit = %dx%d, want 40x10", width, height)
+	}
+	if status, _, ok := w.ExitState(); !ok || status != 3 {
+		t.Fatalf("ExitState = %d, %v, want 3, true", status, ok)
+	}
+}
+
+func TestWindowJSONKeepsExitState(t *testing.T) {
+	status := 3
+	w := &Window{ID: 1, Number: "1", Title: "build", ExitStatus: &status}
+	data, err := json.Marshal(w)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	var back Window
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if back.Number != "1" || back.Title != "build" || back.ExitStatus == nil || *back.ExitStatus != 3 {
+		t.Fatalf("window after a round trip: %s", data)
+	}
+}
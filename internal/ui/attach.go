@@ -1,22 +1,15 @@
-//go:build !windows
-// +build !windows
-
 package ui
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
-	"os/signal"
-	"path/filepath"
 	"sync"
 	"time"
 
-	"golang.org/x/sys/unix"
-	"golang.org/x/term"
-
 	"github.com/inoki/sgreen/internal/pty"
 	"github.com/inoki/sgreen/internal/session"
 )
@@ -24,6 +17,9 @@ import (
 var (
 	// ErrDetach is returned when the user detaches from a session
 	ErrDetach = errors.New("detached from session")
+	// ErrPowerDetach is returned when the user power detaches from a
+	// session, which also hangs up the client. It matches ErrDetach.
+	ErrPowerDetach = fmt.Errorf("power %w", ErrDetach)
 )
 
 // ErrWindowCommand is returned when a window command is detected
@@ -37,139 +33,104 @@ func (e *ErrWindowCommand) Error() string {
 	return fmt.Sprintf("window command: %s", e.Command)
 }
 
-// Attach attaches the current terminal to a session
-func Attach(in *os.File, out *os.File, errOut *os.File, sess *session.Session) error {
-	return AttachWithConfig(in, out, errOut, sess, DefaultAttachConfig())
+// Attach runs the UI for a display attached to a session
+func Attach(d *Display, sess *session.Session) error {
+	return AttachWithConfig(d, sess, DefaultAttachConfig())
 }
 
-// AttachWithConfig attaches the current terminal to a session with configuration
-func AttachWithConfig(in *os.File, out *os.File, errOut *os.File, sess *session.Session, config *AttachConfig) error {
-	// In multiuser mode, allow attaching even if PTY is not directly available
-	// Try to get PTY from current window instead
-	var ptyProc *pty.PTYProcess
-	if config.Multiuser {
-		// Multiuser mode: try to get PTY from current window
-		if win := sess.GetCurrentWindow(); win != nil {
-			ptyProc = win.GetPTYProcess()
-		}
+// AttachWithConfig runs the UI for a display attached to a session with
+// configuration. It returns ErrDetach when the display detaches or hangs up,
+// and nil once the last window has exited.
+func AttachWithConfig(d *Display, sess *session.Session, config *AttachConfig) error {
+	win := d.viewOf(sess).Current()
+	if win == nil || (!win.IsGroup() && win.GetPTYProcess() == nil) {
+		return errors.New("PTY process not available")
 	}
 
-	// Fallback to session PTY
-	if ptyProc == nil {
-		ptyProc = sess.GetPTYProcess()
+	// Show startup message if enabled
+	if config.StartupMessage {
+		ShowStartupMessage(d, sess.ID, len(sess.Windows))
+		// Wait a bit for user to see the message
+		time.Sleep(1 * time.Second)
 	}
 
-	if ptyProc == nil {
-		return errors.New("PTY process not available")
+	// Show the layout shown last, and keep the regions in it on detach
+	if l := sess.LayoutNumbered(sess.LastLayoutNumber()); l != nil {
+		_ = showLayout(d, sess, l)
 	}
+	defer func() { _ = saveLayout(d, sess, false) }()
+
+	// Main attach loop - handles window switching
+	return attachLoop(d, sess, config)
+}
 
+// SetupTerminal enables the terminal modes sgreen relies on for the
+// terminal behind out, and returns a function restoring them.
+func SetupTerminal(out io.Writer) (restore func()) {
 	// Detect terminal capabilities and enable features when supported
 	caps := DetectTerminalCapabilities()
 	if caps.SupportsAltScreen {
 		enableAltScreen(out)
-		defer disableAltScreen(out)
 	}
 	if caps.SupportsBracketedPaste {
 		enableBracketedPaste(out)
-		defer disableBracketedPaste(out)
 	}
 	// Mouse tracking is intentionally disabled: we don't parse mouse reports yet,
 	// and enabling it causes raw click bytes to appear in the session.
-
-	// Show startup message if enabled
-	if config.StartupMessage {
-		ShowStartupMessage(out, sess.ID, len(sess.Windows))
-		// Wait a bit for user to see the message
-		time.Sleep(1 * time.Second)
+	return func() {
+		if caps.SupportsBracketedPaste {
+			disableBracketedPaste(out)
+		}
+		if caps.SupportsAltScreen {
+			disableAltScreen(out)
+		}
 	}
+}
 
-	// Save original terminal state
-	oldState, err := term.MakeRaw(int(in.Fd()))
-	if err != nil {
-		return err
-	}
-	defer func() {
-		_ = term.Restore(int(in.Fd()), oldState)
-	}()
+// attachEvent identifies what ended one pass of the attach loop
+type attachEvent int
 
-	// Main attach loop - handles window switching
-	return attachLoop(in, out, errOut, sess, config)
-}
+const (
+	eventInput attachEvent = iota
+	eventOutput
+	eventHangup
+)
 
 // attachLoop is the main loop that handles window switching
-func attachLoop(in *os.File, out *os.File, errOut *os.File, sess *session.Session, config *AttachConfig) error {
+func attachLoop(d *Display, sess *session.Session, config *AttachConfig) error {
 	debugAttach("attach: start session=%q", sess.ID)
-	// Handle window size changes (Unix only)
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, unix.SIGWINCH)
-	defer signal.Stop(sigChan)
-
-	// Handle SIGHUP for autodetach on hangup
-	hupChan := make(chan os.Signal, 1)
-	signal.Notify(hupChan, unix.SIGHUP)
-	defer signal.Stop(hupChan)
-
-	// Handle SIGTERM and SIGINT for graceful shutdown
-	termChan := make(chan os.Signal, 1)
-	signal.Notify(termChan, unix.SIGTERM, unix.SIGINT)
-	defer signal.Stop(termChan)
-
-	// Create scrollback buffers for windows (stored in a map)
-	scrollbackBuffers := make(map[int]*ScrollbackBuffer)
-
-	// Create activity and silence monitors
-	activityMonitor := NewActivityMonitor(config.ActivityMsg)
-	silenceMonitor := NewSilenceMonitor(config.SilenceMsg, time.Duration(config.SilenceTimeout)*time.Second)
-
-	// Enable monitoring if configured
-	if config.ActivityMsg != "" {
-		activityMonitor.Enable()
-	}
-	if config.SilenceMsg != "" && config.SilenceTimeout > 0 {
-		silenceMonitor.Enable()
-		silenceMonitor.StartMonitoring(func() int {
-			if win := sess.GetCurrentWindow(); win != nil {
-				return win.ID
+	view := d.viewOf(sess)
+	done := make(chan struct{})
+	defer close(done)
+
+	// Show the notifications raised by the session's windows
+	if m := d.Monitor; m != nil {
+		notify, leave := m.addDisplay(d)
+		defer leave()
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-notify:
+					showNotices(d, m, config)
+				}
 			}
-			return -1
-		})
+		}()
 	}
 
-	// Monitor activity and silence notifications
+	// Follow display size changes
 	go func() {
 		for {
 			select {
-			case winID := <-activityMonitor.GetActivityChannel():
-				// Find window by ID
-				var win *session.Window
-				for _, w := range sess.Windows {
-					if w.ID == winID {
-						win = w
-						break
-					}
-				}
-				if win != nil {
-					msg := FormatMessage(activityMonitor.GetMessage(), win)
-					ShowActivityMessage(out, msg)
-					// Show bell if configured
-					if config.Bell {
-						ShowBell(out, false)
-					} else if config.VBell {
-						ShowBell(out, true)
-					}
-				}
-			case winID := <-silenceMonitor.GetSilenceChannel():
-				// Find window by ID
-				var win *session.Window
-				for _, w := range sess.Windows {
-					if w.ID == winID {
-						win = w
-						break
-					}
-				}
-				if win != nil {
-					msg := FormatMessage(silenceMonitor.GetMessage(), win)
-					ShowSilenceMessage(out, msg)
+			case <-done:
+				return
+			case <-d.resized:
+				if c := d.regions(); c.isSplit() {
+					c.fitWindows()
+					c.markDirty()
+				} else if win := view.Current(); win != nil {
+					_ = setWindowSizeForWindow(d, win, config.AdaptSize)
 				}
 			}
 		}
@@ -177,174 +138,72 @@ func attachLoop(in *os.File, out *os.File, errOut *os.File, sess *session.Sessio
 
 	for {
 		// Get current window
-		win := sess.GetCurrentWindow()
+		win := view.Current()
 		if win == nil {
+			if !sess.IsActive() {
+				// The last dead window was closed
+				return nil
+			}
 			return fmt.Errorf("no current window")
 		}
 
 		ptyProc := win.GetPTYProcess()
-		if ptyProc == nil {
+		if ptyProc == nil && !win.IsGroup() {
 			return fmt.Errorf("current window has no PTY process")
 		}
 
-		// Get or create scrollback buffer for this window
-		scrollback, exists := scrollbackBuffers[win.ID]
-		if !exists {
-			scrollbackSize := 1000 // Default
-			if win.ScrollbackSize > 0 {
-				scrollbackSize = win.ScrollbackSize
-			} else if config.Scrollback > 0 {
-				scrollbackSize = config.Scrollback
-			}
-			scrollback = NewScrollbackBuffer(scrollbackSize)
-			scrollbackBuffers[win.ID] = scrollback
-		}
-
-		// Create output writer (with logging if enabled)
-		// Determine log directory for per-window logging
-		logDir := ""
-		if config.Logging && config.Logfile != "" {
-			logDir = filepath.Dir(config.Logfile)
-		} else if config.Logging {
-			// Default log directory
-			homeDir, _ := os.UserHomeDir()
-			if homeDir != "" {
-				logDir = filepath.Join(homeDir, ".sgreen", "logs")
-				if err := os.MkdirAll(logDir, 0755); err != nil {
-					_, _ = fmt.Fprintf(errOut, "warning: failed to create log directory: %v\n", err)
-				}
-			}
-		}
-		outputWriter := createOutputWriterForWindow(out, config, win, logDir)
-
-		// Apply encoding conversion for this window if needed
-		encodedOutput := wrapEncodingWriter(outputWriter, win.Encoding)
-
-		// Wrap output writer to also write to scrollback
-		scrollbackWriter := io.MultiWriter(encodedOutput, &scrollbackWriter{scrollback: scrollback})
-
-		// Apply output optimization if requested
-		if config.OptimalOutput {
-			scrollbackWriter = createOptimalWriter(scrollbackWriter)
-		}
-
-		// Handle flow control
-		flowControl := setupFlowControl(config.FlowControl, config.Interrupt)
-
-		// Set window size
-		if err := setWindowSizeForWindow(in, win, config.AdaptSize); err != nil {
-			_ = err
+		var event attachEvent
+		var err error
+		if d.regions().isSplit() {
+			event, err = attachRegions(d, sess, config)
+		} else if win.IsGroup() {
+			event, err = attachGroup(d, sess, win)
+		} else if _, _, exited := win.ExitState(); exited && sess.Zombie() != "" {
+			event, err = attachZombie(d, sess, win, config)
+		} else {
+			event, err = attachWindow(d, sess, win, ptyProc, config)
 		}
-
-		// Monitor window size changes
-		go func() {
-			for range sigChan {
-				if win := sess.GetCurrentWindow(); win != nil {
-					if err := setWindowSizeForWindow(in, win, config.AdaptSize); err != nil {
-						_ = err
-					}
-				}
-			}
-		}()
-
-		// Copy from PTY to output with flow control
-		outputDone := make(chan error, 1)
-		go func() {
-			outputDone <- copyWithFlowControl(ptyProc.Pty, scrollbackWriter, flowControl)
-		}()
-
-		// Create a reader that detects detach sequence and window commands
-		detachReader := newDetachReaderWithConfig(in, config)
-
-		// Copy from input to PTY, with detach detection and window commands
-		inputDone := make(chan error, 1)
-		go func() {
-			_, err := io.Copy(ptyProc.Pty, detachReader)
-			inputDone <- err
-		}()
-
-		// Handle terminal disconnection (SIGPIPE on write errors)
-		// This is handled implicitly by checking write errors in outputDone
-
-		// Wait for either input, output, or signals to finish
-		select {
-		case <-hupChan:
-			// SIGHUP received - autodetach (terminal disconnected)
-			// Session state is saved automatically on changes
+		switch event {
+		case eventHangup:
+			// Client connection lost - autodetach
 			debugAttach("attach: hup detach session=%q", sess.ID)
-			if config.OnDetach != nil {
-				config.OnDetach(sess)
-			}
-			return ErrDetach
-
-		case sig := <-termChan:
-			// SIGTERM or SIGINT received - cleanup and exit
-			// Forward signal to child processes
-			debugAttach("attach: term signal=%v session=%q", sig, sess.ID)
-			if win := sess.GetCurrentWindow(); win != nil {
-				if ptyProc := win.GetPTYProcess(); ptyProc != nil && ptyProc.Cmd != nil && ptyProc.Cmd.Process != nil {
-					if err := ptyProc.Cmd.Process.Signal(sig); err != nil {
-						_, _ = fmt.Fprintf(errOut, "warning: failed to forward signal: %v\n", err)
-					}
-				}
-			}
-			// Cleanup all windows
-			for _, w := range sess.Windows {
-				if ptyProc := w.GetPTYProcess(); ptyProc != nil {
-					if ptyProc.Cmd != nil && ptyProc.Cmd.Process != nil {
-						if err := ptyProc.Cmd.Process.Signal(sig); err != nil {
-							_, _ = fmt.Fprintf(errOut, "warning: failed to forward signal: %v\n", err)
-						}
-					}
-				}
-			}
-			return fmt.Errorf("terminated by signal: %v", sig)
+			return d.hangupError()
 
-		case err := <-inputDone:
+		case eventInput:
 			if err == ErrDetach {
 				// User detached, this is normal
 				debugAttach("attach: input detach session=%q", sess.ID)
-				if config.OnDetach != nil {
-					config.OnDetach(sess)
-				}
 				return ErrDetach
 			}
 
 			// Check if it's a window command
 			var winCmd *ErrWindowCommand
 			if errors.As(err, &winCmd) {
-				// Get current scrollback for command handling
-				currentScrollback := scrollbackBuffers[win.ID]
-				if handleErr := handleWindowCommand(sess, winCmd, config, in, out, currentScrollback); handleErr != nil {
+				if handleErr := handleWindowCommand(sess, winCmd, config, d); handleErr != nil {
 					// If command handling fails, return error
 					return handleErr
 				}
-				// Update status line after command
-				if config.StatusLine {
-					statusLine := NewStatusLine(true, config.StatusFormat)
-					statusLine.Update(out, sess)
-				}
-				// Window switched, restart the loop
+				// Restart the loop, repainting the (possibly new) window
 				continue
 			}
 
 			// Other error - handle gracefully
 			if err != nil {
 				// Check if PTY is still alive
-				if win := sess.GetCurrentWindow(); win != nil {
-					if ptyProc := win.GetPTYProcess(); ptyProc != nil {
-						if !ptyProc.IsAlive() {
-							debugAttach("attach: input error, pty dead session=%q err=%v", sess.ID, err)
-							// PTY process died, try to continue with next window
-							if len(sess.Windows) > 1 {
-								sess.NextWindow()
-								continue
-							}
-							// Last window ended while attached; mirror screen behavior by
-							// treating this as a normal session end rather than hard error.
-							return nil
-						}
+				if !win.IsAlive() {
+					debugAttach("attach: input error, pty dead session=%q err=%v", sess.ID, err)
+					// PTY process died: show it as a zombie, or try to
+					// continue with another window
+					if sess.Zombie() != "" {
+						continue
+					}
+					if sess.HasAliveWindow() {
+						view.NextAlive()
+						continue
 					}
+					// Last window ended while attached; mirror screen behavior by
+					// treating this as a normal session end rather than hard error.
+					return nil
 				}
 				debugAttach("attach: input error session=%q err=%v", sess.ID, err)
 				return fmt.Errorf("input error: %w", wrapIOError(err))
@@ -352,77 +211,185 @@ func attachLoop(in *os.File, out *os.File, errOut *os.File, sess *session.Sessio
 			debugAttach("attach: input done session=%q", sess.ID)
 			return err
 
-		case err := <-outputDone:
-			// Output finished (EOF or error)
-			if err == io.EOF {
-				// PTY closed, try to continue with next window or exit
-				debugAttach("attach: output EOF session=%q", sess.ID)
-				if len(sess.Windows) > 1 {
-					// Try next window
-					sess.NextWindow()
-					continue
-				}
-				// Last window closed, exit gracefully
-				return nil
+		case eventOutput:
+			// Output finished: the window's program exited, or the window
+			// got a new program (exec) and needs to be reattached. Dead
+			// windows stay when zombie keys are set.
+			if win.IsAlive() || win.IsGroup() || sess.Zombie() != "" {
+				continue
 			}
 			if err != nil {
-				// Check if PTY is still alive
-				if win := sess.GetCurrentWindow(); win != nil {
-					if ptyProc := win.GetPTYProcess(); ptyProc != nil {
-						if !ptyProc.IsAlive() {
-							debugAttach("attach: output error, pty dead session=%q err=%v", sess.ID, err)
-							// PTY process died
-							if len(sess.Windows) > 1 {
-								sess.NextWindow()
-								continue
-							}
-							return nil
-						}
-					}
-				}
-				debugAttach("attach: output error session=%q err=%v", sess.ID, err)
-				return fmt.Errorf("output error: %w", wrapIOError(err))
+				debugAttach("attach: output error, pty dead session=%q err=%v", sess.ID, err)
 			}
-			debugAttach("attach: output done session=%q", sess.ID)
-			return err
+			if sess.HasAliveWindow() {
+				view.NextAlive()
+				continue
+			}
+			// Last window closed, exit gracefully
+			debugAttach("attach: output EOF session=%q", sess.ID)
+			return nil
 		}
 	}
 }
 
-func debugAttach(format string, args ...any) {
-	if os.Getenv("SGREEN_ATTACH_DEBUG") == "" {
-		return
+// attachGroup shows the windows of the group window win, the current
+// window, for one to be selected, as GNU screen shows group windows.
+// Leaving the list without a choice goes back to the window shown before.
+func attachGroup(d *Display, sess *session.Session, win *session.Window) (attachEvent, error) {
+	_, _ = fmt.Fprint(d, "\x1b[H\x1b[2J")
+	if err := showWindowList(d, d, sess, win); err != nil {
+		return eventInput, err
 	}
-	_, _ = fmt.Fprintf(os.Stderr, format+"\n", args...)
+	if d.hungUp() {
+		return eventHangup, nil
+	}
+	if view := d.viewOf(sess); view.Current() == win {
+		view.ToggleLast()
+	}
+	return eventOutput, nil
 }
 
-// setWindowSizeForWindow sets the PTY window size for a specific window
-func setWindowSizeForWindow(termFile *os.File, win *session.Window, adaptSize bool) error {
-	width, height, err := term.GetSize(int(termFile.Fd()))
-	if err != nil {
-		return err
+// attachWindow connects the display to one window until input or output
+// stops, the display hangs up, or a window command is entered. The display
+// is repainted with the window's screen first.
+func attachWindow(d *Display, sess *session.Session, win *session.Window, ptyProc *pty.PTYProcess, config *AttachConfig) (attachEvent, error) {
+	// Apply encoding conversion for this window if needed
+	encodedOutput := wrapEncodingWriter(d, win.Encoding)
+
+	// Apply output optimization if requested
+	if config.OptimalOutput {
+		encodedOutput = createOptimalWriter(encodedOutput)
 	}
 
-	ptyProc := win.GetPTYProcess()
-	if ptyProc == nil {
-		return errors.New("PTY process not available")
+	// Handle flow control
+	flowControl := setupFlowControl(config.FlowControl, config.Interrupt)
+
+	// Set window size
+	_ = setWindowSizeForWindow(d, win, config.AdaptSize)
+
+	// Receive the window's output through a pipe until we leave the window
+	stop := make(chan struct{})
+	outputR, outputW := io.Pipe()
+	repaint, exited, removeOutput := win.AttachOutput(outputW)
+	defer func() {
+		close(stop)
+		removeOutput()
+		_ = outputW.Close()
+	}()
+	go func() {
+		select {
+		case <-exited:
+			_ = outputW.CloseWithError(io.EOF)
+		case <-stop:
+		}
+	}()
+
+	// Paint the window's current screen; its output continues from there
+	if _, err := d.Write(repaint); err != nil {
+		return eventHangup, nil
 	}
+	if config.StatusLine {
+		drawStatusLine(d, sess, config)
+	}
+	showNotices(d, d.Monitor, config)
+
+	// Copy from the window to the display with flow control
+	outputDone := make(chan error, 1)
+	go func() {
+		outputDone <- copyWithFlowControl(outputR, encodedOutput, flowControl)
+	}()
+
+	// Create a reader that detects detach sequence and window commands
+	detachReader := newDetachReaderWithConfig(d.interruptible(stop), config)
+
+	// Copy from input to PTY, with detach detection and window commands
+	inputDone := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(ptyProc.Pty, detachReader)
+		inputDone <- err
+	}()
 
-	return ptyProc.SetSize(uint16(height), uint16(width))
+	// Wait for either input, output, or a hangup to finish
+	select {
+	case <-d.hangup:
+		return eventHangup, nil
+	case err := <-inputDone:
+		if err == nil && d.hungUp() {
+			return eventHangup, nil
+		}
+		return eventInput, err
+	case err := <-outputDone:
+		return eventOutput, err
+	}
 }
 
-// scrollbackWriter wraps a writer to also write to scrollback buffer
-type scrollbackWriter struct {
-	scrollback *ScrollbackBuffer
+// attachZombie shows a dead window with a banner telling how its program
+// exited, until one of the zombie keys closes or respawns it. Window
+// commands keep working meanwhile.
+func attachZombie(d *Display, sess *session.Session, win *session.Window, config *AttachConfig) (attachEvent, error) {
+	keys := sess.Zombie()
+	status, _, _ := win.ExitState()
+
+	var repaint bytes.Buffer
+	_ = win.Screen().Render(&repaint)
+	if _, err := d.Write(repaint.Bytes()); err != nil {
+		return eventHangup, nil
+	}
+	if config.StatusLine {
+		drawStatusLine(d, sess, config)
+	}
+	showStatusMessage(d, fmt.Sprintf("Window %s exited with status %d; %s closes, %s respawns it",
+		win.Number, status, keyName(keys[0]), keyName(keys[1])))
+	showNotices(d, d.Monitor, config)
+
+	reader := newDetachReaderWithConfig(d, config)
+	buf := make([]byte, 64)
+	for {
+		n, err := reader.Read(buf)
+		if err != nil {
+			if d.hungUp() {
+				return eventHangup, nil
+			}
+			return eventInput, err
+		}
+		if handleZombieKeys(sess, win, buf[:n], keys, config, d) {
+			return eventOutput, nil
+		}
+	}
 }
 
-func (sw *scrollbackWriter) Write(p []byte) (n int, err error) {
-	sw.scrollback.AppendBytes(p)
-	return len(p), nil
+// keyName returns a key as written in screen commands, such as ^C.
+func keyName(b byte) string {
+	switch {
+	case b == 0x7f:
+		return "^?"
+	case b < 0x20:
+		return "^" + string(rune(b+'@'))
+	}
+	return string(rune(b))
+}
+
+func debugAttach(format string, args ...any) {
+	if os.Getenv("SGREEN_ATTACH_DEBUG") == "" {
+		return
+	}
+	_, _ = fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// setWindowSizeForWindow sets the PTY window size for a specific window
+func setWindowSizeForWindow(d *Display, win *session.Window, adaptSize bool) error {
+	width, height := d.Size()
+	if width <= 0 || height <= 0 {
+		return errors.New("display size unknown")
+	}
+
+	return win.Resize(width, height)
 }
 
 // handleWindowCommand handles window management commands
-func handleWindowCommand(sess *session.Session, cmd *ErrWindowCommand, config *AttachConfig, in, out *os.File, scrollback *ScrollbackBuffer) error {
+func handleWindowCommand(sess *session.Session, cmd *ErrWindowCommand, config *AttachConfig, d *Display) error {
+	in, out := io.Reader(d), io.Writer(d)
+	view := d.viewOf(sess)
 	switch cmd.Command {
 	case "create":
 		// Create new window with default shell
@@ -436,9 +403,10 @@ func handleWindowCommand(sess *session.Session, cmd *ErrWindowCommand, config *A
 			UTF8:            config.UTF8,
 			Encoding:        config.Encoding,
 			AllCapabilities: config.AllCapabilities,
+			Scrollback:      config.Scrollback,
 		}
 
-		win, err := sess.CreateWindow(shellPath, []string{}, sessConfig)
+		win, err := view.CreateWindowAt(0, shellPath, []string{}, sessConfig)
 		if err != nil {
 			return fmt.Errorf("failed to create window: %w", err)
 		}
@@ -447,34 +415,40 @@ func handleWindowCommand(sess *session.Session, cmd *ErrWindowCommand, config *A
 		if config.ShellTitle != "" {
 			// For now, use shelltitle as the initial title
 			// In full implementation, this would parse the format and detect prompt
-			win.Title = config.ShellTitle
+			sess.SetTitleOf(win, config.ShellTitle)
 		}
 
 		return nil
 
 	case "next":
-		sess.NextWindow()
+		view.Next()
 		return nil
 
 	case "prev":
-		sess.PrevWindow()
+		view.Prev()
 		return nil
 
 	case "toggle":
-		sess.ToggleLastWindow()
+		view.ToggleLast()
 		return nil
 
 	case "switch":
 		if cmd.Window == "" {
 			return fmt.Errorf("no window specified")
 		}
-		return sess.SwitchToWindow(cmd.Window)
+		return view.SwitchTo(cmd.Window)
 
 	case "kill":
-		return sess.KillCurrentWindow()
+		win := view.Current()
+		if win == nil {
+			return fmt.Errorf("no current window")
+		}
+		return sess.KillWindow(win)
 
 	case "title":
-		sess.SetWindowTitle(cmd.Title)
+		if win := view.Current(); win != nil {
+			sess.SetTitleOf(win, cmd.Title)
+		}
 		return nil
 
 	case "list":
@@ -483,17 +457,17 @@ func handleWindowCommand(sess *session.Session, cmd *ErrWindowCommand, config *A
 
 	case "copymode":
 		// Enter copy mode
-		win := sess.GetCurrentWindow()
+		win := view.Current()
 		if win == nil {
 			return fmt.Errorf("no current window")
 		}
-		return EnterCopyMode(win, in, scrollback)
+		return EnterCopyMode(win, in, out)
 
 	case "paste":
 		// Paste from buffer
 		pasteContent := GetPasteBuffer()
 		if len(pasteContent) > 0 {
-			win := sess.GetCurrentWindow()
+			win := view.Current()
 			if win != nil && win.GetPTYProcess() != nil {
 				if _, err := win.GetPTYProcess().Pty.Write(pasteContent); err != nil {
 					return err
@@ -521,10 +495,11 @@ func handleWindowCommand(sess *session.Session, cmd *ErrWindowCommand, config *A
 		if cmd.Title == "" {
 			return fmt.Errorf("no filename specified")
 		}
-		if scrollback == nil {
-			return fmt.Errorf("no scrollback available")
+		win := view.Current()
+		if win == nil {
+			return fmt.Errorf("no current window")
 		}
-		return WriteScrollbackToFile(scrollback, cmd.Title)
+		return WriteScrollbackToFile(windowScrollback(win), cmd.Title)
 
 	case "help":
 		// Show help
@@ -538,11 +513,10 @@ func handleWindowCommand(sess *session.Session, cmd *ErrWindowCommand, config *A
 
 	case "command":
 		// Show command prompt
-		return ShowCommandPrompt(in, out, sess, config, scrollback)
+		return ShowCommandPrompt(d, sess, config)
 
 	case "redraw":
-		// Redraw screen - clear and redraw
-		ClearScreenAndHome(out)
+		// The attach loop repaints the window when it resumes
 		return nil
 
 	case "lock":
@@ -590,15 +564,19 @@ func handleWindowCommand(sess *session.Session, cmd *ErrWindowCommand, config *A
 		return nil
 
 	case "suspend":
-		// Suspend screen
-		return suspendScreen()
+		// Suspend screen - the client stops itself
+		if d.OnSuspend != nil {
+			d.OnSuspend()
+		}
+		return nil
 
 	case "killall":
 		// Kill all windows and terminate
 		return killAllWindows(sess)
 
 	default:
-		return fmt.Errorf("unknown window command: %s", cmd.Command)
+		// Key bindings may run any command
+		return runCommandLine(d, sess, config, cmd.Command)
 	}
 }
 
@@ -953,12 +931,15 @@ func (dr *detachReader) Read(p []byte) (n int, err error) {
 		case ':':
 			// Command prompt
 			return 0, &ErrWindowCommand{Command: "command"}
-		case '.':
+		case '.', 'l', 0x0c:
 			// Redraw screen
 			return 0, &ErrWindowCommand{Command: "redraw"}
 		case 'x':
 			// Lock screen
 			return 0, &ErrWindowCommand{Command: "lock"}
+		case 'h':
+			// Hardcopy of the window to hardcopy.N
+			return 0, &ErrWindowCommand{Command: "hardcopy"}
 		case 'v':
 			// Version information
 			return 0, &ErrWindowCommand{Command: "version"}
@@ -993,9 +974,27 @@ func (dr *detachReader) Read(p []byte) (n int, err error) {
 		case '\b', 0x7f: // Backspace
 			// Backspace: Previous window (alternative)
 			return 0, &ErrWindowCommand{Command: "prev"}
+		case 'S':
+			// Split the region into rows
+			return 0, &ErrWindowCommand{Command: "split"}
+		case '|':
+			// Split the region into columns
+			return 0, &ErrWindowCommand{Command: "split -v"}
+		case '\t':
+			// Focus the next region
+			return 0, &ErrWindowCommand{Command: "focus"}
+		case 'X':
+			// Remove the focused region
+			return 0, &ErrWindowCommand{Command: "remove"}
+		case 'Q':
+			// Remove all regions but the focused one
+			return 0, &ErrWindowCommand{Command: "only"}
 		case '"':
 			// Interactive window list - for now, just show list
 			return 0, &ErrWindowCommand{Command: "list"}
+		case '*':
+			// Interactive list of the attached displays
+			return 0, &ErrWindowCommand{Command: "displays"}
 		case '\'':
 			// Select window by name/number - enter selection mode
 			dr.state = 3 // Enter window selection mode
@@ -1098,59 +1097,11 @@ func (dr *detachReader) Read(p []byte) (n int, err error) {
 	return 0, nil
 }
 
-// createOutputWriterForWindow creates an output writer with per-window logging support
-func createOutputWriterForWindow(out io.Writer, config *AttachConfig, win *session.Window, logDir string) io.Writer {
-	if !config.Logging && config.Logfile == "" {
-		return out
-	}
-
-	// Create multi-writer for both output and log file
-	writers := []io.Writer{out}
-
-	// Per-window logging
-	if config.Logging && win != nil && logDir != "" {
-		// Create per-window log writer
-		pwlw := getPerWindowLogWriter(logDir, true) // timestamp enabled
-		if writer, err := pwlw.GetWriter(win.ID, win.Title); err == nil {
-			writers = append(writers, writer)
-		}
-	}
-
-	// Global log file
-	if config.Logfile != "" {
-		logWriter, err := NewLogWriter(config.Logfile, true) // timestamp enabled
-		if err == nil {
-			writers = append(writers, logWriter)
-		} else {
-			// Fallback to simple file
-			logFile, err := os.OpenFile(config.Logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-			if err == nil {
-				writers = append(writers, logFile)
-			}
-		}
-	}
-
-	return io.MultiWriter(writers...)
-}
-
 // lockScreen locks the screen with password prompt
-func lockScreen(in, out *os.File) error {
+func lockScreen(in io.Reader, out io.Writer) error {
 	_, _ = fmt.Fprint(out, "\r\nScreen locked. Enter password: ")
 
-	// Read password (without echo)
-	oldState, err := term.GetState(int(in.Fd()))
-	if err != nil {
-		return err
-	}
-	defer func() {
-		_ = term.Restore(int(in.Fd()), oldState)
-	}()
-
-	// Set terminal to no-echo mode
-	if _, err := term.MakeRaw(int(in.Fd())); err != nil {
-		return err
-	}
-
+	// The client terminal is in raw mode, so input is not echoed
 	password := ""
 	buf := make([]byte, 1)
 	for {
@@ -1185,43 +1136,8 @@ func lockScreen(in, out *os.File) error {
 	return nil
 }
 
-// suspendScreen suspends the screen process
-func suspendScreen() error {
-	// Send SIGTSTP to self
-	proc, err := os.FindProcess(os.Getpid())
-	if err != nil {
-		return err
-	}
-	return proc.Signal(unix.SIGTSTP)
-}
-
 // killAllWindows kills all windows and terminates the session
 func killAllWindows(sess *session.Session) error {
-	// Kill all windows
-	for _, win := range sess.Windows {
-		if win.GetPTYProcess() != nil {
-			_ = win.GetPTYProcess().Kill()
-		}
-	}
 	// Session will terminate when all windows are killed
-	return nil
-}
-
-var (
-	perWindowLogWriters = make(map[string]*PerWindowLogWriter)
-	logWritersMu        sync.RWMutex
-)
-
-// getPerWindowLogWriter gets or creates a per-window log writer for a session
-func getPerWindowLogWriter(logDir string, timestamp bool) *PerWindowLogWriter {
-	logWritersMu.Lock()
-	defer logWritersMu.Unlock()
-
-	if writer, exists := perWindowLogWriters[logDir]; exists {
-		return writer
-	}
-
-	writer := NewPerWindowLogWriter(logDir, timestamp)
-	perWindowLogWriters[logDir] = writer
-	return writer
+	return session.Delete(sess.ID)
 }
@@ -0,0 +1,1250 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inoki/sgreen/internal/pty"
+	"github.com/inoki/sgreen/internal/session"
+)
+
+// CommandContext is what a screen command runs against. Commands entered at
+// the C-a : prompt or through a key binding run on the display they were
+// entered on; commands sent with -X run without a display.
+type CommandContext struct {
+	Session *session.Session
+	// Window is the window the command acts on, or nil for the current
+	// window of the session.
+	Window *session.Window
+	// WindowConfig holds the settings for windows the command creates.
+	WindowConfig *session.Config
+	// Out receives the messages of the command, one per line. They are
+	// discarded when Out is nil.
+	Out io.Writer
+	// Detach detaches the displays of the session, for commands run
+	// without a display. A power detach also hangs up their clients.
+	Detach func(power bool) error
+	// Query runs a query command (-Q): only commands that report are
+	// allowed, and they change nothing.
+	Query bool
+	// Status is the exit status a command asks sgreen -X to exit with.
+	Status int
+
+	display *Display
+	config  *AttachConfig
+}
+
+// command describes a screen command
+type command struct {
+	minArgs int
+	maxArgs int // Negative for no limit
+	flags   commandFlags
+	run     func(ctx *CommandContext, args []string) error
+}
+
+type commandFlags int
+
+const (
+	needDisplay commandFlags = 1 << iota // Only runs on a display
+	needWindow                           // Needs a current window
+	canQuery                             // Answers queries (-Q)
+)
+
+// commands is the command table shared by the command prompt, key bindings
+// and -X.
+var commands = map[string]command{
+	"acl":         {0, 0, 0, cmdACL},
+	"acladd":      {1, -1, 0, cmdACLAdd},
+	"acldel":      {1, -1, 0, cmdACLDel},
+	"copy":        {0, 0, needDisplay | needWindow, cmdCopy},
+	"defzombie":   {0, 1, 0, cmdZombie},
+	"detach":      {0, 1, 0, cmdDetach},
+	"displays":    {0, 0, needDisplay, cmdDisplays},
+	"dump":        {1, 1, needWindow, cmdDump},
+	"exec":        {1, -1, needWindow, cmdExec},
+	"exit":        {0, 0, 0, cmdQuit},
+	"fit":         {0, 0, needDisplay, cmdFit},
+	"focus":       {0, 1, needDisplay, cmdFocus},
+	"group":       {0, 1, needWindow | canQuery, cmdGroup},
+	"help":        {0, 0, needDisplay, cmdHelp},
+	"hardcopy":    {0, 2, needWindow, cmdHardcopy},
+	"info":        {0, 0, needWindow | canQuery, cmdInfo},
+	"kill":        {0, 1, needWindow, cmdKill},
+	"killgrace":   {0, 1, canQuery, cmdKillGrace},
+	"layout":      {1, 2, 0, cmdLayout},
+	"lock":        {0, 0, needDisplay, cmdLock},
+	"lockscreen":  {0, 0, needDisplay, cmdLock},
+	"log":         {0, 1, 0, cmdLog},
+	"maxwin":      {0, 1, canQuery, cmdMaxWin},
+	"next":        {0, 0, 0, cmdNext},
+	"number":      {0, 1, needWindow | canQuery, cmdNumber},
+	"only":        {0, 0, needDisplay, cmdOnly},
+	"other":       {0, 0, 0, cmdOther},
+	"paste":       {0, 0, needWindow, cmdPaste},
+	"pow_detach":  {0, 0, 0, cmdPowDetach},
+	"prev":        {0, 0, 0, cmdPrev},
+	"quit":        {0, 0, 0, cmdQuit},
+	"readbuf":     {1, 1, 0, cmdReadBuf},
+	"redisplay":   {0, 0, needDisplay, cmdRedisplay},
+	"remove":      {0, 0, needDisplay, cmdRemove},
+	"rename":      {1, 1, 0, cmdSessionName},
+	"resize":      {1, 2, needDisplay, cmdResize},
+	"screen":      {0, -1, 0, cmdScreen},
+	"select":      {1, 1, canQuery, cmdSelect},
+	"sessionname": {0, 1, 0, cmdSessionName},
+	"split":       {0, 1, needDisplay, cmdSplit},
+	"stuff":       {1, 3, needWindow, cmdStuff},
+	"time":        {0, 0, needDisplay, cmdTime},
+	"title":       {0, 1, needWindow | canQuery, cmdTitle},
+	"version":     {0, 0, needDisplay, cmdVersion},
+	"wait":        {0, 0, needWindow, cmdWait},
+	"windows":     {0, 0, canQuery, cmdWindows},
+	"zombie":      {0, 1, 0, cmdZombie},
+	"writebuf":    {1, 1, 0, cmdWriteBuf},
+}
+
+// commandNames returns the names of all commands in alphabetical order.
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunCommand runs one screen command, given as its name followed by its
+// arguments. Errors are worded like GNU screen's messages, for example
+// "unknown command 'foo'" or "select: one argument required".
+func RunCommand(ctx *CommandContext, args []string) error {
+	if len(args) == 0 {
+		return errors.New("no command given")
+	}
+	name := args[0]
+	args = args[1:]
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command '%s'", name)
+	}
+	if ctx.Query && cmd.flags&canQuery == 0 {
+		return fmt.Errorf("%s: not a query command", name)
+	}
+	if cmd.flags&needDisplay != 0 && ctx.display == nil {
+		return fmt.Errorf("%s: display required", name)
+	}
+	if cmd.flags&needWindow != 0 && ctx.window() == nil {
+		return fmt.Errorf("%s: window required", name)
+	}
+	if msg := checkArgCount(len(args), cmd.minArgs, cmd.maxArgs); msg != "" {
+		return fmt.Errorf("%s: %s", name, msg)
+	}
+	err := cmd.run(ctx, args)
+	ctx.Session.SaveIfOpen()
+	if err != nil {
+		if errors.Is(err, ErrDetach) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// checkArgCount returns GNU screen's complaint about n arguments given to a
+// command taking min to max of them, or "" if n is fine.
+func checkArgCount(n, min, max int) string {
+	if n >= min && (max < 0 || n <= max) {
+		return ""
+	}
+	switch {
+	case max == 0:
+		return "no arguments allowed"
+	case min == max:
+		return countWord(min) + " required"
+	case max < 0:
+		return "at least " + countWord(min) + " required"
+	case min == 0:
+		return "at most " + countWord(max) + " allowed"
+	default:
+		return fmt.Sprintf("%s to %s required", numberWord(min), countWord(max))
+	}
+}
+
+// countWord returns "one argument", "two arguments" and so on.
+func countWord(n int) string {
+	if n == 1 {
+		return "one argument"
+	}
+	return numberWord(n) + " arguments"
+}
+
+func numberWord(n int) string {
+	words := []string{"no", "one", "two", "three", "four"}
+	if n >= 0 && n < len(words) {
+		return words[n]
+	}
+	return strconv.Itoa(n)
+}
+
+// runCommandLine parses a command line typed at the prompt or bound to a
+// key and runs its commands, which may be separated by semicolons, on the
+// display d.
+func runCommandLine(d *Display, sess *session.Session, config *AttachConfig, line string) error {
+	ctx := &CommandContext{
+		Session:      sess,
+		WindowConfig: windowConfig(config),
+		Out:          &messageWriter{d: d},
+		display:      d,
+		config:       config,
+	}
+	for _, single := range strings.Split(line, ";") {
+		args, err := parseCommandLine(single)
+		if err == nil && len(args) == 0 {
+			continue
+		}
+		if err == nil {
+			err = RunCommand(ctx, args)
+		}
+		if errors.Is(err, ErrDetach) {
+			return err
+		}
+		if err != nil {
+			d.postMessage(err.Error())
+			return nil
+		}
+	}
+	return nil
+}
+
+// parseCommandLine splits a command line into words. Like in a .screenrc,
+// words may be quoted with single or double quotes. Outside single quotes a
+// backslash quotes a following quote, backslash or blank; other backslash
+// escapes such as \r are kept for the command to interpret.
+func parseCommandLine(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			if !strings.ContainsRune("\\\"' \t", r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("missing " + string(quote))
+	}
+	if escaped {
+		word.WriteRune('\\')
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// windowConfig returns the settings for windows created from a display.
+func windowConfig(config *AttachConfig) *session.Config {
+	if config == nil {
+		return nil
+	}
+	return &session.Config{
+		Term:            config.Term,
+		UTF8:            config.UTF8,
+		Encoding:        config.Encoding,
+		AllCapabilities: config.AllCapabilities,
+		Scrollback:      config.Scrollback,
+	}
+}
+
+// window returns the window the command acts on.
+func (ctx *CommandContext) window() *session.Window {
+	if ctx.Window != nil {
+		return ctx.Window
+	}
+	return ctx.view().Current()
+}
+
+// view returns the view the command acts on: that of the display, or that
+// of the session for commands sent with -X.
+func (ctx *CommandContext) view() *session.View {
+	if ctx.display != nil {
+		return ctx.display.viewOf(ctx.Session)
+	}
+	return ctx.Session.View()
+}
+
+// windowTitle returns the title of a window, or the name of its program if
+// it has none.
+func windowTitle(win *session.Window) string {
+	cmdPath, _ := win.Command()
+	if win.Title != "" || cmdPath == "" {
+		return win.Title
+	}
+	return filepath.Base(cmdPath)
+}
+
+// windowPath returns the title of win after the titles of its groups,
+// separated by slashes. The title of a group window ends in a slash.
+func windowPath(sess *session.Session, win *session.Window) string {
+	path := windowTitle(win)
+	if win.IsGroup() {
+		path += "/"
+	}
+	for group := sess.GroupOf(win); group != nil; group = sess.GroupOf(group) {
+		path = windowTitle(group) + "/" + path
+	}
+	return path
+}
+
+// printf writes a message of a command.
+func (ctx *CommandContext) printf(format string, args ...any) {
+	if ctx.Out != nil {
+		_, _ = fmt.Fprintf(ctx.Out, format+"\n", args...)
+	}
+}
+
+// messageWriter shows each line written to it as a message on a display
+type messageWriter struct {
+	d *Display
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line != "" {
+			w.d.postMessage(line)
+		}
+	}
+	return len(p), nil
+}
+
+// waitForKey waits until a key is pressed on the display.
+func waitForKey(d *Display) error {
+	buf := make([]byte, 1)
+	_, err := d.Read(buf)
+	return err
+}
+
+func defaultShell() string {
+	if envShell := os.Getenv("SHELL"); envShell != "" {
+		return envShell
+	}
+	return "/bin/sh"
+}
+
+func cmdACL(ctx *CommandContext, args []string) error {
+	sess := ctx.Session
+	ctx.printf("Owner: %s", sess.Owner)
+	if len(sess.AllowedUsers) == 0 {
+		ctx.printf("Allowed users: (none)")
+	} else {
+		ctx.printf("Allowed users: %s", strings.Join(sess.AllowedUsers, ", "))
+	}
+	return nil
+}
+
+func cmdACLAdd(ctx *CommandContext, args []string) error {
+	for _, user := range args {
+		if err := ctx.Session.AddUser(user); err != nil {
+			return err
+		}
+		ctx.printf("Added user: %s", user)
+	}
+	return nil
+}
+
+func cmdACLDel(ctx *CommandContext, args []string) error {
+	for _, user := range args {
+		if err := ctx.Session.RemoveUser(user); err != nil {
+			return err
+		}
+		ctx.printf("Removed user: %s", user)
+	}
+	return nil
+}
+
+func cmdCopy(ctx *CommandContext, args []string) error {
+	return EnterCopyMode(ctx.window(), ctx.display, ctx.display)
+}
+
+func cmdDetach(ctx *CommandContext, args []string) error {
+	power := false
+	if len(args) == 1 {
+		if args[0] != "-h" {
+			return errors.New("invalid argument")
+		}
+		power = true
+	}
+	return detach(ctx, power)
+}
+
+func cmdPowDetach(ctx *CommandContext, args []string) error {
+	return detach(ctx, true)
+}
+
+// detach detaches the display the command was entered on, or every
+// display when it came without one.
+func detach(ctx *CommandContext, power bool) error {
+	if ctx.display != nil {
+		if power {
+			return ErrPowerDetach
+		}
+		return ErrDetach
+	}
+	if ctx.Detach == nil {
+		return nil
+	}
+	return ctx.Detach(power)
+}
+
+func cmdDisplays(ctx *CommandContext, args []string) error {
+	// displays: a number and d detaches that display, D power detaches it
+	d, sess := ctx.display, ctx.Session
+	target, power, err := selectDisplay(d, sess)
+	if err != nil || target == nil {
+		return err
+	}
+	if target == d {
+		return detach(ctx, power)
+	}
+	if sess.Owner != "" && d.Client.User != sess.Owner {
+		return errors.New("only the owner of the session can detach other displays")
+	}
+	target.detach(power)
+	ctx.printf("Detached display of %s on %s", target.Client.User, target.Client.Tty)
+	return nil
+}
+
+func cmdDump(ctx *CommandContext, args []string) error {
+	return WriteScrollbackToFile(windowScrollback(ctx.window()), args[0])
+}
+
+func cmdExec(ctx *CommandContext, args []string) error {
+	cmdPath := args[0]
+	cmdArgs := args[1:]
+	// If redirection patterns are present, execute via shell.
+	if hasRedirectionTokens(args) {
+		cmdLine := strings.Join(args, " ")
+		if runtime.GOOS == "windows" {
+			cmdPath = "cmd"
+			cmdArgs = []string{"/C", cmdLine}
+		} else {
+			cmdPath = defaultShell()
+			cmdArgs = []string{"-c", cmdLine}
+		}
+	}
+
+	win := ctx.window()
+
+	// Kill current process in window
+	if ptyProc := win.GetPTYProcess(); ptyProc != nil {
+		if ptyProc.Cmd != nil && ptyProc.Cmd.Process != nil {
+			if err := ptyProc.Cmd.Process.Kill(); err != nil {
+				return err
+			}
+		}
+	}
+
+	term := "screen"
+	if ctx.WindowConfig != nil && ctx.WindowConfig.Term != "" {
+		term = ctx.WindowConfig.Term
+	}
+	ptyProc, err := pty.StartWithEnv(cmdPath, cmdArgs, map[string]string{
+		"TERM": term,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to exec command: %w", err)
+	}
+
+	// Update window with new PTY process
+	win.SetPTYProcess(ptyProc)
+	win.SetCommand(cmdPath, cmdArgs)
+	return nil
+}
+
+func cmdFit(ctx *CommandContext, args []string) error {
+	// fit: windows resized by other displays get the size of their region
+	c := ctx.display.regions()
+	if c.isSplit() {
+		c.fitWindows()
+		c.markDirty()
+		return nil
+	}
+	if win := ctx.view().Current(); win != nil {
+		return setWindowSizeForWindow(ctx.display, win, true)
+	}
+	return nil
+}
+
+func cmdFocus(ctx *CommandContext, args []string) error {
+	// focus [next|prev|up|down|left|right|top|bottom]
+	direction := ""
+	if len(args) == 1 {
+		direction = args[0]
+	}
+	win, err := ctx.display.regions().moveFocus(direction)
+	if err != nil {
+		return err
+	}
+	showInFocus(ctx.view(), win)
+	return nil
+}
+
+// showInFocus makes win, the window of a newly focused region, the current
+// window of view. Blank regions leave the current window alone.
+func showInFocus(view *session.View, win *session.Window) {
+	if win != nil {
+		view.Switch(win)
+	}
+}
+
+func cmdGroup(ctx *CommandContext, args []string) error {
+	// group [n|title]: show the group of the window, or move it into a
+	// group window; - moves it to the top level
+	win := ctx.window()
+	if len(args) == 0 {
+		if group := ctx.Session.GroupOf(win); group != nil {
+			ctx.printf("Window %s is in group %s (%s)", win.Number, group.Number, windowTitle(group))
+		} else {
+			ctx.printf("Window %s is in no group", win.Number)
+		}
+		return nil
+	}
+	if ctx.Query {
+		return errors.New("cannot change the group in a query")
+	}
+	if args[0] == "-" {
+		return ctx.Session.SetGroup(win, nil)
+	}
+	group := ctx.Session.FindWindow(args[0])
+	if group == nil {
+		return fmt.Errorf("no group %s", args[0])
+	}
+	return ctx.Session.SetGroup(win, group)
+}
+
+func cmdHelp(ctx *CommandContext, args []string) error {
+	ShowHelp(ctx.display)
+	return waitForKey(ctx.display)
+}
+
+func cmdHardcopy(ctx *CommandContext, args []string) error {
+	// hardcopy [-h] [file]
+	history := len(args) > 0 && args[0] == "-h"
+	if history {
+		args = args[1:]
+	}
+	if len(args) > 1 {
+		return errors.New("usage: hardcopy [-h] [file]")
+	}
+	win := ctx.window()
+	text := windowHardcopy(win, history)
+
+	filename := "hardcopy." + win.Number
+	if len(args) == 1 {
+		filename = args[0]
+	}
+	if filename == "-" {
+		if ctx.Out != nil {
+			_, _ = io.WriteString(ctx.Out, text)
+		}
+		return nil
+	}
+	if err := os.WriteFile(filename, []byte(text), 0o644); err != nil {
+		return err
+	}
+	ctx.printf("Screen image written to \"%s\".", filename)
+	return nil
+}
+
+// windowHardcopy returns the text a window shows, one line per row, after
+// its scrollback history if history is set.
+func windowHardcopy(win *session.Window, history bool) string {
+	screen := win.Screen()
+	lines := screen.Lines()
+	if history {
+		lines = append(screen.History(), lines...)
+	}
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func cmdInfo(ctx *CommandContext, args []string) error {
+	// Like screen: (column,row)/(width,height)+scrollback encoding number(title)
+	win := ctx.window()
+	x, y, width, height := 0, 0, 0, 0
+	if screen := win.Screen(); screen != nil {
+		x, y = screen.Cursor()
+		width, height = screen.Size()
+	}
+	encoding := win.Encoding
+	if encoding == "" {
+		encoding = "-"
+	}
+	ctx.printf("(%d,%d)/(%d,%d)+%d %s %s(%s)", x+1, y+1, width, height,
+		win.ScrollbackSize, encoding, win.Number, windowTitle(win))
+	return nil
+}
+
+func cmdKill(ctx *CommandContext, args []string) error {
+	// kill -SIGNAL signals the foreground job and leaves the window
+	if len(args) == 1 {
+		if !strings.HasPrefix(args[0], "-") {
+			return fmt.Errorf("kill: signal must be given as -SIGNAL, not %s", args[0])
+		}
+		sig, err := pty.ParseSignal(args[0][1:])
+		if err != nil {
+			return err
+		}
+		return ctx.window().Signal(sig)
+	}
+	return ctx.Session.KillWindow(ctx.window())
+}
+
+func cmdKillGrace(ctx *CommandContext, args []string) error {
+	if len(args) == 0 {
+		ctx.printf("killgrace is %s", ctx.Session.KillGraceDuration())
+		return nil
+	}
+	if ctx.Query {
+		return errors.New("cannot change killgrace in a query")
+	}
+	grace, err := ParseKillGrace(args[0])
+	if err != nil {
+		return err
+	}
+	return ctx.Session.SetKillGrace(grace)
+}
+
+// ParseKillGrace parses the argument of killgrace: seconds, or a duration
+// such as 500ms.
+func ParseKillGrace(arg string) (time.Duration, error) {
+	grace, err := time.ParseDuration(arg)
+	if err != nil {
+		secs, ferr := strconv.ParseFloat(arg, 64)
+		if ferr != nil {
+			return 0, fmt.Errorf("killgrace: invalid duration %s", arg)
+		}
+		grace = time.Duration(secs * float64(time.Second))
+	}
+	if grace <= 0 {
+		return 0, fmt.Errorf("killgrace: duration must be positive, not %s", arg)
+	}
+	return grace, nil
+}
+
+func cmdLayout(ctx *CommandContext, args []string) error {
+	// layout new|next|prev|select|save|remove|title|number|autosave|show|dump
+	sess := ctx.Session
+	arg := ""
+	if len(args) == 2 {
+		arg = args[1]
+	}
+	// Commands sent with -X act on the layout a display showed last
+	current := sess.LastLayoutNumber()
+	if ctx.display != nil {
+		current = ctx.display.canvas.currentLayout()
+	}
+	named := func() (*session.Layout, error) {
+		if arg == "" {
+			if l := sess.LayoutNumbered(current); l != nil {
+				return l, nil
+			}
+			return nil, errors.New("no layout")
+		}
+		if l := sess.FindLayout(arg); l != nil {
+			return l, nil
+		}
+		return nil, fmt.Errorf("no layout %s", arg)
+	}
+
+	switch args[0] {
+	case "new", "next", "prev", "select", "save":
+		if ctx.display == nil {
+			return errors.New("display required")
+		}
+	}
+	switch args[0] {
+	case "new":
+		if err := saveLayout(ctx.display, sess, false); err != nil {
+			return err
+		}
+		l := sess.NewLayout(arg)
+		c := ctx.display.regions()
+		c.only()
+		c.setLayout(l.Number)
+		sess.SetLastLayout(l.Number)
+		return saveLayout(ctx.display, sess, true)
+	case "next", "prev":
+		return cycleLayout(ctx.display, sess, args[0] == "prev")
+	case "select":
+		if arg == "" {
+			return errors.New("usage: layout select <n|title>")
+		}
+		l, err := named()
+		if err != nil {
+			return err
+		}
+		if l.Number == current {
+			return nil
+		}
+		return showLayout(ctx.display, sess, l)
+	case "save":
+		// layout save [n|title]: store the regions, in a new layout if no
+		// layout has the title
+		l, err := named()
+		if arg != "" && err != nil {
+			l, err = sess.NewLayout(arg), nil
+		}
+		if err != nil {
+			return err
+		}
+		if l.Number != current {
+			ctx.display.canvas.setLayout(l.Number)
+			sess.SetLastLayout(l.Number)
+		}
+		return saveLayout(ctx.display, sess, true)
+	case "remove":
+		l, err := named()
+		if err != nil {
+			return err
+		}
+		if err := sess.RemoveLayout(l.Number); err != nil {
+			return err
+		}
+		if l.Number != current {
+			return nil
+		}
+		// Show another layout, or keep the regions without one
+		if ctx.display != nil {
+			ctx.display.canvas.setLayout(-1)
+			if others := sess.LayoutsByNumber(); len(others) > 0 {
+				return showLayout(ctx.display, sess, others[0])
+			}
+		}
+		sess.SetLastLayout(-1)
+	case "title":
+		l := sess.LayoutNumbered(current)
+		if l == nil {
+			return errors.New("no layout")
+		}
+		if arg == "" {
+			ctx.printf("This is layout %d (%s).", l.Number, l.Title)
+			return nil
+		}
+		return sess.SetLayoutTitle(l.Number, arg)
+	case "number":
+		l := sess.LayoutNumbered(current)
+		if l == nil {
+			return errors.New("no layout")
+		}
+		if arg == "" {
+			ctx.printf("This is layout %d (%s).", l.Number, l.Title)
+			return nil
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid layout number %s", arg)
+		}
+		if err := sess.SetLayoutNumber(l.Number, n); err != nil {
+			return err
+		}
+		if ctx.display != nil {
+			ctx.display.canvas.setLayout(n)
+		}
+		sess.SetLastLayout(n)
+	case "autosave":
+		l := sess.LayoutNumbered(current)
+		if l == nil {
+			return errors.New("no layout")
+		}
+		switch arg {
+		case "":
+			state := "off"
+			if l.Autosave {
+				state = "on"
+			}
+			ctx.printf("autosave is %s for layout %d (%s)", state, l.Number, l.Title)
+			return nil
+		case "on", "off":
+			return sess.SetLayoutAutosave(l.Number, arg == "on")
+		default:
+			return fmt.Errorf("invalid argument %s", arg)
+		}
+	case "show", "list":
+		layouts := sess.LayoutsByNumber()
+		if len(layouts) == 0 {
+			ctx.printf("No layouts defined")
+			return nil
+		}
+		ctx.printf("%s", listLayouts(layouts, current))
+	case "dump":
+		// layout dump [file]: append the commands recreating the regions
+		// of the current layout to file
+		name := arg
+		if name == "" {
+			name = layoutDumpFile
+		}
+		title := ""
+		var root *session.LayoutNode
+		focus := 0
+		if l := sess.LayoutNumbered(current); l != nil {
+			title, root, focus = l.Title, l.Root, l.Focus
+		}
+		if ctx.display != nil {
+			root, focus = ctx.display.regions().snapshot()
+		} else if title == "" {
+			return errors.New("no layout")
+		}
+		if err := appendLayoutDump(name, dumpLayout(title, root, focus)); err != nil {
+			return err
+		}
+		ctx.printf("Layout dumped to %s", name)
+	default:
+		return errors.New("usage: layout new|next|prev|select|save|remove|title|number|autosave|show|dump [arg]")
+	}
+	return nil
+}
+
+func cmdLock(ctx *CommandContext, args []string) error {
+	return lockScreen(ctx.display, ctx.display)
+}
+
+func cmdLog(ctx *CommandContext, args []string) error {
+	// Logging is configured when the session starts (-L, logfile)
+	if len(args) == 1 && args[0] != "on" && args[0] != "off" {
+		return errors.New("invalid argument")
+	}
+	return nil
+}
+
+func cmdNext(ctx *CommandContext, args []string) error {
+	ctx.view().Next()
+	return nil
+}
+
+func cmdMaxWin(ctx *CommandContext, args []string) error {
+	// maxwin [n]: windows already numbered n or above keep their numbers
+	if len(args) == 0 {
+		ctx.printf("maxwin is %d", ctx.Session.MaxWindowCount())
+		return nil
+	}
+	if ctx.Query {
+		return errors.New("cannot change maxwin in a query")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("maxwin: invalid number %s", args[0])
+	}
+	return ctx.Session.SetMaxWindows(n)
+}
+
+func cmdNumber(ctx *CommandContext, args []string) error {
+	// number [[+|-]n]: a window already numbered n swaps numbers
+	win := ctx.window()
+	if len(args) == 0 {
+		ctx.printf("%s (%s)", win.Number, windowTitle(win))
+		return nil
+	}
+	if ctx.Query {
+		return errors.New("cannot renumber in a query")
+	}
+	arg := args[0]
+	relative := strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-")
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("invalid window number %s", arg)
+	}
+	if relative {
+		n += win.ID
+	}
+	return ctx.Session.SetWindowNumber(win, n)
+}
+
+func cmdOnly(ctx *CommandContext, args []string) error {
+	ctx.display.regions().only()
+	return nil
+}
+
+func cmdOther(ctx *CommandContext, args []string) error {
+	ctx.view().ToggleLast()
+	return nil
+}
+
+func cmdPaste(ctx *CommandContext, args []string) error {
+	pasteContent := GetPasteBuffer()
+	if len(pasteContent) == 0 {
+		return nil
+	}
+	if ptyProc := ctx.window().GetPTYProcess(); ptyProc != nil {
+		_, err := ptyProc.Pty.Write(pasteContent)
+		return err
+	}
+	return nil
+}
+
+func cmdPrev(ctx *CommandContext, args []string) error {
+	ctx.view().Prev()
+	return nil
+}
+
+func cmdQuit(ctx *CommandContext, args []string) error {
+	// The server ends once the programs of all windows have exited
+	return session.Delete(ctx.Session.ID)
+}
+
+func cmdReadBuf(ctx *CommandContext, args []string) error {
+	return ReadPasteBufferFromFile(args[0])
+}
+
+func cmdRedisplay(ctx *CommandContext, args []string) error {
+	// The attach loop repaints the window when it resumes
+	return nil
+}
+
+func cmdRemove(ctx *CommandContext, args []string) error {
+	win, err := ctx.display.regions().remove()
+	if err != nil {
+		return err
+	}
+	showInFocus(ctx.view(), win)
+	return nil
+}
+
+func cmdResize(ctx *CommandContext, args []string) error {
+	// resize [-h|-v] [+|-]n|=|max|min
+	axis := ""
+	if len(args) == 2 {
+		switch args[0] {
+		case "-h", "-v":
+			axis = args[0][1:]
+		default:
+			return fmt.Errorf("unknown option %s", args[0])
+		}
+		args = args[1:]
+	}
+	return ctx.display.regions().resize(axis, args[0])
+}
+
+func cmdScreen(ctx *CommandContext, args []string) error {
+	// screen [-opts] [n] [cmd [args]]
+	title := ""
+	config := session.Config{}
+	if ctx.WindowConfig != nil {
+		config = *ctx.WindowConfig
+	}
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		opt := args[0]
+		args = args[1:]
+		switch opt {
+		case "-t", "-T", "-h":
+			if len(args) == 0 {
+				return fmt.Errorf("option %s requires an argument", opt)
+			}
+			value := args[0]
+			args = args[1:]
+			switch opt {
+			case "-t":
+				title = value
+			case "-T":
+				config.Term = value
+			case "-h":
+				lines, err := strconv.Atoi(value)
+				if err != nil || lines < 0 {
+					return fmt.Errorf("invalid scrollback size %s", value)
+				}
+				config.Scrollback = lines
+			}
+		case "-a", "-A", "-M", "-O", "-U", "-L", "-l", "-ln", "-fn", "-fa", "-f":
+			// Accepted for compatibility
+		default:
+			return fmt.Errorf("unknown option %s", opt)
+		}
+	}
+
+	// The window gets the number given, or the next higher free one
+	number := 0
+	if len(args) > 0 {
+		if num, err := strconv.Atoi(args[0]); err == nil && num >= 0 {
+			number = num
+			args = args[1:]
+		}
+	}
+
+	if len(args) > 0 && args[0] == "//group" {
+		_, err := ctx.view().CreateGroup(number, title)
+		return err
+	}
+
+	cmdPath := defaultShell()
+	var cmdArgs []string
+	if len(args) > 0 {
+		cmdPath = args[0]
+		cmdArgs = args[1:]
+	}
+	win, err := ctx.view().CreateWindowAt(number, cmdPath, cmdArgs, &config)
+	if err != nil {
+		return err
+	}
+	if title == "" && ctx.config != nil && ctx.config.ShellTitle != "" && len(args) == 0 {
+		title = ctx.config.ShellTitle
+	}
+	if title != "" {
+		ctx.Session.SetTitleOf(win, title)
+	}
+	return nil
+}
+
+func cmdSelect(ctx *CommandContext, args []string) error {
+	if ctx.Query {
+		// Only tell whether the window exists
+		if ctx.Session.FindWindow(args[0]) == nil {
+			return fmt.Errorf("window %s not found", args[0])
+		}
+		return nil
+	}
+	return ctx.view().SwitchTo(args[0])
+}
+
+func cmdSessionName(ctx *CommandContext, args []string) error {
+	if len(args) == 0 {
+		ctx.printf("This session is named '%s'", ctx.Session.ID)
+		return nil
+	}
+	if err := ctx.Session.Rename(args[0]); err != nil {
+		return err
+	}
+	ctx.printf("Session renamed to: %s", args[0])
+	return nil
+}
+
+func cmdSplit(ctx *CommandContext, args []string) error {
+	// split [-v]: -v splits into columns, side by side
+	vertical := false
+	if len(args) == 1 {
+		switch args[0] {
+		case "-v":
+			vertical = true
+		case "-h":
+		default:
+			return fmt.Errorf("unknown option %s", args[0])
+		}
+	}
+	return ctx.display.regions().split(vertical)
+}
+
+func cmdStuff(ctx *CommandContext, args []string) error {
+	// stuff [-d msec] string
+	var delay time.Duration
+	if len(args) == 3 && args[0] == "-d" {
+		msec, err := strconv.Atoi(args[1])
+		if err != nil || msec < 0 {
+			return fmt.Errorf("invalid delay %s", args[1])
+		}
+		delay = time.Duration(msec) * time.Millisecond
+		args = args[2:]
+	}
+	if len(args) != 1 {
+		return errors.New("usage: stuff [-d msec] string")
+	}
+	ptyProc := ctx.window().GetPTYProcess()
+	if ptyProc == nil || !ptyProc.IsAlive() {
+		return errors.New("window is not running")
+	}
+	input := unescapeString(args[0])
+	if delay == 0 {
+		_, err := ptyProc.Pty.Write(input)
+		return err
+	}
+	// Paced input, for programs that drop characters typed too fast
+	for i := range input {
+		if i > 0 {
+			time.Sleep(delay)
+		}
+		if _, err := ptyProc.Pty.Write(input[i : i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unescapeString interprets the escapes screen allows in strings such as
+// the argument of stuff: ^X for control characters (^? is DEL), \NNN for an
+// octal byte, and \n, \r, \t, \b, \a, \f and \e. A backslash before any other
+// character, such as ^ or \, stands for that character.
+func unescapeString(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '^' && i+1 < len(s):
+			i++
+			if s[i] == '?' {
+				out = append(out, 0x7f)
+			} else {
+				out = append(out, s[i]&0x1f)
+			}
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch c = s[i]; c {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'a':
+				out = append(out, '\a')
+			case 'f':
+				out = append(out, '\f')
+			case 'e':
+				out = append(out, 0x1b)
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				n := 0
+				for j := 0; j < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; j++ {
+					n = n*8 + int(s[i]-'0')
+					i++
+				}
+				i--
+				out = append(out, byte(n))
+			default:
+				out = append(out, c)
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func cmdTime(ctx *CommandContext, args []string) error {
+	ShowTimeLoad(ctx.display)
+	return waitForKey(ctx.display)
+}
+
+func cmdTitle(ctx *CommandContext, args []string) error {
+	if len(args) == 0 {
+		ctx.printf("%s", windowTitle(ctx.window()))
+		return nil
+	}
+	if ctx.Query {
+		return errors.New("cannot set the title in a query")
+	}
+	ctx.Session.SetTitleOf(ctx.window(), args[0])
+	return nil
+}
+
+func cmdVersion(ctx *CommandContext, args []string) error {
+	ShowVersion(ctx.display)
+	return waitForKey(ctx.display)
+}
+
+func cmdWait(ctx *CommandContext, args []string) error {
+	if ctx.display != nil {
+		return errors.New("only works with -X")
+	}
+	win := ctx.window()
+	for {
+		exited := win.Exited()
+		if status, _, ok := win.ExitState(); ok {
+			ctx.Status = status
+			return nil
+		}
+		if win.GetPTYProcess() == nil {
+			return errors.New("window has no program")
+		}
+		// Closed as well when exec replaces the program; then wait again
+		<-exited
+	}
+}
+
+func cmdZombie(ctx *CommandContext, args []string) error {
+	// zombie [keys]: without keys, dead windows go away again
+	keys := ""
+	if len(args) == 1 {
+		var err error
+		if keys, err = ParseZombieKeys(args[0]); err != nil {
+			return err
+		}
+	}
+	ctx.Session.SetZombie(keys)
+	return nil
+}
+
+// ParseZombieKeys parses the keys given to zombie: two characters, in the
+// notation of stuff, the first to close a dead window and the second to
+// respawn it.
+func ParseZombieKeys(arg string) (string, error) {
+	keys := unescapeString(arg)
+	if len(keys) != 2 {
+		return "", fmt.Errorf("keys must be two characters, not %q", arg)
+	}
+	return string(keys), nil
+}
+
+func cmdWindows(ctx *CommandContext, args []string) error {
+	sess := ctx.Session
+	view := ctx.view()
+	current, last := view.Current(), view.Last()
+	windows := sess.ListWindows()
+	entries := make([]string, 0, len(windows))
+	for _, win := range windows {
+		flag := ""
+		switch win {
+		case current:
+			flag = "*"
+		case last:
+			flag = "-"
+		}
+		entry := fmt.Sprintf("%s%s %s", win.Number, flag, windowPath(sess, win))
+		if status, _, ok := win.ExitState(); ok {
+			entry += fmt.Sprintf(" (exited %d)", status)
+		}
+		entries = append(entries, entry)
+	}
+	ctx.printf("%s", strings.Join(entries, "  "))
+	return nil
+}
+
+func cmdWriteBuf(ctx *CommandContext, args []string) error {
+	return WritePasteBufferToFile(args[0])
+}
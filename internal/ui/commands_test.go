@@ -0,0 +1,92 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/inoki/sgreen/internal/session"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	cases := map[string][]string{
+		`title build`:             {"title", "build"},
+		`  screen -t  "my logs" `: {"screen", "-t", "my logs"},
+		`stuff 'a \n b'`:          {"stuff", `a \n b`},
+		`stuff a\ b`:              {"stuff", "a b"},
+		`title ""`:                {"title", ""},
+		`stuff "make\r"`:          {"stuff", `make\r`},
+		`stuff "say \"hi\" \\"`:   {"stuff", `say "hi" \`},
+	}
+	for line, want := range cases {
+		got, err := parseCommandLine(line)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("parseCommandLine(%q) = %q, %v, want %q", line, got, err, want)
+		}
+	}
+	if _, err := parseCommandLine(`title "open`); err == nil {
+		t.Fatalf("parseCommandLine with an open quote: want an error")
+	}
+}
+
+func TestRunCommandErrors(t *testing.T) {
+	ctx := &CommandContext{Session: &session.Session{}}
+	cases := map[string][]string{
+		"unknown command 'frobnicate'":           {"frobnicate"},
+		"select: one argument required":          {"select"},
+		"next: no arguments allowed":             {"next", "2"},
+		"copy: display required":                 {"copy"},
+		"title: window required":                 {"title", "x"},
+		"acladd: at least one argument required": {"acladd"},
+		"layout: one to two arguments required":  {"layout"},
+	}
+	for want, args := range cases {
+		err := RunCommand(ctx, args)
+		if err == nil || err.Error() != want {
+			t.Fatalf("RunCommand(%q) = %v, want %q", args, err, want)
+		}
+	}
+}
+
+func TestUnescapeString(t *testing.T) {
+	cases := map[string]string{
+		"make test^M": "make test\r",
+		"^C^?^[":      "\x03\x7f\x1b",
+		`a\nb\tc\e`:   "a\nb\tc\x1b",
+		`\101\0\0123`: "A\x00\n3",
+		`\^M and \\`:  "^M and \\",
+		"trailing ^":  "trailing ^",
+		`trailing \`:  `trailing \`,
+	}
+	for in, want := range cases {
+		if got := string(unescapeString(in)); got != want {
+			t.Fatalf("unescapeString(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseKillGrace(t *testing.T) {
+	cases := map[string]time.Duration{
+		"2":     2 * time.Second,
+		"0.5":   500 * time.Millisecond,
+		"250ms": 250 * time.Millisecond,
+		"1m":    time.Minute,
+	}
+	for in, want := range cases {
+		if got, err := ParseKillGrace(in); err != nil || got != want {
+			t.Fatalf("ParseKillGrace(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"0", "-1s", "soon"} {
+		if _, err := ParseKillGrace(in); err == nil {
+			t.Fatalf("ParseKillGrace(%q): want an error", in)
+		}
+	}
+}
+
+func TestQueryRefusesOtherCommands(t *testing.T) {
+	ctx := &CommandContext{Session: &session.Session{}, Query: true}
+	if err := RunCommand(ctx, []string{"quit"}); err == nil || err.Error() != "quit: not a query command" {
+		t.Fatalf("RunCommand(quit) as a query = %v, want a refusal", err)
+	}
+}
@@ -1,14 +1,10 @@
 package ui
 
-import "github.com/inoki/sgreen/internal/session"
-
 // AttachConfig holds configuration for attaching to a session
 type AttachConfig struct {
 	CommandChar     byte              // Command character (default: 0x01 = Ctrl+A)
 	LiteralChar     byte              // Literal escape character (default: 'a')
 	AdaptSize       bool              // Adapt window sizes to new terminal size
-	Logging         bool              // Enable output logging
-	Logfile         string            // Log file path
 	Multiuser       bool              // Allow multiuser attach
 	OptimalOutput   bool              // Use optimal output mode
 	AllCapabilities bool              // Include all capabilities in termcap
@@ -23,12 +19,8 @@ type AttachConfig struct {
 	StartupMessage  bool              // Show startup message
 	Bell            bool              // Enable bell
 	VBell           bool              // Enable visual bell
-	ActivityMsg     string            // Activity message template
-	SilenceMsg      string            // Silence message template
-	SilenceTimeout  int               // Silence timeout in seconds
 	Bindings        map[string]string // Custom key bindings (key -> command)
 	ShellTitle      string            // Shell title format
-	OnDetach        func(*session.Session)
 }
 
 // DefaultAttachConfig returns default attach configuration
@@ -37,7 +29,6 @@ func DefaultAttachConfig() *AttachConfig {
 		CommandChar:     0x01, // Ctrl+A
 		LiteralChar:     'a',
 		AdaptSize:       false,
-		Logging:         false,
 		Multiuser:       false,
 		OptimalOutput:   false,
 		AllCapabilities: false,
@@ -2,11 +2,10 @@ package ui
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"sync"
 
-	"golang.org/x/term"
-
 	"github.com/inoki/sgreen/internal/session"
 )
 
@@ -54,21 +53,14 @@ func GetPasteBuffer() []byte {
 	return result
 }
 
-// EnterCopyMode enters copy mode for a window
-func EnterCopyMode(win *session.Window, termFile *os.File, scrollback *ScrollbackBuffer) error {
-	if scrollback == nil || scrollback.Size() == 0 {
+// EnterCopyMode enters copy mode for a window, on a copy of the window's
+// history and screen contents.
+func EnterCopyMode(win *session.Window, in io.Reader, out io.Writer) error {
+	scrollback := windowScrollback(win)
+	if scrollback.Size() == 0 {
 		return fmt.Errorf("no scrollback available")
 	}
 
-	// Save terminal state
-	oldState, err := term.MakeRaw(int(termFile.Fd()))
-	if err != nil {
-		return err
-	}
-	defer func() {
-		_ = term.Restore(int(termFile.Fd()), oldState)
-	}()
-
 	// Initialize copy mode
 	cm := &CopyMode{
 		buffer:        scrollback,
@@ -87,19 +79,19 @@ func EnterCopyMode(win *session.Window, termFile *os.File, scrollback *Scrollbac
 	}
 
 	// Enter copy mode loop
-	return cm.run(termFile)
+	return cm.run(in, out)
 }
 
 // run executes the copy mode interaction loop
-func (cm *CopyMode) run(termFile *os.File) error {
+func (cm *CopyMode) run(in io.Reader, out io.Writer) error {
 	// Display copy mode prompt
-	_, _ = fmt.Fprint(termFile, "\r\n[Copy mode - Use arrow keys to navigate, Space to mark, Enter to copy, / to search, q to quit]\r\n")
+	_, _ = fmt.Fprint(out, "\r\n[Copy mode - Use arrow keys to navigate, Space to mark, Enter to copy, / to search, q to quit]\r\n")
 
 	buf := make([]byte, 1)
 	searchInput := make([]byte, 0, 256)
 
 	for {
-		n, err := termFile.Read(buf)
+		n, err := in.Read(buf)
 		if err != nil || n == 0 {
 			return err
 		}
@@ -113,25 +105,25 @@ func (cm *CopyMode) run(termFile *os.File) error {
 				cm.executeSearch(string(searchInput))
 				cm.searchMode = false
 				searchInput = searchInput[:0]
-				cm.updateDisplay(termFile)
+				cm.updateDisplay(out)
 				continue
 			} else if key == 0x1b || key == 0x03 { // ESC or Ctrl+C
 				// Cancel search
 				cm.searchMode = false
 				searchInput = searchInput[:0]
-				cm.updateDisplay(termFile)
+				cm.updateDisplay(out)
 				continue
 			} else if key == '\b' || key == 0x7f {
 				// Backspace in search
 				if len(searchInput) > 0 {
 					searchInput = searchInput[:len(searchInput)-1]
-					_, _ = fmt.Fprint(termFile, "\b \b")
+					_, _ = fmt.Fprint(out, "\b \b")
 				}
 				continue
 			} else if key >= 32 && key < 127 {
 				// Add to search input
 				searchInput = append(searchInput, key)
-				_, _ = fmt.Fprint(termFile, string(key))
+				_, _ = fmt.Fprint(out, string(key))
 				continue
 			}
 		}
@@ -143,7 +135,7 @@ func (cm *CopyMode) run(termFile *os.File) error {
 			seq = append(seq, key)
 			for i := 0; i < 10; i++ {
 				b := make([]byte, 1)
-				if n, _ := termFile.Read(b); n > 0 {
+				if n, _ := in.Read(b); n > 0 {
 					seq = append(seq, b[0])
 					if b[0] >= 0x40 && b[0] <= 0x7E {
 						break
@@ -176,7 +168,7 @@ func (cm *CopyMode) run(termFile *os.File) error {
 			// Enter search mode
 			cm.searchMode = true
 			searchInput = searchInput[:0]
-			_, _ = fmt.Fprint(termFile, "\r\nSearch: ")
+			_, _ = fmt.Fprint(out, "\r\nSearch: ")
 			continue
 		case 'n', 'N':
 			// Next search result
@@ -205,7 +197,7 @@ func (cm *CopyMode) run(termFile *os.File) error {
 		}
 
 		// Update display
-		cm.updateDisplay(termFile)
+		cm.updateDisplay(out)
 	}
 }
 
@@ -379,7 +371,7 @@ func (cm *CopyMode) executeSearch(term string) {
 }
 
 // updateDisplay updates the copy mode display
-func (cm *CopyMode) updateDisplay(termFile *os.File) {
+func (cm *CopyMode) updateDisplay(out io.Writer) {
 	// Simple display - show current position
 	line := cm.buffer.GetLine(cm.currentLine)
 	lineStr := string(line)
@@ -394,7 +386,7 @@ func (cm *CopyMode) updateDisplay(termFile *os.File) {
 	if len(status) > 80 {
 		status = status[:77] + "..."
 	}
-	_, _ = fmt.Fprint(termFile, status)
+	_, _ = fmt.Fprint(out, status)
 }
 
 // WritePasteBufferToFile writes the paste buffer to a file
@@ -0,0 +1,235 @@
+package ui
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/inoki/sgreen/internal/session"
+)
+
+// errReadInterrupted is returned by an interruptible read when its stop
+// channel is closed before any input arrived.
+var errReadInterrupted = errors.New("read interrupted")
+
+// Display is a terminal attached to a session. The session server creates
+// one per connected client: keyboard input is pushed in with Feed, and
+// everything the UI writes goes to the client's terminal.
+type Display struct {
+	out     io.Writer
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	width   int
+	height  int
+	pending []byte
+	// Messages for the user, shown on the last row
+	messages []string
+	// Regions the display is split into
+	canvas *canvas
+	// The display's own current and last window
+	view *session.View
+	// Set when another display power detached this one
+	power bool
+
+	input      chan []byte
+	resized    chan struct{}
+	hangup     chan struct{}
+	hangupOnce sync.Once
+
+	// OnSuspend is called when the user asks to suspend the display (C-a s).
+	OnSuspend func()
+	// Monitor, if set, supplies the notifications raised by the session's
+	// windows, including those raised while no display was attached. It
+	// also knows the other displays of the session, for the displays list.
+	Monitor *Monitor
+	// Client describes the terminal of the display, for the displays list.
+	Client session.Client
+}
+
+// NewDisplay creates a display writing to out with the given terminal size.
+func NewDisplay(out io.Writer, width, height int) *Display {
+	return &Display{
+		out:     out,
+		width:   width,
+		height:  height,
+		input:   make(chan []byte, 16),
+		resized: make(chan struct{}, 1),
+		hangup:  make(chan struct{}),
+		canvas:  newCanvas(),
+	}
+}
+
+// Feed queues keyboard input received from the client.
+func (d *Display) Feed(p []byte) {
+	data := make([]byte, len(p))
+	copy(data, p)
+	select {
+	case d.input <- data:
+	case <-d.hangup:
+	}
+}
+
+// Resize records a new terminal size and notifies the attach loop.
+func (d *Display) Resize(width, height int) {
+	d.mu.Lock()
+	d.width, d.height = width, height
+	d.mu.Unlock()
+	select {
+	case d.resized <- struct{}{}:
+	default:
+	}
+}
+
+// Size returns the terminal size of the display.
+func (d *Display) Size() (width, height int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.width, d.height
+}
+
+// Hangup marks the display as disconnected. Pending and future reads
+// return io.EOF.
+func (d *Display) Hangup() {
+	d.hangupOnce.Do(func() {
+		close(d.hangup)
+	})
+}
+
+// detach hangs up the display for another one detaching it. Its attach
+// loop then ends with ErrDetach, or with power with ErrPowerDetach.
+func (d *Display) detach(power bool) {
+	d.mu.Lock()
+	d.power = d.power || power
+	d.mu.Unlock()
+	d.Hangup()
+}
+
+// hangupError returns the error the attach loop of a hung up display ends
+// with.
+func (d *Display) hangupError() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.power {
+		return ErrPowerDetach
+	}
+	return ErrDetach
+}
+
+// viewOf returns the view display d has of sess: the current and last
+// window of the display, which switches windows independently of the other
+// displays of the session.
+func (d *Display) viewOf(sess *session.Session) *session.View {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.view == nil || d.view.Session() != sess {
+		d.view = sess.NewView()
+	}
+	return d.view
+}
+
+// viewFor returns the view of sess that commands writing to out act on:
+// that of the display if out is one, or else that of the session.
+func viewFor(out io.Writer, sess *session.Session) *session.View {
+	if d, ok := out.(*Display); ok {
+		return d.viewOf(sess)
+	}
+	return sess.View()
+}
+
+// postMessage queues a message to show on the last row of the display.
+func (d *Display) postMessage(msg string) {
+	d.mu.Lock()
+	d.messages = append(d.messages, msg)
+	d.mu.Unlock()
+}
+
+// takeMessages returns the messages waiting to be shown.
+func (d *Display) takeMessages() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	messages := d.messages
+	d.messages = nil
+	return messages
+}
+
+// hungUp reports whether the display has been disconnected.
+func (d *Display) hungUp() bool {
+	select {
+	case <-d.hangup:
+		return true
+	default:
+		return false
+	}
+}
+
+// Write sends output to the client's terminal.
+func (d *Display) Write(p []byte) (int, error) {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	return d.out.Write(p)
+}
+
+// Read reads keyboard input, blocking until some is available.
+func (d *Display) Read(p []byte) (int, error) {
+	return d.read(p, nil)
+}
+
+// interruptible returns a reader over the display input whose blocked reads
+// return errReadInterrupted once stop is closed, without losing input.
+func (d *Display) interruptible(stop <-chan struct{}) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		return d.read(p, stop)
+	})
+}
+
+func (d *Display) read(p []byte, stop <-chan struct{}) (int, error) {
+	// A closed stop channel wins over available input, so that a stale
+	// reader never consumes keys meant for the next one.
+	select {
+	case <-stop:
+		return 0, errReadInterrupted
+	default:
+	}
+
+	d.mu.Lock()
+	if len(d.pending) > 0 {
+		n := copy(p, d.pending)
+		d.pending = d.pending[n:]
+		d.mu.Unlock()
+		return n, nil
+	}
+	d.mu.Unlock()
+
+	select {
+	case data := <-d.input:
+		n := copy(p, data)
+		if n < len(data) {
+			d.mu.Lock()
+			d.pending = append(d.pending, data[n:]...)
+			d.mu.Unlock()
+		}
+		return n, nil
+	case <-d.hangup:
+		return 0, io.EOF
+	case <-stop:
+		return 0, errReadInterrupted
+	}
+}
+
+// readerFunc adapts a function to io.Reader.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// terminalSize returns the size of out if it is a Display, or 80x24.
+func terminalSize(out io.Writer) (width, height int) {
+	if d, ok := out.(*Display); ok {
+		if w, h := d.Size(); w > 0 && h > 0 {
+			return w, h
+		}
+	}
+	return 80, 24
+}
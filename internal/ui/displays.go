@@ -0,0 +1,95 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/inoki/sgreen/internal/session"
+)
+
+// The displays list shows every display attached to a session, like the
+// displays command of GNU screen, and lets the owner of the session detach
+// one of them.
+
+// sessionDisplays returns the displays attached to the session of d, d
+// among them.
+func sessionDisplays(d *Display) []*Display {
+	if d.Monitor != nil {
+		if displays := d.Monitor.attachedDisplays(); len(displays) > 0 {
+			return displays
+		}
+	}
+	return []*Display{d}
+}
+
+// displayEntry returns the line of the displays list for d: user, tty,
+// terminal size, current window, attach time and r/w flags.
+func displayEntry(d *Display, sess *session.Session) string {
+	user, tty := d.Client.User, d.Client.Tty
+	if user == "" {
+		user = "?"
+	}
+	if tty == "" {
+		tty = "?"
+	}
+	width, height := d.Size()
+	window := "-"
+	if win := d.viewOf(sess).Current(); win != nil {
+		window = win.Number + " " + windowTitle(win)
+	}
+	attached := "-"
+	if !d.Client.AttachedAt.IsZero() {
+		attached = d.Client.AttachedAt.Format("2006-01-02 15:04")
+	}
+	flags := "rw"
+	if d.Client.ReadOnly {
+		flags = "r-"
+	}
+	return fmt.Sprintf("%-10s %-14s %7s  %-16s %-16s  %s", user, tty, fmt.Sprintf("%dx%d", width, height), window, attached, flags)
+}
+
+// selectDisplay shows the displays attached to sess on d and reads which
+// one to detach: a number followed by d, or D for a power detach. It
+// returns a nil display when the list is left without one.
+func selectDisplay(d *Display, sess *session.Session) (target *Display, power bool, err error) {
+	displays := sessionDisplays(d)
+	_, _ = fmt.Fprint(d, "\r\nDisplays (number, then d to detach or D to power detach):\r\n")
+	_, _ = fmt.Fprintf(d, "     %-10s %-14s %7s  %-16s %-16s  %s\r\n", "user", "tty", "size", "window", "attached", "flags")
+	for i, other := range displays {
+		marker := " "
+		if other == d {
+			marker = "*"
+		}
+		_, _ = fmt.Fprintf(d, "%s %2d  %s\r\n", marker, i, displayEntry(other, sess))
+	}
+	_, _ = fmt.Fprint(d, "\r\nDisplay (Enter to leave): ")
+
+	buf := make([]byte, 1)
+	var input []byte
+	for {
+		n, err := d.Read(buf)
+		if err != nil || n == 0 {
+			return nil, false, nil
+		}
+		switch b := buf[0]; {
+		case b == '\r' || b == '\n' || b == 0x1b || b == 'q':
+			_, _ = fmt.Fprint(d, "\r\n")
+			return nil, false, nil
+		case b == '\b' || b == 0x7f:
+			if len(input) > 0 {
+				input = input[:len(input)-1]
+				_, _ = fmt.Fprint(d, "\b \b")
+			}
+		case b >= '0' && b <= '9':
+			input = append(input, b)
+			_, _ = fmt.Fprint(d, string(b))
+		case b == 'd' || b == 'D':
+			_, _ = fmt.Fprint(d, "\r\n")
+			i, err := strconv.Atoi(string(input))
+			if err != nil || i >= len(displays) {
+				return nil, false, fmt.Errorf("no display %s", input)
+			}
+			return displays[i], b == 'D', nil
+		}
+	}
+}
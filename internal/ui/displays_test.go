@@ -0,0 +1,55 @@
+package ui
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inoki/sgreen/internal/session"
+)
+
+func TestDisplaysDetachChosenDisplay(t *testing.T) {
+	sess := &session.Session{Owner: "alice"}
+	m := &Monitor{sess: sess}
+	attached := time.Date(2026, 10, 16, 9, 30, 0, 0, time.Local)
+	var displays []*Display
+	for _, user := range []string{"alice", "bob", "carol"} {
+		d := NewDisplay(io.Discard, 80, 24)
+		d.Monitor = m
+		d.Client = session.Client{User: user, Tty: "/dev/pts/" + user, AttachedAt: attached}
+		m.addDisplay(d)
+		displays = append(displays, d)
+	}
+	alice, bob, carol := displays[0], displays[1], displays[2]
+	carol.Client.ReadOnly = true
+	carol.Resize(100, 30)
+
+	want := "carol      /dev/pts/carol  100x30  -                2026-10-16 09:30  r-"
+	if got := displayEntry(carol, sess); got != want {
+		t.Fatalf("displayEntry = %q, want %q", got, want)
+	}
+
+	// Only the owner detaches other displays
+	bob.Feed([]byte("0d"))
+	if err := runCommandLine(bob, sess, nil, "displays"); err != nil {
+		t.Fatalf("displays: %v", err)
+	}
+	if msgs := bob.takeMessages(); alice.hungUp() || len(msgs) != 1 || !strings.Contains(msgs[0], "owner") {
+		t.Fatalf("bob detached alice, messages %q", msgs)
+	}
+	alice.Feed([]byte("2D"))
+	if err := runCommandLine(alice, sess, nil, "displays"); err != nil {
+		t.Fatalf("displays: %v", err)
+	}
+	if !carol.hungUp() || !errors.Is(carol.hangupError(), ErrPowerDetach) || bob.hungUp() {
+		t.Fatalf("want carol power detached, and bob still attached")
+	}
+
+	// A display detaching itself leaves the list with ErrDetach
+	bob.Feed([]byte("1d"))
+	if err := runCommandLine(bob, sess, nil, "displays"); !errors.Is(err, ErrDetach) || errors.Is(err, ErrPowerDetach) {
+		t.Fatalf("displays on bob itself = %v, want ErrDetach", err)
+	}
+}
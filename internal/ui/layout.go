@@ -0,0 +1,161 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/inoki/sgreen/internal/session"
+)
+
+// Layouts keep the regions of a display, and the window of each region, in
+// the session, like the layouts of GNU screen. A display shows at most one
+// layout; its regions go back into that layout, if autosave is on, when the
+// display switches to another layout or detaches.
+
+// layoutDumpFile is the file layout dump appends to by default
+const layoutDumpFile = "layout-dump"
+
+// saveLayout stores the regions of display d in the layout it shows, when
+// the layout has autosave on or force is set.
+func saveLayout(d *Display, sess *session.Session, force bool) error {
+	n := d.canvas.currentLayout()
+	l := sess.LayoutNumbered(n)
+	if l == nil {
+		if force {
+			return errors.New("no layout")
+		}
+		return nil
+	}
+	if !l.Autosave && !force {
+		return nil
+	}
+	root, focus := d.regions().snapshot()
+	return sess.SaveLayoutRegions(n, root, focus)
+}
+
+// showLayout saves the layout display d shows and switches it to l.
+func showLayout(d *Display, sess *session.Session, l *session.Layout) error {
+	if err := saveLayout(d, sess, false); err != nil {
+		return err
+	}
+	c := d.regions()
+	view := d.viewOf(sess)
+	win := c.restore(l.Root, l.Focus, view)
+	c.setLayout(l.Number)
+	sess.SetLastLayout(l.Number)
+	showInFocus(view, win)
+	return nil
+}
+
+// cycleLayout shows the layout after, or with back before, the one display
+// d shows.
+func cycleLayout(d *Display, sess *session.Session, back bool) error {
+	layouts := sess.LayoutsByNumber()
+	if len(layouts) == 0 {
+		return errors.New("no layouts defined")
+	}
+	cur := d.canvas.currentLayout()
+	i := -1
+	for j, l := range layouts {
+		if l.Number == cur {
+			i = j
+		}
+	}
+	switch {
+	case i < 0 && back:
+		i = len(layouts) - 1
+	case i < 0:
+		i = 0
+	case back:
+		i = (i + len(layouts) - 1) % len(layouts)
+	default:
+		i = (i + 1) % len(layouts)
+	}
+	if layouts[i].Number == cur {
+		return errors.New("this is the only layout")
+	}
+	return showLayout(d, sess, layouts[i])
+}
+
+// listLayouts returns the layouts as layout show prints them: number, a *
+// marking the current one, and title.
+func listLayouts(layouts []*session.Layout, current int) string {
+	items := make([]string, 0, len(layouts))
+	for _, l := range layouts {
+		flag := ""
+		if l.Number == current {
+			flag = "*"
+		}
+		items = append(items, fmt.Sprintf("%d%s %s", l.Number, flag, l.Title))
+	}
+	return strings.Join(items, "  ")
+}
+
+// dumpLayout returns screen commands that recreate a layout titled title
+// with the region tree root, focused on region focus: a screenrc fragment.
+// Windows are selected by decimal number, as GNU screen numbers them.
+func dumpLayout(title string, root *session.LayoutNode, focus int) string {
+	var b strings.Builder
+	if title != "" {
+		fmt.Fprintf(&b, "layout new %s\n", quoteCommandWord(title))
+	}
+	if root == nil {
+		root = &session.LayoutNode{}
+	}
+	dumpLayoutNode(&b, root)
+	b.WriteString("focus top\n")
+	for i := 0; i < focus; i++ {
+		b.WriteString("focus next\n")
+	}
+	return b.String()
+}
+
+// dumpLayoutNode writes the commands that split the focused region like
+// node, leaving the focus on its last region.
+func dumpLayoutNode(b *strings.Builder, node *session.LayoutNode) {
+	if len(node.Children) == 0 {
+		if node.Window != nil {
+			fmt.Fprintf(b, "select %d\n", *node.Window)
+		}
+		return
+	}
+	split, axis := "split", "-v"
+	if node.Vertical {
+		split, axis = "split -v", "-h"
+	}
+	for range node.Children[1:] {
+		b.WriteString(split + "\n")
+	}
+	for i, child := range node.Children {
+		if i > 0 {
+			b.WriteString("focus next\n")
+		}
+		if i < len(node.Children)-1 && child.Size > 0 {
+			fmt.Fprintf(b, "resize %s %d\n", axis, child.Size)
+		}
+		dumpLayoutNode(b, child)
+	}
+}
+
+// quoteCommandWord quotes s for a command line if it needs it.
+func quoteCommandWord(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// appendLayoutDump appends a dump of a layout to the file name.
+func appendLayoutDump(name, dump string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(dump); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
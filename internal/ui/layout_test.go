@@ -0,0 +1,61 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/inoki/sgreen/internal/session"
+)
+
+func TestLayoutSnapshotRestore(t *testing.T) {
+	c := newCanvas()
+	c.setSize(80, 24)
+	if err := c.split(false); err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	if err := c.split(true); err != nil {
+		t.Fatalf("split -v: %v", err)
+	}
+	if err := c.resize("h", "+10"); err != nil {
+		t.Fatalf("resize: %v", err)
+	}
+	if _, err := c.moveFocus("bottom"); err != nil {
+		t.Fatalf("focus: %v", err)
+	}
+	root, focus := c.snapshot()
+	if focus != 2 {
+		t.Fatalf("focus = %d, want 2", focus)
+	}
+
+	restored := newCanvas()
+	restored.setSize(80, 24)
+	restored.restore(root, focus, (&session.Session{}).View())
+	checkGeometry(t, restored, [4]int{0, 0, 49, 12}, [4]int{50, 0, 30, 12}, [4]int{0, 12, 80, 12})
+	if restored.focus != leaves(restored.root, nil)[2] {
+		t.Fatalf("restored focus at %d,%d, want the bottom region", restored.focus.x, restored.focus.y)
+	}
+}
+
+func TestDumpLayout(t *testing.T) {
+	one, two := 1, 2
+	root := &session.LayoutNode{Children: []*session.LayoutNode{
+		{Size: 12, Vertical: true, Children: []*session.LayoutNode{
+			{Size: 49, Window: &one},
+			{Size: 30},
+		}},
+		{Size: 12, Window: &two},
+	}}
+	want := "layout new 'my layout'\n" +
+		"split\n" +
+		"resize -v 12\n" +
+		"split -v\n" +
+		"resize -h 49\n" +
+		"select 1\n" +
+		"focus next\n" +
+		"focus next\n" +
+		"select 2\n" +
+		"focus top\n" +
+		"focus next\n"
+	if got := dumpLayout("my layout", root, 1); got != want {
+		t.Fatalf("dump =\n%s\nwant\n%s", got, want)
+	}
+}
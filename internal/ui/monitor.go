@@ -0,0 +1,276 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/inoki/sgreen/internal/session"
+)
+
+// defaultBellMsg is shown for a bell in a window that is not on display
+const defaultBellMsg = "Bell in window %n"
+
+// MonitorConfig holds what is recorded about a session's windows
+type MonitorConfig struct {
+	Logging        bool   // Log the output of each window
+	Logfile        string // Log the output of all windows to this file
+	ActivityMsg    string // Activity message template
+	SilenceMsg     string // Silence message template
+	SilenceTimeout int    // Silence timeout in seconds
+}
+
+// notice is a notification waiting to be shown on a display
+type notice struct {
+	message string
+	bell    bool // Ring the display's bell with the message
+}
+
+// Monitor records the output of a session's windows whether or not a
+// display is attached: it writes the logs and raises activity, silence and
+// bell notifications. Notifications wait until a display shows them.
+type Monitor struct {
+	sess     *session.Session
+	activity *ActivityMonitor
+	silence  *SilenceMonitor
+	logs     *PerWindowLogWriter
+	logfile  *LogWriter
+
+	mu        sync.Mutex
+	displays  []*Display   // Attached displays
+	watched   map[int]bool // Windows registered with the activity and silence monitors
+	announced map[int]bool // Windows with activity not yet seen on a display
+	pending   []notice
+	notify    chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMonitor starts recording the windows of sess as described by config.
+func NewMonitor(sess *session.Session, config *MonitorConfig) *Monitor {
+	if config == nil {
+		config = &MonitorConfig{}
+	}
+	m := &Monitor{
+		sess:      sess,
+		activity:  NewActivityMonitor(config.ActivityMsg),
+		silence:   NewSilenceMonitor(config.SilenceMsg, time.Duration(config.SilenceTimeout)*time.Second),
+		watched:   make(map[int]bool),
+		announced: make(map[int]bool),
+		notify:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	// Determine log directory for per-window logging
+	if config.Logging {
+		logDir := ""
+		if config.Logfile != "" {
+			logDir = filepath.Dir(config.Logfile)
+		} else if homeDir, _ := os.UserHomeDir(); homeDir != "" {
+			logDir = filepath.Join(homeDir, ".sgreen", "logs")
+			if err := os.MkdirAll(logDir, 0755); err != nil {
+				logDir = ""
+			}
+		}
+		if logDir != "" {
+			m.logs = NewPerWindowLogWriter(logDir, true) // timestamp enabled
+		}
+	}
+	if config.Logfile != "" {
+		if logWriter, err := NewLogWriter(config.Logfile, true); err == nil {
+			m.logfile = logWriter
+		}
+	}
+
+	if config.ActivityMsg != "" {
+		m.activity.Enable()
+	}
+	if config.SilenceMsg != "" && config.SilenceTimeout > 0 {
+		m.silence.Enable()
+		m.silence.StartMonitoring(m.displayedWindow)
+	}
+	go m.run()
+
+	sess.SetWindowOutputHandler(m.windowOutput)
+	return m
+}
+
+// Close stops recording and closes the logs.
+func (m *Monitor) Close() error {
+	m.closeOnce.Do(func() {
+		m.sess.SetWindowOutputHandler(nil)
+		m.silence.Disable()
+		close(m.done)
+	})
+	var err error
+	if m.logs != nil {
+		err = m.logs.Close()
+	}
+	if m.logfile != nil {
+		if closeErr := m.logfile.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// run turns activity and silence events into notifications.
+func (m *Monitor) run() {
+	for {
+		select {
+		case <-m.done:
+			return
+		case winID := <-m.activity.GetActivityChannel():
+			if win := m.findWindow(winID); win != nil {
+				m.post(notice{message: FormatMessage(m.activity.GetMessage(), win), bell: true})
+			}
+		case winID := <-m.silence.GetSilenceChannel():
+			if win := m.findWindow(winID); win != nil {
+				m.post(notice{message: FormatMessage(m.silence.GetMessage(), win)})
+			}
+		}
+	}
+}
+
+// windowOutput is called by the session for all output of its windows.
+func (m *Monitor) windowOutput(win *session.Window, p []byte, bell bool) {
+	id, _, title := win.Ident()
+	if m.logs != nil {
+		if writer, err := m.logs.GetWriter(id, title); err == nil {
+			_, _ = writer.Write(p)
+		}
+	}
+	if m.logfile != nil {
+		_, _ = m.logfile.Write(p)
+	}
+
+	m.mu.Lock()
+	watch := !m.watched[id]
+	m.watched[id] = true
+	displayed := m.displayedLocked(win)
+	report := !displayed && !m.announced[id]
+	if displayed {
+		m.announced[id] = false
+	} else {
+		m.announced[id] = true
+	}
+	m.mu.Unlock()
+
+	// The silence monitor calls back into m, so m.mu is not held here
+	if watch {
+		m.activity.MonitorWindow(id)
+		m.silence.MonitorWindow(id)
+	}
+	m.silence.RecordActivity(id)
+	if report {
+		m.activity.RecordActivity(id)
+	}
+	// A bell in a displayed window reaches the display with the output
+	if bell && !displayed {
+		m.post(notice{message: FormatMessage(defaultBellMsg, win), bell: true})
+	}
+}
+
+// displayedLocked reports whether win is the current window of a display.
+func (m *Monitor) displayedLocked(win *session.Window) bool {
+	for _, d := range m.displays {
+		if d.viewOf(m.sess).Current() == win {
+			return true
+		}
+	}
+	return false
+}
+
+// displayedWindow reports whether the window numbered id is the current
+// window of a display.
+func (m *Monitor) displayedWindow(id int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.displays {
+		if win := d.viewOf(m.sess).Current(); win != nil {
+			if current, _, _ := win.Ident(); current == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *Monitor) findWindow(id int) *session.Window {
+	return m.sess.WindowNumbered(id)
+}
+
+func (m *Monitor) post(n notice) {
+	m.mu.Lock()
+	m.pending = append(m.pending, n)
+	m.mu.Unlock()
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+}
+
+// addDisplay registers an attached display. The returned channel is
+// signalled when notifications are waiting; leave unregisters the display.
+func (m *Monitor) addDisplay(d *Display) (notify <-chan struct{}, leave func()) {
+	m.mu.Lock()
+	m.displays = append(m.displays, d)
+	m.mu.Unlock()
+	return m.notify, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i, other := range m.displays {
+			if other == d {
+				m.displays = append(m.displays[:i], m.displays[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// attachedDisplays returns the displays attached to the session, in the
+// order they attached.
+func (m *Monitor) attachedDisplays() []*Display {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Display(nil), m.displays...)
+}
+
+// takeNotices returns the notifications waiting to be shown.
+func (m *Monitor) takeNotices() []notice {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending := m.pending
+	m.pending = nil
+	return pending
+}
+
+// showNotices shows the messages waiting for d and the notifications of m
+// on the last row of d, keeping the cursor where it was.
+func showNotices(d *Display, m *Monitor, config *AttachConfig) {
+	for _, msg := range d.takeMessages() {
+		showStatusMessage(d, msg)
+	}
+	if m == nil {
+		return
+	}
+	for _, n := range m.takeNotices() {
+		showStatusMessage(d, n.message)
+		if n.bell && (config.Bell || config.VBell) {
+			ShowBell(d, !config.Bell)
+		}
+	}
+}
+
+// showStatusMessage shows msg in reverse video on the last row of d,
+// keeping the cursor where it was.
+func showStatusMessage(d *Display, msg string) {
+	_, height := terminalSize(d)
+	_, _ = fmt.Fprint(d, "\x1b7")
+	MoveCursor(d, height, 1)
+	ClearLine(d)
+	_, _ = fmt.Fprintf(d, "\x1b[7m%s\x1b[0m", msg)
+	_, _ = fmt.Fprint(d, "\x1b8")
+}
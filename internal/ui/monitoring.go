@@ -158,8 +158,9 @@ func (sm *SilenceMonitor) RecordActivity(windowID int) {
 	sm.lastActivity[windowID] = time.Now()
 }
 
-// StartMonitoring starts the silence monitoring loop
-func (sm *SilenceMonitor) StartMonitoring(currentWindowID func() int) {
+// StartMonitoring starts the silence monitoring loop. Windows for which
+// displayed reports true are not monitored.
+func (sm *SilenceMonitor) StartMonitoring(displayed func(windowID int) bool) {
 	go func() {
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
@@ -171,12 +172,11 @@ func (sm *SilenceMonitor) StartMonitoring(currentWindowID func() int) {
 				continue
 			}
 
-			currentWin := currentWindowID()
 			now := time.Now()
 
 			for winID := range sm.monitoredWindows {
-				if winID == currentWin {
-					// Don't monitor current window
+				if displayed(winID) {
+					// Don't monitor displayed windows
 					continue
 				}
 
@@ -219,6 +219,8 @@ func (sm *SilenceMonitor) GetMessage() string {
 
 // FormatMessage formats a message template with window information
 func FormatMessage(template string, win *session.Window) string {
+	_, number, title := win.Ident()
+	cmdPath, _ := win.Command()
 	result := ""
 	i := 0
 	for i < len(template) {
@@ -226,13 +228,13 @@ func FormatMessage(template string, win *session.Window) string {
 			switch template[i+1] {
 			case 'n':
 				// Window number
-				result += win.Number
+				result += number
 			case 't':
 				// Window title
-				if win.Title != "" {
-					result += win.Title
+				if title != "" {
+					result += title
 				} else {
-					result += win.CmdPath
+					result += cmdPath
 				}
 			case 'G':
 				// Bell character
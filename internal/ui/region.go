@@ -0,0 +1,775 @@
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/inoki/sgreen/internal/session"
+)
+
+// Regions split a display to show several windows at once, like the regions
+// of GNU screen. The regions of a display form its canvas: a tree whose
+// inner nodes split their area into rows or into side-by-side columns, and
+// whose leaves are the regions. Each region shows one window, or nothing,
+// above a caption naming it.
+
+const (
+	minRegionWidth  = 1
+	minRegionHeight = 2 // One row of the window and the caption
+)
+
+// region is a node of a canvas: a split when it has children, a region
+// showing a window otherwise.
+type region struct {
+	parent   *region
+	children []*region
+	vertical bool            // The children of a split are side by side
+	size     int             // Rows or columns taken in the parent split
+	window   *session.Window // Window shown in a region, nil when blank
+
+	// Area on the display, set by layout
+	x, y, width, height int
+}
+
+// canvas is the set of regions of a display. It is safe for concurrent use.
+type canvas struct {
+	mu            sync.Mutex
+	root          *region
+	focus         *region
+	width, height int
+	// shown is the current window of the session as last put in the
+	// focused region; when the session switches windows, the new current
+	// window moves to the focused region.
+	shown *session.Window
+	// layout is the number of the layout the canvas shows, -1 for none
+	layout int
+	// dirty asks the attach loop to repaint the regions
+	dirty chan struct{}
+}
+
+func newCanvas() *canvas {
+	root := &region{}
+	return &canvas{root: root, focus: root, layout: -1, dirty: make(chan struct{}, 1)}
+}
+
+// isSplit reports whether the canvas has more than one region.
+func (c *canvas) isSplit() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.root.children != nil
+}
+
+// markDirty asks for a repaint of the regions.
+func (c *canvas) markDirty() {
+	select {
+	case c.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// setSize lays the regions out on a display of width by height.
+func (c *canvas) setSize(width, height int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.width, c.height = width, height
+	c.layoutLocked()
+}
+
+func (c *canvas) layoutLocked() {
+	if c.width <= 0 || c.height <= 0 {
+		return
+	}
+	layoutRegion(c.root, 0, 0, c.width, c.height)
+}
+
+// layoutRegion places r and its children in the given area. The columns
+// of a vertical split are separated by a column of their own. On a display
+// too small for the splits, some regions get no room at all.
+func layoutRegion(r *region, x, y, width, height int) {
+	width, height = max(width, 0), max(height, 0)
+	r.x, r.y, r.width, r.height = x, y, width, height
+	if r.children == nil {
+		return
+	}
+	total := height
+	if r.vertical {
+		total = max(width-(len(r.children)-1), 0)
+	}
+	sizes := distribute(r.children, total, r.vertical)
+	pos := 0
+	for i, child := range r.children {
+		child.size = sizes[i]
+		if r.vertical {
+			layoutRegion(child, x+pos, y, sizes[i], height)
+			pos += sizes[i] + 1
+		} else {
+			layoutRegion(child, x, y+pos, width, sizes[i])
+			pos += sizes[i]
+		}
+	}
+}
+
+// distribute shares total rows or columns among the children of a split in
+// proportion to their sizes, giving each at least what it needs if it can.
+func distribute(children []*region, total int, vertical bool) []int {
+	sum := 0
+	for _, child := range children {
+		sum += max(child.size, 1)
+	}
+	sizes := make([]int, len(children))
+	used := 0
+	for i, child := range children {
+		sizes[i] = total * max(child.size, 1) / sum
+		used += sizes[i]
+	}
+	sizes[len(sizes)-1] += total - used
+
+	// Take what the small ones lack from the ones with the most to spare
+	for i, child := range children {
+		for sizes[i] < minExtent(child, vertical) {
+			spare, from := 0, -1
+			for j, other := range children {
+				if s := sizes[j] - minExtent(other, vertical); j != i && s > spare {
+					spare, from = s, j
+				}
+			}
+			if from < 0 {
+				break
+			}
+			sizes[from]--
+			sizes[i]++
+		}
+	}
+	return sizes
+}
+
+// minExtent returns the fewest columns, or rows, that r needs.
+func minExtent(r *region, columns bool) int {
+	if r.children == nil {
+		if columns {
+			return minRegionWidth
+		}
+		return minRegionHeight
+	}
+	n := 0
+	for _, child := range r.children {
+		m := minExtent(child, columns)
+		if r.vertical == columns {
+			n += m
+		} else {
+			n = max(n, m)
+		}
+	}
+	if r.vertical && columns {
+		n += len(r.children) - 1
+	}
+	return n
+}
+
+// leaves returns the regions below r, from top left to bottom right.
+func leaves(r *region, out []*region) []*region {
+	if r.children == nil {
+		return append(out, r)
+	}
+	for _, child := range r.children {
+		out = leaves(child, out)
+	}
+	return out
+}
+
+// replaceLocked puts node where old was in the tree of the canvas.
+func (c *canvas) replaceLocked(old, node *region) {
+	node.parent = old.parent
+	if old.parent == nil {
+		c.root = node
+		return
+	}
+	for i, child := range old.parent.children {
+		if child == old {
+			old.parent.children[i] = node
+		}
+	}
+}
+
+// split splits the focused region in two, into rows or, with vertical,
+// side by side. The new region is blank and the focus stays.
+func (c *canvas) split(vertical bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := c.focus
+	if c.width > 0 {
+		if vertical && f.width < 2*minRegionWidth+1 || !vertical && f.height < 2*minRegionHeight {
+			return errors.New("no more room")
+		}
+	}
+	blank := &region{}
+	if p := f.parent; p != nil && p.vertical == vertical {
+		// Share the room of the focused region with the new one
+		blank.parent = p
+		i := 0
+		for p.children[i] != f {
+			i++
+		}
+		p.children = append(p.children[:i+1], append([]*region{blank}, p.children[i+1:]...)...)
+		size := max(f.size, 2)
+		f.size, blank.size = size-size/2, size/2
+	} else {
+		split := &region{vertical: vertical, size: f.size}
+		c.replaceLocked(f, split)
+		split.children = []*region{f, blank}
+		f.parent, blank.parent = split, split
+		f.size, blank.size = 1, 1
+	}
+	c.layoutLocked()
+	c.markDirty()
+	return nil
+}
+
+// remove removes the focused region, gives its room to a neighbour and
+// focuses the next region. It returns the window of the newly focused
+// region, if any.
+func (c *canvas) remove() (*session.Window, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.root.children == nil {
+		return nil, errors.New("there is only one region")
+	}
+	all := leaves(c.root, nil)
+	f := c.focus
+	next := all[0]
+	for i, r := range all {
+		if r == f {
+			next = all[(i+1)%len(all)]
+		}
+	}
+
+	p := f.parent
+	i := 0
+	for p.children[i] != f {
+		i++
+	}
+	neighbour := i + 1
+	if i > 0 {
+		neighbour = i - 1
+	}
+	p.children[neighbour].size += f.size
+	p.children = append(p.children[:i], p.children[i+1:]...)
+	if len(p.children) == 1 {
+		// A split of one is the region itself
+		only := p.children[0]
+		only.size = p.size
+		c.replaceLocked(p, only)
+	}
+
+	c.focus = next
+	if next.window != nil {
+		c.shown = next.window
+	}
+	c.layoutLocked()
+	c.markDirty()
+	return next.window, nil
+}
+
+// only removes all regions but the focused one.
+func (c *canvas) only() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.focus.parent = nil
+	c.focus.size = 0
+	c.root = c.focus
+	c.layoutLocked()
+	c.markDirty()
+}
+
+// moveFocus focuses another region: the next or previous one, the top or
+// bottom one, or the one up, down, left or right of the focused region.
+// It returns the window of the focused region, if any.
+func (c *canvas) moveFocus(direction string) (*session.Window, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	all := leaves(c.root, nil)
+	f := c.focus
+	i := 0
+	for all[i] != f {
+		i++
+	}
+	var target *region
+	switch direction {
+	case "", "next":
+		target = all[(i+1)%len(all)]
+	case "prev":
+		target = all[(i+len(all)-1)%len(all)]
+	case "top":
+		target = all[0]
+	case "bottom":
+		target = all[len(all)-1]
+	case "up":
+		target = regionAt(all, f.x, f.y-1)
+	case "down":
+		target = regionAt(all, f.x, f.y+f.height)
+	case "left":
+		target = regionAt(all, f.x-2, f.y)
+	case "right":
+		target = regionAt(all, f.x+f.width+1, f.y)
+	default:
+		return nil, fmt.Errorf("unknown direction %s", direction)
+	}
+	if target != nil && target != f {
+		c.focus = target
+		if target.window != nil {
+			c.shown = target.window
+		}
+		c.markDirty()
+	}
+	return c.focus.window, nil
+}
+
+// regionAt returns the region covering column x and row y, or nil.
+func regionAt(regions []*region, x, y int) *region {
+	for _, r := range regions {
+		if x >= r.x && x < r.x+r.width && y >= r.y && y < r.y+r.height {
+			return r
+		}
+	}
+	return nil
+}
+
+// resize changes the size of the focused region within its split, or with
+// axis "h" or "v" within the nearest split into columns or rows. size is n,
+// +n or -n rows or columns, = to make the regions of the split equal, or
+// max or min.
+func (c *canvas) resize(axis, size string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var node *region
+	for n := c.focus; n.parent != nil; n = n.parent {
+		if axis == "" || n.parent.vertical == (axis == "h") {
+			node = n
+			break
+		}
+	}
+	if node == nil {
+		return errors.New("no region to resize")
+	}
+	p := node.parent
+	if size == "=" {
+		for _, child := range p.children {
+			child.size = 1
+		}
+		c.layoutLocked()
+		c.markDirty()
+		return nil
+	}
+
+	total, others := 0, 0
+	for _, child := range p.children {
+		total += child.size
+		if child != node {
+			others += minExtent(child, p.vertical)
+		}
+	}
+	lo, hi := minExtent(node, p.vertical), total-others
+	want := 0
+	switch {
+	case size == "max":
+		want = hi
+	case size == "min":
+		want = lo
+	default:
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return fmt.Errorf("invalid size %s", size)
+		}
+		want = n
+		if strings.HasPrefix(size, "+") || strings.HasPrefix(size, "-") {
+			want = node.size + n
+		}
+	}
+	want = min(max(want, lo), hi)
+
+	// Take the difference from the neighbours, nearest first
+	delta := want - node.size
+	node.size = want
+	var order []*region
+	for i, child := range p.children {
+		if child == node {
+			order = append(order, p.children[i+1:]...)
+			for j := i - 1; j >= 0; j-- {
+				order = append(order, p.children[j])
+			}
+		}
+	}
+	for _, other := range order {
+		if delta < 0 {
+			other.size -= delta
+			break
+		}
+		take := min(delta, other.size-minExtent(other, p.vertical))
+		other.size -= take
+		delta -= take
+	}
+	c.layoutLocked()
+	c.markDirty()
+	return nil
+}
+
+// sync brings the regions up to date with the session of view: regions of
+// windows that are gone turn blank, and a new current window of the view
+// moves to the focused region. It returns the window of the focused region.
+func (c *canvas) sync(view *session.View) *session.Window {
+	sess := view.Session()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	all := leaves(c.root, nil)
+	for _, r := range all {
+		if r.window != nil && !sess.HasWindow(r.window) {
+			r.window = nil
+		}
+	}
+	if cur := view.Current(); cur != c.shown {
+		c.shown = cur
+		for _, r := range all {
+			if r.window == cur {
+				r.window = nil
+			}
+		}
+		c.focus.window = cur
+	}
+	return c.focus.window
+}
+
+// windows returns the windows shown in the regions.
+func (c *canvas) windows() []*session.Window {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var windows []*session.Window
+	for _, r := range leaves(c.root, nil) {
+		if r.window != nil {
+			windows = append(windows, r.window)
+		}
+	}
+	return windows
+}
+
+// currentLayout returns the number of the layout the canvas shows, or -1.
+func (c *canvas) currentLayout() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.layout
+}
+
+// setLayout records the number of the layout the canvas shows, or -1.
+func (c *canvas) setLayout(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.layout = n
+}
+
+// snapshot returns the regions of the canvas as the tree of a layout, and
+// the index of the focused region.
+func (c *canvas) snapshot() (*session.LayoutNode, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	focus := 0
+	for i, r := range leaves(c.root, nil) {
+		if r == c.focus {
+			focus = i
+		}
+	}
+	return snapshotRegion(c.root), focus
+}
+
+func snapshotRegion(r *region) *session.LayoutNode {
+	node := &session.LayoutNode{Vertical: r.vertical, Size: r.size}
+	if r.window != nil {
+		id := r.window.ID
+		node.Window = &id
+	}
+	for _, child := range r.children {
+		node.Children = append(node.Children, snapshotRegion(child))
+	}
+	return node
+}
+
+// restore replaces the regions of the canvas with those of the layout tree
+// root, focused on region focus, showing the windows of the session of
+// view that it names. A nil root is a single region. A layout of one
+// region shows the current window of the view when its own is gone. It
+// returns the window of the focused region.
+func (c *canvas) restore(root *session.LayoutNode, focus int, view *session.View) *session.Window {
+	sess := view.Session()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if root == nil {
+		root = &session.LayoutNode{}
+	}
+	c.root = restoreRegion(root, nil, sess)
+	c.root.size = 0
+	all := leaves(c.root, nil)
+	c.focus = all[0]
+	if focus > 0 && focus < len(all) {
+		c.focus = all[focus]
+	}
+	if c.root.children == nil && c.root.window == nil {
+		c.root.window = view.Current()
+	}
+	c.shown = c.focus.window
+	if c.shown == nil {
+		c.shown = view.Current()
+	}
+	c.layoutLocked()
+	c.markDirty()
+	return c.focus.window
+}
+
+func restoreRegion(node *session.LayoutNode, parent *region, sess *session.Session) *region {
+	r := &region{parent: parent, vertical: node.Vertical, size: node.Size}
+	if len(node.Children) == 1 {
+		// A split of one is the region itself
+		r = restoreRegion(node.Children[0], parent, sess)
+		r.size = node.Size
+		return r
+	}
+	if len(node.Children) == 0 {
+		if node.Window != nil {
+			r.window = sess.WindowNumbered(*node.Window)
+		}
+		return r
+	}
+	for _, child := range node.Children {
+		r.children = append(r.children, restoreRegion(child, r, sess))
+	}
+	return r
+}
+
+// fitWindows gives the window of every region the size of the region.
+func (c *canvas) fitWindows() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range leaves(c.root, nil) {
+		if r.window != nil && r.width > 0 && r.height > 0 {
+			_ = r.window.Resize(r.width, max(r.height-1, 1))
+		}
+	}
+}
+
+// paint writes the regions with their captions and the separators between
+// them, and leaves the cursor where the window of the focused region has
+// it.
+func (c *canvas) paint(buf *bytes.Buffer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	buf.WriteString("\x1b[?25l")
+	for _, r := range leaves(c.root, nil) {
+		if r.width <= 0 || r.height <= 0 || r.x >= c.width {
+			continue
+		}
+		rows := r.height - 1
+		if r.window != nil {
+			_ = r.window.Screen().RenderRegion(buf, r.x, r.y, r.width, rows)
+		} else {
+			for y := 0; y < rows; y++ {
+				fmt.Fprintf(buf, "\x1b[%d;%dH\x1b[0m%s", r.y+y+1, r.x+1, strings.Repeat(" ", r.width))
+			}
+		}
+
+		caption := ""
+		if r.window != nil {
+			caption = fmt.Sprintf("%3s %s", r.window.Number, windowTitle(r.window))
+			if status, _, exited := r.window.ExitState(); exited {
+				caption += fmt.Sprintf(" (exited %d)", status)
+			}
+		}
+		caption = fitText(caption, r.width)
+		style := "\x1b[0;7m"
+		if r == c.focus {
+			style = "\x1b[0;1;7m"
+		}
+		fmt.Fprintf(buf, "\x1b[%d;%dH%s%s\x1b[0m", r.y+r.height, r.x+1, style, caption)
+	}
+	paintSeparators(buf, c.root, c.width)
+
+	f := c.focus
+	if f.width <= 0 || f.height <= 0 {
+		return
+	}
+	if f.window == nil {
+		fmt.Fprintf(buf, "\x1b[%d;%dH\x1b[?25h", f.y+1, f.x+1)
+		return
+	}
+	scr := f.window.Screen()
+	x, y := scr.Cursor()
+	x, y = min(x, f.width-1), min(y, max(f.height-2, 0))
+	_ = scr.RenderModes(buf)
+	fmt.Fprintf(buf, "\x1b[%d;%dH", f.y+y+1, f.x+x+1)
+	if scr.CursorVisible() {
+		buf.WriteString("\x1b[?25h")
+	}
+}
+
+// paintSeparators draws the columns between the regions of vertical splits
+// that fall within the width of the display.
+func paintSeparators(buf *bytes.Buffer, r *region, width int) {
+	for i, child := range r.children {
+		if r.vertical && i < len(r.children)-1 && child.x+child.width < width {
+			for y := r.y; y < r.y+r.height; y++ {
+				fmt.Fprintf(buf, "\x1b[%d;%dH\x1b[0;7m|\x1b[0m", y+1, child.x+child.width+1)
+			}
+		}
+		paintSeparators(buf, child, width)
+	}
+}
+
+// fitText truncates or pads s with blanks to width columns.
+func fitText(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return s + strings.Repeat(" ", width-len(runes))
+}
+
+// regions returns the canvas of the display, laid out for its current size.
+func (d *Display) regions() *canvas {
+	width, height := d.Size()
+	d.canvas.setSize(width, height)
+	return d.canvas
+}
+
+// attachRegions is attachWindow for a display split into regions. The
+// regions are painted from the screens of their windows whenever one of
+// them writes, and input goes to the window of the focused region.
+func attachRegions(d *Display, sess *session.Session, config *AttachConfig) (attachEvent, error) {
+	c := d.regions()
+	focused := c.sync(d.viewOf(sess))
+	c.fitWindows()
+
+	stop := make(chan struct{})
+	var painter sync.WaitGroup
+	defer func() {
+		close(stop)
+		painter.Wait()
+	}()
+
+	// Output of any shown window repaints the regions
+	for _, win := range c.windows() {
+		_, remove := win.AddOutput(writerFunc(func(p []byte) (int, error) {
+			c.markDirty()
+			return len(p), nil
+		}))
+		defer remove()
+	}
+
+	// A dead focused window is left when zombie keys are set; they close
+	// or respawn it
+	var exited <-chan struct{}
+	zombieKeys := ""
+	if focused != nil {
+		if status, _, dead := focused.ExitState(); dead && sess.Zombie() != "" {
+			zombieKeys = sess.Zombie()
+			d.postMessage(fmt.Sprintf("Window %s exited with status %d; %s closes, %s respawns it",
+				focused.Number, status, keyName(zombieKeys[0]), keyName(zombieKeys[1])))
+		} else if !focused.IsGroup() {
+			exited = focused.Exited()
+		}
+	}
+
+	paint := func() error {
+		var buf bytes.Buffer
+		c.paint(&buf)
+		_, err := d.Write(buf.Bytes())
+		return err
+	}
+	if err := paint(); err != nil {
+		return eventHangup, nil
+	}
+	showNotices(d, d.Monitor, config)
+	painter.Add(1)
+	go func() {
+		defer painter.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-c.dirty:
+				_ = paint()
+			}
+		}
+	}()
+
+	reader := newDetachReaderWithConfig(d.interruptible(stop), config)
+	inputDone := make(chan error, 1)
+	zombieDone := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := reader.Read(buf)
+			if n > 0 && focused != nil {
+				if zombieKeys != "" {
+					if handleZombieKeys(sess, focused, buf[:n], zombieKeys, config, d) {
+						zombieDone <- struct{}{}
+						return
+					}
+				} else if ptyProc := focused.GetPTYProcess(); ptyProc != nil {
+					if _, werr := ptyProc.Pty.Write(buf[:n]); werr != nil {
+						inputDone <- werr
+						return
+					}
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				inputDone <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-d.hangup:
+		return eventHangup, nil
+	case err := <-inputDone:
+		if err == nil && d.hungUp() {
+			return eventHangup, nil
+		}
+		return eventInput, err
+	case <-exited:
+		return eventOutput, nil
+	case <-zombieDone:
+		return eventOutput, nil
+	}
+}
+
+// handleZombieKeys closes or respawns the dead window win if keys, the
+// zombie keys, are among the input p, and reports whether they were.
+func handleZombieKeys(sess *session.Session, win *session.Window, p []byte, keys string, config *AttachConfig, d *Display) bool {
+	for _, b := range p {
+		switch b {
+		case keys[0]:
+			if err := sess.CloseWindow(win); err != nil {
+				d.postMessage(err.Error())
+			}
+			return true
+		case keys[1]:
+			if err := sess.RespawnWindow(win, windowConfig(config)); err != nil {
+				d.postMessage(err.Error())
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
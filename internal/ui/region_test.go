@@ -0,0 +1,102 @@
+package ui
+
+import (
+	"bytes"
+	"testing"
+)
+
+// geometry returns the areas of the regions of c, top left to bottom right.
+func geometry(c *canvas) [][4]int {
+	var areas [][4]int
+	for _, r := range leaves(c.root, nil) {
+		areas = append(areas, [4]int{r.x, r.y, r.width, r.height})
+	}
+	return areas
+}
+
+func checkGeometry(t *testing.T, c *canvas, want ...[4]int) {
+	t.Helper()
+	got := geometry(c)
+	if len(got) != len(want) {
+		t.Fatalf("regions = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("regions = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestCanvasSplitResizeRemove(t *testing.T) {
+	c := newCanvas()
+	c.setSize(80, 24)
+	if err := c.split(false); err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	checkGeometry(t, c, [4]int{0, 0, 80, 12}, [4]int{0, 12, 80, 12})
+
+	// A vertical split of the top region leaves a separator column
+	if err := c.split(true); err != nil {
+		t.Fatalf("split -v: %v", err)
+	}
+	checkGeometry(t, c, [4]int{0, 0, 39, 12}, [4]int{40, 0, 40, 12}, [4]int{0, 12, 80, 12})
+
+	if err := c.resize("h", "+10"); err != nil {
+		t.Fatalf("resize -h +10: %v", err)
+	}
+	checkGeometry(t, c, [4]int{0, 0, 49, 12}, [4]int{50, 0, 30, 12}, [4]int{0, 12, 80, 12})
+	if err := c.resize("v", "max"); err != nil {
+		t.Fatalf("resize -v max: %v", err)
+	}
+	checkGeometry(t, c, [4]int{0, 0, 49, 22}, [4]int{50, 0, 30, 22}, [4]int{0, 22, 80, 2})
+
+	// Directions follow the geometry
+	if _, err := c.moveFocus("right"); err != nil || c.focus != leaves(c.root, nil)[1] {
+		t.Fatalf("focus right: %v, focus at %d,%d", err, c.focus.x, c.focus.y)
+	}
+	if _, err := c.moveFocus("down"); err != nil || c.focus != leaves(c.root, nil)[2] {
+		t.Fatalf("focus down: %v, focus at %d,%d", err, c.focus.x, c.focus.y)
+	}
+
+	// The room of a removed region goes to its neighbour
+	if _, err := c.remove(); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	checkGeometry(t, c, [4]int{0, 0, 49, 24}, [4]int{50, 0, 30, 24})
+	c.only()
+	checkGeometry(t, c, [4]int{0, 0, 80, 24})
+	if _, err := c.remove(); err == nil {
+		t.Fatalf("remove of the only region: want an error")
+	}
+
+	// Display resizes keep the proportions
+	_ = c.split(false)
+	_ = c.resize("", "6")
+	c.setSize(80, 48)
+	checkGeometry(t, c, [4]int{0, 0, 80, 12}, [4]int{0, 12, 80, 36})
+}
+
+func TestCanvasOnATinyDisplay(t *testing.T) {
+	c := newCanvas()
+	c.setSize(80, 24)
+	for i := 0; i < 3; i++ {
+		if err := c.split(true); err != nil {
+			t.Fatalf("split -v: %v", err)
+		}
+	}
+
+	// Regions without room are left out, not given negative sizes
+	for _, size := range [][2]int{{2, 24}, {1, 1}, {80, 1}} {
+		c.setSize(size[0], size[1])
+		for _, area := range geometry(c) {
+			if area[2] < 0 || area[3] < 0 {
+				t.Fatalf("regions on %dx%d = %v, want no negative sizes", size[0], size[1], geometry(c))
+			}
+		}
+		var buf bytes.Buffer
+		c.paint(&buf)
+		c.fitWindows()
+	}
+	c.setSize(80, 24)
+	checkGeometry(t, c, [4]int{0, 0, 19, 24}, [4]int{20, 0, 19, 24}, [4]int{40, 0, 19, 24}, [4]int{60, 0, 20, 24})
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"io"
 	"sync"
+
+	"github.com/inoki/sgreen/internal/session"
 )
 
 // ScrollbackBuffer maintains a circular buffer of terminal output
@@ -153,3 +155,19 @@ func (sb *ScrollbackBuffer) WriteTo(w io.Writer) (int64, error) {
 	}
 	return total, nil
 }
+
+// windowScrollback returns the text of a window's history followed by its
+// screen, as kept by the window's terminal emulator. Blank rows below the
+// last line of text are left out.
+func windowScrollback(win *session.Window) *ScrollbackBuffer {
+	screen := win.Screen()
+	lines := append(screen.History(), screen.Lines()...)
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	sb := NewScrollbackBuffer(len(lines))
+	for _, line := range lines {
+		sb.Append([]byte(line))
+	}
+	return sb
+}
@@ -2,13 +2,13 @@ package ui
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
-	"golang.org/x/term"
-
 	"github.com/inoki/sgreen/internal/session"
 )
 
@@ -30,21 +30,18 @@ func NewStatusLine(enabled bool, format string) *StatusLine {
 }
 
 // Update updates the status line with current session/window information
-func (sl *StatusLine) Update(out *os.File, sess *session.Session) {
+func (sl *StatusLine) Update(out io.Writer, sess *session.Session) {
 	if !sl.enabled {
 		return
 	}
 
-	win := sess.GetCurrentWindow()
+	win := viewFor(out, sess).Current()
 	if win == nil {
 		return
 	}
 
-	// Get terminal width
-	width := 80 // Default
-	if termWidth, _, err := getTerminalSize(out); err == nil {
-		width = termWidth
-	}
+	// Get terminal size
+	width, height := terminalSize(out)
 
 	// Build status string
 	status := sl.buildStatusString(sess, win, width)
@@ -54,7 +51,7 @@ func (sl *StatusLine) Update(out *os.File, sess *session.Session) {
 	}
 
 	// Move cursor to bottom line and clear it
-	MoveCursor(out, getTerminalHeight(out), 1)
+	MoveCursor(out, height, 1)
 	ClearLine(out)
 	_, _ = fmt.Fprint(out, status)
 
@@ -99,7 +96,7 @@ func (sl *StatusLine) buildStatusString(sess *session.Session, win *session.Wind
 			case 'w': // Window count
 				result += fmt.Sprintf("%d", len(sess.Windows))
 			case 'c': // Current window index
-				result += fmt.Sprintf("%d", sess.CurrentWindow+1)
+				result += fmt.Sprintf("%d", slices.Index(sess.Windows, win)+1)
 			case 'D': // Date (YYYY-MM-DD)
 				result += time.Now().Format("2006-01-02")
 			case 'T': // Time (HH:MM:SS)
@@ -127,20 +124,6 @@ func (sl *StatusLine) buildStatusString(sess *session.Session, win *session.Wind
 	return result
 }
 
-// getTerminalSize gets the terminal size
-func getTerminalSize(file *os.File) (width, height int, err error) {
-	return term.GetSize(int(file.Fd()))
-}
-
-// getTerminalHeight gets the terminal height
-func getTerminalHeight(file *os.File) int {
-	_, height, err := getTerminalSize(file)
-	if err != nil {
-		return 24
-	}
-	return height
-}
-
 // getLoadAverage gets the system load average
 func getLoadAverage() string {
 	if runtime.GOOS == "windows" {
@@ -164,37 +147,69 @@ func getLoadAverage() string {
 }
 
 // ShowWindowList displays a list of windows
-func ShowWindowList(out *os.File, sess *session.Session) {
+func ShowWindowList(out io.Writer, sess *session.Session) {
 	_, _ = fmt.Fprintf(out, "\r\nWindow List:\r\n")
-	for i, win := range sess.Windows {
-		marker := " "
-		if i == sess.CurrentWindow {
-			marker = "*"
-		}
-		title := win.Title
-		if title == "" {
-			title = win.CmdPath
-		}
-		_, _ = fmt.Fprintf(out, "%s %s: %s\r\n", marker, win.Number, title)
-	}
+	writeWindowTree(out, sess, nil)
 	_, _ = fmt.Fprintf(out, "\r\nPress any key to continue...\r\n")
 }
 
 // ShowInteractiveWindowList displays an interactive window list for selection
-func ShowInteractiveWindowList(in, out *os.File, sess *session.Session) error {
-	// Display window list
-	_, _ = fmt.Fprintf(out, "\r\nWindow List (select with number/name or arrow keys):\r\n")
-	for i, win := range sess.Windows {
+func ShowInteractiveWindowList(in io.Reader, out io.Writer, sess *session.Session) error {
+	return showWindowList(in, out, sess, nil)
+}
+
+// writeWindowTree writes the windows of group, or of the whole session for
+// a nil group, with the windows of groups indented below them.
+func writeWindowTree(out io.Writer, sess *session.Session, group *session.Window) {
+	current := viewFor(out, sess).Current()
+	for _, entry := range windowTree(sess, group) {
 		marker := " "
-		if i == sess.CurrentWindow {
+		if entry.win == current {
 			marker = "*"
 		}
-		title := win.Title
-		if title == "" {
-			title = win.CmdPath
+		title := windowTitle(entry.win)
+		if entry.win.IsGroup() {
+			title += "/"
 		}
-		_, _ = fmt.Fprintf(out, "%s %s: %s\r\n", marker, win.Number, title)
+		_, _ = fmt.Fprintf(out, "%s %s%s: %s\r\n", marker, strings.Repeat("  ", entry.depth), entry.win.Number, title)
 	}
+}
+
+// windowTreeEntry is a window in the tree of groups, depth groups down
+type windowTreeEntry struct {
+	win   *session.Window
+	depth int
+}
+
+// windowTree returns the windows below group, or all windows for a nil
+// group, by number, each group followed by its windows.
+func windowTree(sess *session.Session, group *session.Window) []windowTreeEntry {
+	var entries []windowTreeEntry
+	var walk func(group *session.Window, depth int)
+	walk = func(group *session.Window, depth int) {
+		for _, win := range sess.Windows {
+			if win != group && sess.GroupOf(win) == group {
+				entries = append(entries, windowTreeEntry{win, depth})
+				if win.IsGroup() {
+					walk(win, depth+1)
+				}
+			}
+		}
+	}
+	walk(group, 0)
+	return entries
+}
+
+// showWindowList displays the windows of group, or all windows for a nil
+// group, and switches to the one selected.
+func showWindowList(in io.Reader, out io.Writer, sess *session.Session, group *session.Window) error {
+	// Display window list
+	if group != nil {
+		_, _ = fmt.Fprintf(out, "\r\nGroup %s %s (select with number/name):\r\n", group.Number, windowTitle(group))
+	} else {
+		_, _ = fmt.Fprintf(out, "\r\nWindow List (select with number/name or arrow keys):\r\n")
+	}
+	writeWindowTree(out, sess, group)
 	_, _ = fmt.Fprintf(out, "\r\nSelect window (number/name/Enter to cancel): ")
 
 	// Read input
@@ -247,7 +262,7 @@ func ShowInteractiveWindowList(in, out *os.File, sess *session.Session) error {
 	}
 
 	// Try to switch to selected window
-	err := sess.SwitchToWindow(selection)
+	err := viewFor(out, sess).SwitchTo(selection)
 	if err != nil {
 		_, _ = fmt.Fprintf(out, "\r\nInvalid window: %s\r\n", selection)
 		// Wait a bit for user to see error
@@ -258,3 +273,11 @@ func ShowInteractiveWindowList(in, out *os.File, sess *session.Session) error {
 	_, _ = fmt.Fprintf(out, "\r\n")
 	return nil
 }
+
+// drawStatusLine draws the status line over the last row of the display,
+// keeping the cursor where it was.
+func drawStatusLine(out io.Writer, sess *session.Session, config *AttachConfig) {
+	_, _ = fmt.Fprint(out, "\x1b7")
+	NewStatusLine(true, config.StatusFormat).Update(out, sess)
+	_, _ = fmt.Fprint(out, "\x1b8")
+}
@@ -0,0 +1,530 @@
+package vt
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+type parserState int
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSI
+	stateOSC
+	stateString // DCS, SOS, PM and APC strings, which are ignored
+	stateStringEscape
+)
+
+const maxParams = 16
+
+// parser is the control sequence state machine of a Screen.
+type parser struct {
+	state        parserState
+	params       []int
+	param        int
+	hasParam     bool
+	private      byte
+	intermediate []byte
+	osc          []byte
+	oscEscape    bool
+	utf8         []byte
+}
+
+func (p *parser) clear() {
+	p.params = p.params[:0]
+	p.param = 0
+	p.hasParam = false
+	p.private = 0
+	p.intermediate = p.intermediate[:0]
+}
+
+// feed processes one byte of program output.
+func (p *parser) feed(s *Screen, b byte) {
+	switch p.state {
+	case stateOSC:
+		p.feedOSC(s, b)
+		return
+	case stateString, stateStringEscape:
+		switch {
+		case b == 0x1b:
+			p.state = stateStringEscape
+		case b == '\\' && p.state == stateStringEscape, b == 0x07, b == 0x18, b == 0x1a:
+			p.state = stateGround
+		default:
+			p.state = stateString
+		}
+		return
+	}
+
+	if len(p.utf8) > 0 {
+		if b >= 0x80 && b < 0xc0 {
+			p.utf8 = append(p.utf8, b)
+			if utf8.FullRune(p.utf8) {
+				r, size := utf8.DecodeRune(p.utf8)
+				if r == utf8.RuneError && size <= 1 {
+					p.flushLatin1(s)
+				} else {
+					s.put(r)
+					p.utf8 = p.utf8[:0]
+				}
+			}
+			return
+		}
+		p.flushLatin1(s)
+	}
+
+	// Control characters act in any state
+	if b < 0x20 || b == 0x7f {
+		p.control(s, b)
+		return
+	}
+
+	switch p.state {
+	case stateGround:
+		switch {
+		case b >= 0xc2 && b <= 0xf4:
+			p.utf8 = append(p.utf8, b)
+		case b >= 0xa0:
+			// Not UTF-8: show the byte as Latin-1
+			s.put(rune(b))
+		case b >= 0x80:
+			// C1 controls are not used by UTF-8 programs
+		default:
+			s.put(rune(b))
+		}
+	case stateEscape:
+		p.escape(s, b)
+	case stateEscapeIntermediate:
+		p.escapeIntermediate(s, b)
+	case stateCSI:
+		p.csiByte(s, b)
+	}
+}
+
+// flushLatin1 shows an incomplete UTF-8 sequence byte by byte.
+func (p *parser) flushLatin1(s *Screen) {
+	for _, c := range p.utf8 {
+		if c >= 0xa0 {
+			s.put(rune(c))
+		}
+	}
+	p.utf8 = p.utf8[:0]
+}
+
+func (p *parser) control(s *Screen, b byte) {
+	switch b {
+	case 0x07: // BEL
+		s.bells++
+	case 0x08: // BS
+		if s.x > 0 {
+			s.x--
+		}
+		s.wrapNext = false
+	case 0x09: // HT
+		s.tab(1)
+	case 0x0a, 0x0b, 0x0c: // LF, VT, FF
+		s.index()
+	case 0x0d: // CR
+		s.carriageReturn()
+	case 0x0e: // SO
+		s.gl = 1
+	case 0x0f: // SI
+		s.gl = 0
+	case 0x18, 0x1a: // CAN, SUB
+		p.state = stateGround
+	case 0x1b: // ESC
+		p.clear()
+		p.state = stateEscape
+	}
+}
+
+func (p *parser) escape(s *Screen, b byte) {
+	p.state = stateGround
+	switch b {
+	case '[':
+		p.clear()
+		p.state = stateCSI
+	case ']':
+		p.osc = p.osc[:0]
+		p.oscEscape = false
+		p.state = stateOSC
+	case 'P', 'X', '^', '_':
+		p.state = stateString
+	case '7':
+		s.saveCursor()
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.index()
+	case 'E':
+		s.carriageReturn()
+		s.index()
+	case 'H':
+		s.tabs[s.x] = true
+	case 'M':
+		s.reverseIndex()
+	case 'c':
+		s.reset()
+	case '=':
+		s.keypadApp = true
+	case '>':
+		s.keypadApp = false
+	default:
+		if b >= 0x20 && b <= 0x2f {
+			p.intermediate = append(p.intermediate, b)
+			p.state = stateEscapeIntermediate
+		}
+	}
+}
+
+func (p *parser) escapeIntermediate(s *Screen, b byte) {
+	if b >= 0x20 && b <= 0x2f {
+		p.intermediate = append(p.intermediate, b)
+		return
+	}
+	p.state = stateGround
+	switch p.intermediate[0] {
+	case '(':
+		s.charsets[0] = b
+	case ')':
+		s.charsets[1] = b
+	case '#':
+		if b == '8' {
+			s.alignmentTest()
+		}
+	}
+}
+
+func (p *parser) csiByte(s *Screen, b byte) {
+	switch {
+	case b >= '0' && b <= '9':
+		if p.param < 100000 {
+			p.param = p.param*10 + int(b-'0')
+		}
+		p.hasParam = true
+	case b == ';' || b == ':':
+		p.pushParam()
+	case b >= '<' && b <= '?':
+		p.private = b
+	case b >= 0x20 && b <= 0x2f:
+		p.intermediate = append(p.intermediate, b)
+	case b >= 0x40 && b <= 0x7e:
+		p.pushParam()
+		p.state = stateGround
+		p.csi(s, b)
+	default:
+		p.state = stateGround
+	}
+}
+
+func (p *parser) pushParam() {
+	if len(p.params) < maxParams {
+		if p.hasParam {
+			p.params = append(p.params, p.param)
+		} else {
+			p.params = append(p.params, -1)
+		}
+	}
+	p.param = 0
+	p.hasParam = false
+}
+
+// arg returns parameter i, or def when it is missing or zero.
+func (p *parser) arg(i, def int) int {
+	if i >= len(p.params) || p.params[i] <= 0 {
+		return def
+	}
+	return p.params[i]
+}
+
+func (p *parser) csi(s *Screen, final byte) {
+	if len(p.intermediate) > 0 {
+		if p.intermediate[0] == '!' && final == 'p' {
+			// DECSTR soft reset
+			s.insert = false
+			s.origin = false
+			s.autowrap = true
+			s.visible = true
+			s.style = Style{}
+			s.top, s.bottom = 0, s.height-1
+			s.saved = s.cursorState()
+		}
+		return
+	}
+	if p.private == '?' {
+		if final == 'h' || final == 'l' {
+			for i := range p.params {
+				s.setPrivateMode(p.arg(i, 0), final == 'h')
+			}
+		}
+		return
+	}
+	if p.private != 0 {
+		return
+	}
+
+	switch final {
+	case '@': // ICH
+		s.insertCells(p.arg(0, 1))
+	case 'A': // CUU
+		s.moveRows(-p.arg(0, 1))
+	case 'B', 'e': // CUD, VPR
+		s.moveRows(p.arg(0, 1))
+	case 'C', 'a': // CUF, HPR
+		s.moveCols(p.arg(0, 1))
+	case 'D': // CUB
+		s.moveCols(-p.arg(0, 1))
+	case 'E': // CNL
+		s.moveRows(p.arg(0, 1))
+		s.carriageReturn()
+	case 'F': // CPL
+		s.moveRows(-p.arg(0, 1))
+		s.carriageReturn()
+	case 'G', '`': // CHA, HPA
+		s.x = clamp(p.arg(0, 1)-1, 0, s.width-1)
+		s.wrapNext = false
+	case 'H', 'f': // CUP, HVP
+		s.moveTo(p.arg(1, 1)-1, p.arg(0, 1)-1)
+	case 'I': // CHT
+		s.tab(p.arg(0, 1))
+	case 'J': // ED
+		s.eraseDisplay(p.arg(0, 0))
+	case 'K': // EL
+		s.eraseLine(p.arg(0, 0))
+	case 'L': // IL
+		s.insertLines(p.arg(0, 1))
+	case 'M': // DL
+		s.deleteLines(p.arg(0, 1))
+	case 'P': // DCH
+		s.deleteCells(p.arg(0, 1))
+	case 'S': // SU
+		s.scrollUp(p.arg(0, 1))
+	case 'T': // SD
+		s.scrollDown(p.arg(0, 1))
+	case 'X': // ECH
+		s.eraseCells(s.x, s.x+p.arg(0, 1))
+	case 'Z': // CBT
+		s.tab(-p.arg(0, 1))
+	case 'b': // REP
+		// More repeats than the screen holds would only scroll it
+		if s.lastRune != 0 {
+			for n := min(p.arg(0, 1), s.width*s.height); n > 0; n-- {
+				s.put(s.lastRune)
+			}
+		}
+	case 'd': // VPA
+		x := s.x
+		s.moveTo(x, p.arg(0, 1)-1)
+	case 'g': // TBC
+		switch p.arg(0, 0) {
+		case 0:
+			s.tabs[s.x] = false
+		case 3:
+			s.tabs = make([]bool, s.width)
+		}
+	case 'h', 'l': // SM, RM
+		for i := range p.params {
+			if p.arg(i, 0) == 4 {
+				s.insert = final == 'h'
+			}
+		}
+	case 'm': // SGR
+		p.sgr(s)
+	case 'r': // DECSTBM
+		s.setScrollRegion(p.arg(0, 1), p.arg(1, s.height))
+	case 's': // SCOSC
+		s.saveCursor()
+	case 'u': // SCORC
+		s.restoreCursor()
+	}
+}
+
+// Private modes remembered so a repaint can restore them on the terminal
+var passedModes = map[int]bool{
+	1:    true, // Application cursor keys
+	1000: true, // Mouse reporting
+	1002: true,
+	1003: true,
+	1005: true,
+	1006: true,
+	2004: true, // Bracketed paste
+}
+
+func (s *Screen) setPrivateMode(mode int, on bool) {
+	switch mode {
+	case 6:
+		s.origin = on
+		s.moveTo(0, 0)
+	case 7:
+		s.autowrap = on
+		if !on {
+			s.wrapNext = false
+		}
+	case 25:
+		s.visible = on
+	case 47, 1047:
+		s.setAltScreen(on, false)
+	case 1048:
+		if on {
+			s.saveCursor()
+		} else {
+			s.restoreCursor()
+		}
+	case 1049:
+		if on {
+			s.saveCursor()
+			s.setAltScreen(true, true)
+		} else {
+			s.setAltScreen(false, false)
+			s.restoreCursor()
+		}
+	default:
+		if passedModes[mode] {
+			if on {
+				s.modes[mode] = true
+			} else {
+				delete(s.modes, mode)
+			}
+		}
+	}
+}
+
+func (p *parser) sgr(s *Screen) {
+	if len(p.params) == 0 {
+		s.style = Style{}
+		return
+	}
+	for i := 0; i < len(p.params); i++ {
+		n := p.params[i]
+		switch {
+		case n <= 0:
+			s.style = Style{}
+		case n == 1:
+			s.style.Attr |= AttrBold
+		case n == 2:
+			s.style.Attr |= AttrDim
+		case n == 3:
+			s.style.Attr |= AttrItalic
+		case n == 4:
+			s.style.Attr |= AttrUnderline
+		case n == 5 || n == 6:
+			s.style.Attr |= AttrBlink
+		case n == 7:
+			s.style.Attr |= AttrReverse
+		case n == 8:
+			s.style.Attr |= AttrHidden
+		case n == 9:
+			s.style.Attr |= AttrStrike
+		case n == 21 || n == 22:
+			s.style.Attr &^= AttrBold | AttrDim
+		case n == 23:
+			s.style.Attr &^= AttrItalic
+		case n == 24:
+			s.style.Attr &^= AttrUnderline
+		case n == 25:
+			s.style.Attr &^= AttrBlink
+		case n == 27:
+			s.style.Attr &^= AttrReverse
+		case n == 28:
+			s.style.Attr &^= AttrHidden
+		case n == 29:
+			s.style.Attr &^= AttrStrike
+		case n >= 30 && n <= 37:
+			s.style.Fg = PaletteColor(n - 30)
+		case n == 38:
+			var c Color
+			c, i = p.extendedColor(i)
+			s.style.Fg = c
+		case n == 39:
+			s.style.Fg = DefaultColor
+		case n >= 40 && n <= 47:
+			s.style.Bg = PaletteColor(n - 40)
+		case n == 48:
+			var c Color
+			c, i = p.extendedColor(i)
+			s.style.Bg = c
+		case n == 49:
+			s.style.Bg = DefaultColor
+		case n >= 90 && n <= 97:
+			s.style.Fg = PaletteColor(n - 90 + 8)
+		case n >= 100 && n <= 107:
+			s.style.Bg = PaletteColor(n - 100 + 8)
+		}
+	}
+}
+
+// extendedColor parses "5;n" or "2;r;g;b" after the 38 or 48 at index i and
+// returns the color and the index of its last parameter.
+func (p *parser) extendedColor(i int) (Color, int) {
+	if i+1 >= len(p.params) {
+		return DefaultColor, i
+	}
+	switch p.params[i+1] {
+	case 5:
+		if i+2 < len(p.params) {
+			return PaletteColor(clamp(p.params[i+2], 0, 255)), i + 2
+		}
+		return DefaultColor, i + 1
+	case 2:
+		if i+4 < len(p.params) {
+			r := clamp(p.params[i+2], 0, 255)
+			g := clamp(p.params[i+3], 0, 255)
+			b := clamp(p.params[i+4], 0, 255)
+			return RGBColor(uint8(r), uint8(g), uint8(b)), i + 4
+		}
+		return DefaultColor, len(p.params) - 1
+	}
+	return DefaultColor, i + 1
+}
+
+const maxOSC = 4096
+
+func (p *parser) feedOSC(s *Screen, b byte) {
+	switch {
+	case p.oscEscape:
+		p.oscEscape = false
+		if b == '\\' {
+			p.endOSC(s)
+			return
+		}
+		// ESC starts a new sequence, abandoning the OSC
+		p.clear()
+		p.state = stateEscape
+		p.escape(s, b)
+	case b == 0x07:
+		p.endOSC(s)
+	case b == 0x1b:
+		p.oscEscape = true
+	case b == 0x18 || b == 0x1a:
+		p.state = stateGround
+	default:
+		if len(p.osc) < maxOSC {
+			p.osc = append(p.osc, b)
+		}
+	}
+}
+
+func (p *parser) endOSC(s *Screen) {
+	p.state = stateGround
+	data := string(p.osc)
+	sep := -1
+	for i := 0; i < len(data); i++ {
+		if data[i] == ';' {
+			sep = i
+			break
+		}
+	}
+	if sep < 0 {
+		return
+	}
+	cmd, err := strconv.Atoi(data[:sep])
+	if err != nil {
+		return
+	}
+	switch cmd {
+	case 0, 2:
+		s.title = data[sep+1:]
+	}
+}
@@ -0,0 +1,237 @@
+package vt
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Render writes the escape sequences that repaint a terminal of the same
+// size with the current screen: the contents, the cursor, the current
+// attributes, the scrolling region and the modes set by the program. After
+// Render, the terminal can be fed the program's output directly.
+func (s *Screen) Render(w io.Writer) error {
+	s.mu.Lock()
+	var buf bytes.Buffer
+	s.render(&buf)
+	s.mu.Unlock()
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (s *Screen) render(buf *bytes.Buffer) {
+	// Start from a known state: no margins or modes that affect drawing
+	buf.WriteString("\x1b[?25l\x1b[0m\x1b[r\x1b[?6l\x1b[4l\x1b[?7h\x1b(B\x1b)B\x0f")
+	buf.WriteString("\x1b[H\x1b[2J")
+
+	for y, l := range s.lines {
+		end := len(l.cells)
+		for end > 0 && l.cells[end-1] == blankCell(Style{}) {
+			end--
+		}
+		if end == 0 {
+			continue
+		}
+		buf.WriteString("\x1b[")
+		buf.WriteString(strconv.Itoa(y + 1))
+		buf.WriteString("H")
+		current := Style{}
+		for _, c := range l.cells[:end] {
+			if c.Width == 0 {
+				continue
+			}
+			if c.Style != current {
+				writeSGR(buf, c.Style)
+				current = c.Style
+			}
+			buf.WriteRune(c.Rune)
+			buf.WriteString(c.Combining)
+		}
+		if current != (Style{}) {
+			buf.WriteString("\x1b[0m")
+		}
+	}
+
+	// Restore the program's state
+	if s.top != 0 || s.bottom != s.height-1 {
+		buf.WriteString("\x1b[")
+		buf.WriteString(strconv.Itoa(s.top + 1))
+		buf.WriteByte(';')
+		buf.WriteString(strconv.Itoa(s.bottom + 1))
+		buf.WriteString("r")
+	}
+	if s.origin {
+		buf.WriteString("\x1b[?6h")
+	}
+	if !s.autowrap {
+		buf.WriteString("\x1b[?7l")
+	}
+	if s.insert {
+		buf.WriteString("\x1b[4h")
+	}
+	if s.charsets[0] != 'B' {
+		buf.WriteString("\x1b(")
+		buf.WriteByte(s.charsets[0])
+	}
+	if s.charsets[1] != 'B' {
+		buf.WriteString("\x1b)")
+		buf.WriteByte(s.charsets[1])
+	}
+	if s.gl == 1 {
+		buf.WriteByte(0x0e)
+	}
+	s.renderModes(buf)
+
+	y := s.y
+	if s.origin {
+		y -= s.top
+	}
+	buf.WriteString("\x1b[")
+	buf.WriteString(strconv.Itoa(y + 1))
+	buf.WriteByte(';')
+	buf.WriteString(strconv.Itoa(s.x + 1))
+	buf.WriteString("H")
+	writeSGR(buf, s.style)
+	if s.visible {
+		buf.WriteString("\x1b[?25h")
+	}
+}
+
+// renderModes writes the keypad mode and the private modes set by the
+// program that the terminal itself has to follow.
+func (s *Screen) renderModes(buf *bytes.Buffer) {
+	if s.keypadApp {
+		buf.WriteString("\x1b=")
+	} else {
+		buf.WriteString("\x1b>")
+	}
+	modes := make([]int, 0, len(passedModes))
+	for mode := range passedModes {
+		modes = append(modes, mode)
+	}
+	sort.Ints(modes)
+	for _, mode := range modes {
+		buf.WriteString("\x1b[?")
+		buf.WriteString(strconv.Itoa(mode))
+		if s.modes[mode] {
+			buf.WriteByte('h')
+		} else {
+			buf.WriteByte('l')
+		}
+	}
+}
+
+// RenderModes writes the escape sequences that give a terminal the input
+// modes of the screen, such as application cursor keys, without repainting
+// anything.
+func (s *Screen) RenderModes(w io.Writer) error {
+	s.mu.Lock()
+	var buf bytes.Buffer
+	s.renderModes(&buf)
+	s.mu.Unlock()
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// RenderRegion writes the escape sequences that paint the screen into a
+// rectangle of a larger terminal, from column left and row top (0-based),
+// clipped or padded with blanks to width by height. The modes and cursor of
+// the terminal are left for the caller to set.
+func (s *Screen) RenderRegion(w io.Writer, left, top, width, height int) error {
+	s.mu.Lock()
+	var buf bytes.Buffer
+	for y := 0; y < height; y++ {
+		buf.WriteString("\x1b[")
+		buf.WriteString(strconv.Itoa(top + y + 1))
+		buf.WriteByte(';')
+		buf.WriteString(strconv.Itoa(left + 1))
+		buf.WriteString("H\x1b[0m")
+		var cells []Cell
+		if y < len(s.lines) {
+			cells = s.lines[y].cells
+		}
+		current := Style{}
+		x := 0
+		for _, c := range cells {
+			if c.Width == 0 {
+				continue
+			}
+			if x+int(c.Width) > width {
+				break
+			}
+			if c.Style != current {
+				writeSGR(&buf, c.Style)
+				current = c.Style
+			}
+			buf.WriteRune(c.Rune)
+			buf.WriteString(c.Combining)
+			x += int(c.Width)
+		}
+		if current != (Style{}) {
+			buf.WriteString("\x1b[0m")
+		}
+		for ; x < width; x++ {
+			buf.WriteByte(' ')
+		}
+	}
+	s.mu.Unlock()
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeSGR writes the SGR sequence selecting style from a reset state.
+func writeSGR(buf *bytes.Buffer, style Style) {
+	buf.WriteString("\x1b[0")
+	attrs := []struct {
+		attr Attr
+		code string
+	}{
+		{AttrBold, "1"},
+		{AttrDim, "2"},
+		{AttrItalic, "3"},
+		{AttrUnderline, "4"},
+		{AttrBlink, "5"},
+		{AttrReverse, "7"},
+		{AttrHidden, "8"},
+		{AttrStrike, "9"},
+	}
+	for _, a := range attrs {
+		if style.Attr&a.attr != 0 {
+			buf.WriteByte(';')
+			buf.WriteString(a.code)
+		}
+	}
+	writeColor(buf, style.Fg, 30, 90, "38")
+	writeColor(buf, style.Bg, 40, 100, "48")
+	buf.WriteByte('m')
+}
+
+func writeColor(buf *bytes.Buffer, c Color, base, brightBase int, extended string) {
+	switch {
+	case c == DefaultColor:
+		return
+	case c&rgbFlag != 0:
+		buf.WriteByte(';')
+		buf.WriteString(extended)
+		buf.WriteString(";2;")
+		buf.WriteString(strconv.Itoa(int(c>>16) & 0xff))
+		buf.WriteByte(';')
+		buf.WriteString(strconv.Itoa(int(c>>8) & 0xff))
+		buf.WriteByte(';')
+		buf.WriteString(strconv.Itoa(int(c) & 0xff))
+	default:
+		i := int(c & 0xff)
+		buf.WriteByte(';')
+		switch {
+		case i < 8:
+			buf.WriteString(strconv.Itoa(base + i))
+		case i < 16:
+			buf.WriteString(strconv.Itoa(brightBase + i - 8))
+		default:
+			buf.WriteString(extended)
+			buf.WriteString(";5;")
+			buf.WriteString(strconv.Itoa(i))
+		}
+	}
+}
@@ -0,0 +1,780 @@
+// Package vt implements the terminal emulator that keeps the screen contents
+// of every window.
+//
+// A Screen is fed everything a window's program writes. It interprets the
+// VT100/xterm control sequences used by common programs (cursor movement,
+// SGR attributes, scrolling regions, the alternate screen, line wrap and
+// erase operations) and maintains a grid of cells plus the lines scrolled
+// off the top. The model is used to repaint a terminal from scratch and to
+// read the text of the window for copy mode and hardcopy.
+package vt
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// Attr is a set of character attributes.
+type Attr uint16
+
+// Character attributes
+const (
+	AttrBold Attr = 1 << iota
+	AttrDim
+	AttrItalic
+	AttrUnderline
+	AttrBlink
+	AttrReverse
+	AttrHidden
+	AttrStrike
+)
+
+// Color is a cell color: DefaultColor, an entry of the 256-color palette,
+// or a 24-bit RGB color.
+type Color uint32
+
+// DefaultColor is the terminal's default foreground or background.
+const DefaultColor Color = 0
+
+const (
+	paletteFlag Color = 1 << 24
+	rgbFlag     Color = 1 << 25
+)
+
+// PaletteColor returns palette color i (0-255).
+func PaletteColor(i int) Color {
+	return paletteFlag | Color(i&0xff)
+}
+
+// RGBColor returns a 24-bit color.
+func RGBColor(r, g, b uint8) Color {
+	return rgbFlag | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// Style is the rendition of a cell.
+type Style struct {
+	Fg   Color
+	Bg   Color
+	Attr Attr
+}
+
+// Cell is one position of the screen grid. The right half of a double-width
+// character is a cell with Width 0.
+type Cell struct {
+	Rune      rune
+	Combining string // Combining marks following Rune
+	Width     uint8
+	Style     Style
+}
+
+func blankCell(style Style) Cell {
+	// Erased cells keep the background color (bce)
+	return Cell{Rune: ' ', Width: 1, Style: Style{Bg: style.Bg}}
+}
+
+type line struct {
+	cells   []Cell
+	wrapped bool // The line continues on the next line (autowrap)
+}
+
+func newLine(width int, style Style) *line {
+	l := &line{cells: make([]Cell, width)}
+	for i := range l.cells {
+		l.cells[i] = blankCell(style)
+	}
+	return l
+}
+
+// text returns the characters of the line without trailing blanks.
+func (l *line) text() string {
+	var b strings.Builder
+	for _, c := range l.cells {
+		if c.Width == 0 {
+			continue
+		}
+		b.WriteRune(c.Rune)
+		b.WriteString(c.Combining)
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+type cursor struct {
+	x, y     int
+	style    Style
+	origin   bool
+	autowrap bool
+	charsets [2]byte
+	gl       int
+}
+
+// Screen is the state of an emulated terminal. It is safe for concurrent
+// use.
+type Screen struct {
+	mu sync.Mutex
+
+	width, height int
+	lines         []*line
+	primary       []*line // Primary screen lines while the alternate screen is active
+	alt           bool
+	history       []*line
+	maxHistory    int
+
+	x, y      int
+	wrapNext  bool
+	style     Style
+	origin    bool
+	autowrap  bool
+	insert    bool
+	visible   bool
+	charsets  [2]byte // G0 and G1 character sets
+	gl        int     // Character set invoked into GL (SI/SO)
+	top       int     // Scrolling region, inclusive
+	bottom    int
+	tabs      []bool
+	saved     cursor
+	lastRune  rune
+	keypadApp bool
+	modes     map[int]bool // Private modes passed on to the terminal
+	title     string
+	bells     int
+
+	p parser
+}
+
+// NewScreen creates a screen of the given size that keeps up to
+// maxHistory lines scrolled off the top.
+func NewScreen(width, height, maxHistory int) *Screen {
+	if width <= 0 {
+		width = 80
+	}
+	if height <= 0 {
+		height = 24
+	}
+	s := &Screen{
+		width:      width,
+		height:     height,
+		maxHistory: maxHistory,
+	}
+	s.reset()
+	return s
+}
+
+// reset puts the terminal into its power-on state. History is kept.
+func (s *Screen) reset() {
+	s.lines = make([]*line, s.height)
+	for i := range s.lines {
+		s.lines[i] = newLine(s.width, Style{})
+	}
+	s.primary = nil
+	s.alt = false
+	s.x, s.y = 0, 0
+	s.wrapNext = false
+	s.style = Style{}
+	s.origin = false
+	s.autowrap = true
+	s.insert = false
+	s.visible = true
+	s.charsets = [2]byte{'B', 'B'}
+	s.gl = 0
+	s.top, s.bottom = 0, s.height-1
+	s.resetTabs()
+	s.saved = s.cursorState()
+	s.keypadApp = false
+	s.modes = make(map[int]bool)
+}
+
+func (s *Screen) resetTabs() {
+	s.tabs = make([]bool, s.width)
+	for i := 8; i < s.width; i += 8 {
+		s.tabs[i] = true
+	}
+}
+
+// Write feeds program output to the terminal. It never fails.
+func (s *Screen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range p {
+		s.p.feed(s, b)
+	}
+	return len(p), nil
+}
+
+// Size returns the size of the screen.
+func (s *Screen) Size() (width, height int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.width, s.height
+}
+
+// Cursor returns the cursor position, 0-based.
+func (s *Screen) Cursor() (x, y int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.x, s.y
+}
+
+// CursorVisible reports whether the program shows the cursor.
+func (s *Screen) CursorVisible() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.visible
+}
+
+// AltScreen reports whether the alternate screen is active.
+func (s *Screen) AltScreen() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.alt
+}
+
+// Title returns the title last set by the program (OSC 0 or 2).
+func (s *Screen) Title() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.title
+}
+
+// Bells returns how many times the program rang the bell.
+func (s *Screen) Bells() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bells
+}
+
+// Cell returns the cell at column x, row y.
+func (s *Screen) Cell(x, y int) Cell {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if y < 0 || y >= s.height || x < 0 || x >= s.width {
+		return Cell{}
+	}
+	return s.lines[y].cells[x]
+}
+
+// Lines returns the text of the screen rows, without trailing blanks.
+func (s *Screen) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, len(s.lines))
+	for i, l := range s.lines {
+		out[i] = l.text()
+	}
+	return out
+}
+
+// History returns the text of the lines scrolled off the top, oldest first.
+func (s *Screen) History() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, len(s.history))
+	for i, l := range s.history {
+		out[i] = l.text()
+	}
+	return out
+}
+
+// ClearHistory discards the lines scrolled off the top.
+func (s *Screen) ClearHistory() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = nil
+}
+
+// Resize changes the size of the screen. Lines are truncated or padded;
+// when the screen gets shorter, lines above the cursor move to history.
+func (s *Screen) Resize(width, height int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if width <= 0 || height <= 0 || (width == s.width && height == s.height) {
+		return
+	}
+
+	resizeLines := func(lines []*line, keepHistory bool, cursorY int) ([]*line, int) {
+		for _, l := range lines {
+			l.cells = resizeCells(l.cells, width)
+		}
+		if len(lines) > height {
+			// Drop lines from the top while the cursor would fall off,
+			// then from the bottom
+			excess := len(lines) - height
+			fromTop := cursorY - (height - 1)
+			if fromTop < 0 {
+				fromTop = 0
+			}
+			if fromTop > excess {
+				fromTop = excess
+			}
+			if keepHistory {
+				s.pushHistory(lines[:fromTop]...)
+			}
+			lines = lines[fromTop : fromTop+height]
+			cursorY -= fromTop
+		}
+		for len(lines) < height {
+			lines = append(lines, newLine(width, Style{}))
+		}
+		return lines, cursorY
+	}
+
+	if s.alt {
+		// The primary screen cursor was saved when switching (1049)
+		s.primary, s.saved.y = resizeLines(s.primary, true, s.saved.y)
+		s.lines, s.y = resizeLines(s.lines, false, s.y)
+	} else {
+		s.lines, s.y = resizeLines(s.lines, true, s.y)
+	}
+	for _, l := range s.history {
+		if len(l.cells) > width {
+			l.cells = l.cells[:width]
+		}
+	}
+
+	s.width, s.height = width, height
+	s.top, s.bottom = 0, height-1
+	s.resetTabs()
+	s.x = clamp(s.x, 0, width-1)
+	s.y = clamp(s.y, 0, height-1)
+	s.saved.x = clamp(s.saved.x, 0, width-1)
+	s.saved.y = clamp(s.saved.y, 0, height-1)
+	s.wrapNext = false
+}
+
+func resizeCells(cells []Cell, width int) []Cell {
+	if len(cells) >= width {
+		cells = cells[:width]
+		// Do not leave half of a wide character behind
+		if width > 0 && cells[width-1].Width == 2 {
+			cells[width-1] = blankCell(cells[width-1].Style)
+		}
+		return cells
+	}
+	for len(cells) < width {
+		cells = append(cells, blankCell(Style{}))
+	}
+	return cells
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func (s *Screen) pushHistory(lines ...*line) {
+	if s.maxHistory <= 0 || len(lines) == 0 {
+		return
+	}
+	s.history = append(s.history, lines...)
+	if over := len(s.history) - s.maxHistory; over > 0 {
+		s.history = append(s.history[:0:0], s.history[over:]...)
+	}
+}
+
+func (s *Screen) cursorState() cursor {
+	return cursor{
+		x:        s.x,
+		y:        s.y,
+		style:    s.style,
+		origin:   s.origin,
+		autowrap: s.autowrap,
+		charsets: s.charsets,
+		gl:       s.gl,
+	}
+}
+
+// saveCursor implements DECSC.
+func (s *Screen) saveCursor() {
+	s.saved = s.cursorState()
+}
+
+// restoreCursor implements DECRC.
+func (s *Screen) restoreCursor() {
+	c := s.saved
+	s.x = clamp(c.x, 0, s.width-1)
+	s.y = clamp(c.y, 0, s.height-1)
+	s.style = c.style
+	s.origin = c.origin
+	s.autowrap = c.autowrap
+	s.charsets = c.charsets
+	s.gl = c.gl
+	s.wrapNext = false
+}
+
+// setAltScreen switches between the primary and alternate screen.
+func (s *Screen) setAltScreen(on bool, clear bool) {
+	if on == s.alt {
+		if on && clear {
+			s.eraseLines(0, s.height)
+		}
+		return
+	}
+	if on {
+		s.primary = s.lines
+		s.lines = make([]*line, s.height)
+		for i := range s.lines {
+			s.lines[i] = newLine(s.width, Style{})
+		}
+	} else {
+		s.lines = s.primary
+		s.primary = nil
+	}
+	s.alt = on
+	s.wrapNext = false
+}
+
+// put writes a printable character at the cursor.
+func (s *Screen) put(r rune) {
+	if s.charsets[s.gl] == '0' && r >= 0x5f && r <= 0x7e {
+		r = decGraphics[r-0x5f]
+	}
+
+	w := runeWidth(r)
+	if w == 0 {
+		s.combine(r)
+		return
+	}
+
+	if s.wrapNext {
+		if s.autowrap {
+			s.lines[s.y].wrapped = true
+			s.carriageReturn()
+			s.index()
+		}
+		s.wrapNext = false
+	}
+	if w == 2 && s.x == s.width-1 {
+		if !s.autowrap {
+			return
+		}
+		// A wide character does not fit in the last column
+		s.setCell(s.x, blankCell(s.style))
+		s.lines[s.y].wrapped = true
+		s.carriageReturn()
+		s.index()
+	}
+	if w > s.width {
+		return
+	}
+
+	if s.insert {
+		s.insertCells(w)
+	}
+	s.setCell(s.x, Cell{Rune: r, Width: uint8(w), Style: s.style})
+	if w == 2 {
+		s.setCell(s.x+1, Cell{Width: 0, Style: s.style})
+	}
+	s.lastRune = r
+
+	if s.x+w >= s.width {
+		s.x = s.width - 1
+		s.wrapNext = true
+	} else {
+		s.x += w
+	}
+}
+
+// combine attaches a zero-width character to the previous cell.
+func (s *Screen) combine(r rune) {
+	x, y := s.x-1, s.y
+	if s.wrapNext {
+		x = s.x
+	}
+	if x < 0 {
+		return
+	}
+	cells := s.lines[y].cells
+	if cells[x].Width == 0 && x > 0 {
+		x--
+	}
+	cells[x].Combining += string(r)
+}
+
+// setCell stores c at column x of the cursor row, clearing the other half
+// of any wide character it overwrites.
+func (s *Screen) setCell(x int, c Cell) {
+	cells := s.lines[s.y].cells
+	if x < 0 || x >= len(cells) {
+		return
+	}
+	old := cells[x]
+	if old.Width == 0 && x > 0 && cells[x-1].Width == 2 {
+		cells[x-1] = blankCell(cells[x-1].Style)
+	}
+	if old.Width == 2 && x+1 < len(cells) && c.Width != 2 {
+		cells[x+1] = blankCell(cells[x+1].Style)
+	}
+	cells[x] = c
+}
+
+func runeWidth(r rune) int {
+	if r < 0x300 {
+		return 1
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// carriageReturn moves the cursor to the first column.
+func (s *Screen) carriageReturn() {
+	s.x = 0
+	s.wrapNext = false
+}
+
+// index moves the cursor down, scrolling at the bottom of the region.
+func (s *Screen) index() {
+	switch {
+	case s.y == s.bottom:
+		s.scrollUp(1)
+	case s.y < s.height-1:
+		s.y++
+	}
+	s.wrapNext = false
+}
+
+// reverseIndex moves the cursor up, scrolling at the top of the region.
+func (s *Screen) reverseIndex() {
+	switch {
+	case s.y == s.top:
+		s.scrollDown(1)
+	case s.y > 0:
+		s.y--
+	}
+	s.wrapNext = false
+}
+
+// scrollUp scrolls the region up by n lines. Lines leaving a region that
+// starts at the top of the primary screen go to history.
+func (s *Screen) scrollUp(n int) {
+	size := s.bottom - s.top + 1
+	n = clamp(n, 0, size)
+	if n == 0 {
+		return
+	}
+	removed := make([]*line, n)
+	copy(removed, s.lines[s.top:s.top+n])
+	copy(s.lines[s.top:], s.lines[s.top+n:s.bottom+1])
+	for i := s.bottom - n + 1; i <= s.bottom; i++ {
+		s.lines[i] = newLine(s.width, s.style)
+	}
+	if s.top == 0 && !s.alt {
+		s.pushHistory(removed...)
+	}
+}
+
+// scrollDown scrolls the region down by n lines.
+func (s *Screen) scrollDown(n int) {
+	size := s.bottom - s.top + 1
+	n = clamp(n, 0, size)
+	if n == 0 {
+		return
+	}
+	copy(s.lines[s.top+n:s.bottom+1], s.lines[s.top:s.bottom+1-n])
+	for i := s.top; i < s.top+n; i++ {
+		s.lines[i] = newLine(s.width, s.style)
+	}
+}
+
+// moveTo moves the cursor to column x, row y (0-based, relative to the
+// scrolling region in origin mode).
+func (s *Screen) moveTo(x, y int) {
+	top, bottom := 0, s.height-1
+	if s.origin {
+		top, bottom = s.top, s.bottom
+		y += top
+	}
+	s.x = clamp(x, 0, s.width-1)
+	s.y = clamp(y, top, bottom)
+	s.wrapNext = false
+}
+
+// moveRows moves the cursor up (n < 0) or down, stopping at the margins of
+// the scrolling region when it starts inside it.
+func (s *Screen) moveRows(n int) {
+	top, bottom := 0, s.height-1
+	if s.y >= s.top && s.y <= s.bottom {
+		top, bottom = s.top, s.bottom
+	}
+	s.y = clamp(s.y+n, top, bottom)
+	s.wrapNext = false
+}
+
+func (s *Screen) moveCols(n int) {
+	s.x = clamp(s.x+n, 0, s.width-1)
+	s.wrapNext = false
+}
+
+// eraseLines blanks rows [from, to).
+func (s *Screen) eraseLines(from, to int) {
+	for i := from; i < to; i++ {
+		s.lines[i] = newLine(s.width, s.style)
+	}
+}
+
+// eraseCells blanks columns [from, to) of the cursor row.
+func (s *Screen) eraseCells(from, to int) {
+	from, to = clamp(from, 0, s.width), clamp(to, 0, s.width)
+	for i := from; i < to; i++ {
+		s.setCell(i, blankCell(s.style))
+	}
+	if to == s.width {
+		s.lines[s.y].wrapped = false
+	}
+}
+
+// eraseDisplay implements ED.
+func (s *Screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseCells(s.x, s.width)
+		s.eraseLines(s.y+1, s.height)
+	case 1:
+		s.eraseLines(0, s.y)
+		s.eraseCells(0, s.x+1)
+	case 2:
+		s.eraseLines(0, s.height)
+	case 3:
+		s.eraseLines(0, s.height)
+		s.history = nil
+	}
+	s.wrapNext = false
+}
+
+// eraseLine implements EL.
+func (s *Screen) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		s.eraseCells(s.x, s.width)
+	case 1:
+		s.eraseCells(0, s.x+1)
+	case 2:
+		s.eraseCells(0, s.width)
+	}
+	s.wrapNext = false
+}
+
+// insertCells shifts the cells from the cursor right by n (ICH).
+func (s *Screen) insertCells(n int) {
+	cells := s.lines[s.y].cells
+	n = clamp(n, 0, s.width-s.x)
+	copy(cells[s.x+n:], cells[s.x:s.width-n])
+	for i := s.x; i < s.x+n; i++ {
+		cells[i] = blankCell(s.style)
+	}
+	fixWideCells(cells)
+}
+
+// deleteCells removes n cells at the cursor, shifting the rest left (DCH).
+func (s *Screen) deleteCells(n int) {
+	cells := s.lines[s.y].cells
+	n = clamp(n, 0, s.width-s.x)
+	copy(cells[s.x:], cells[s.x+n:])
+	for i := s.width - n; i < s.width; i++ {
+		cells[i] = blankCell(s.style)
+	}
+	fixWideCells(cells)
+	s.wrapNext = false
+}
+
+// fixWideCells blanks halves of wide characters split by a shift.
+func fixWideCells(cells []Cell) {
+	for i, c := range cells {
+		switch {
+		case c.Width == 2 && (i+1 >= len(cells) || cells[i+1].Width != 0):
+			cells[i] = blankCell(c.Style)
+		case c.Width == 0 && (i == 0 || cells[i-1].Width != 2):
+			cells[i] = blankCell(c.Style)
+		}
+	}
+}
+
+// insertLines inserts n blank lines at the cursor row (IL).
+func (s *Screen) insertLines(n int) {
+	if s.y < s.top || s.y > s.bottom {
+		return
+	}
+	top := s.top
+	s.top = s.y
+	s.scrollDown(n)
+	s.top = top
+	s.carriageReturn()
+}
+
+// deleteLines deletes n lines at the cursor row (DL).
+func (s *Screen) deleteLines(n int) {
+	if s.y < s.top || s.y > s.bottom {
+		return
+	}
+	top := s.top
+	s.top = s.y
+	size := s.bottom - s.top + 1
+	n = clamp(n, 0, size)
+	copy(s.lines[s.top:], s.lines[s.top+n:s.bottom+1])
+	for i := s.bottom - n + 1; i <= s.bottom; i++ {
+		s.lines[i] = newLine(s.width, s.style)
+	}
+	s.top = top
+	s.carriageReturn()
+}
+
+// tab moves the cursor to the next (n > 0) or previous tab stop.
+func (s *Screen) tab(n int) {
+	for ; n > 0 && s.x < s.width-1; n-- {
+		s.x++
+		for s.x < s.width-1 && !s.tabs[s.x] {
+			s.x++
+		}
+	}
+	for ; n < 0 && s.x > 0; n++ {
+		s.x--
+		for s.x > 0 && !s.tabs[s.x] {
+			s.x--
+		}
+	}
+	s.wrapNext = false
+}
+
+// setScrollRegion implements DECSTBM with 1-based margins.
+func (s *Screen) setScrollRegion(top, bottom int) {
+	if top <= 0 {
+		top = 1
+	}
+	if bottom <= 0 || bottom > s.height {
+		bottom = s.height
+	}
+	if top >= bottom {
+		return
+	}
+	s.top, s.bottom = top-1, bottom-1
+	s.moveTo(0, 0)
+}
+
+// alignmentTest implements DECALN: fill the screen with 'E'.
+func (s *Screen) alignmentTest() {
+	for _, l := range s.lines {
+		for i := range l.cells {
+			l.cells[i] = Cell{Rune: 'E', Width: 1}
+		}
+	}
+	s.top, s.bottom = 0, s.height-1
+	s.moveTo(0, 0)
+}
+
+// decGraphics maps 0x5f-0x7e to the DEC special graphics characters.
+var decGraphics = [...]rune{
+	' ', '◆', '▒', '␉', '␌', '␍', '␊', '°', '±', '␤', '␋', '┘', '┐', '┌', '└', '┼',
+	'⎺', '⎻', '─', '⎼', '⎽', '├', '┤', '┴', '┬', '│', '≤', '≥', 'π', '≠', '£', '·',
+}
@@ -0,0 +1,270 @@
+package vt
+
+import (
+	"strings"
+	"testing"
+)
+
+func feed(s *Screen, data string) {
+	_, _ = s.Write([]byte(data))
+}
+
+func checkLines(t *testing.T, s *Screen, want ...string) {
+	t.Helper()
+	got := s.Lines()
+	for i, w := range want {
+		if got[i] != w {
+			t.Fatalf("line %d = %q, want %q (screen %q)", i, got[i], w, got)
+		}
+	}
+}
+
+func checkCursor(t *testing.T, s *Screen, x, y int) {
+	t.Helper()
+	if cx, cy := s.Cursor(); cx != x || cy != y {
+		t.Fatalf("cursor = %d,%d, want %d,%d", cx, cy, x, y)
+	}
+}
+
+func TestPrintAndCursorMovement(t *testing.T) {
+	s := NewScreen(20, 5, 100)
+	feed(s, "hello\r\nworld")
+	checkLines(t, s, "hello", "world", "")
+	checkCursor(t, s, 5, 1)
+
+	feed(s, "\x1b[1;3HX\x1b[2BY\x1b[10GZ")
+	checkLines(t, s, "heXlo", "world", "   Y     Z")
+	checkCursor(t, s, 10, 2)
+
+	feed(s, "\x1b[H\x1b[3C\x1b[A\x1b[DQ")
+	checkLines(t, s, "heQlo")
+}
+
+func TestLineWrapAndHistory(t *testing.T) {
+	s := NewScreen(5, 3, 10)
+	feed(s, "abcdefgh")
+	checkLines(t, s, "abcde", "fgh")
+	checkCursor(t, s, 3, 1)
+
+	// Writing into the last column defers the wrap
+	s = NewScreen(5, 3, 10)
+	feed(s, "abcde")
+	checkCursor(t, s, 4, 0)
+	feed(s, "\r\n")
+	checkLines(t, s, "abcde", "")
+
+	s = NewScreen(5, 2, 2)
+	feed(s, "1\r\n2\r\n3\r\n4\r\n5")
+	checkLines(t, s, "4", "5")
+	if got := strings.Join(s.History(), ","); got != "2,3" {
+		t.Fatalf("history = %q, want 2,3", got)
+	}
+
+	feed(s, "\x1b[?7l\rabcdefg")
+	checkLines(t, s, "4", "abcdg")
+}
+
+func TestEraseOperations(t *testing.T) {
+	s := NewScreen(10, 3, 0)
+	feed(s, "0123456789\r\nabcdefghij\r\nABCDEFGHIJ")
+	feed(s, "\x1b[2;5H\x1b[K")
+	checkLines(t, s, "0123456789", "abcd", "ABCDEFGHIJ")
+	feed(s, "\x1b[1K")
+	checkLines(t, s, "0123456789", "", "ABCDEFGHIJ")
+	feed(s, "\x1b[3;3H\x1b[2X")
+	checkLines(t, s, "0123456789", "", "AB  EFGHIJ")
+	feed(s, "\x1b[P")
+	checkLines(t, s, "0123456789", "", "AB EFGHIJ")
+	feed(s, "\x1b[2@")
+	checkLines(t, s, "0123456789", "", "AB   EFGHI")
+	feed(s, "\x1b[1;5H\x1b[J")
+	checkLines(t, s, "0123", "", "")
+	feed(s, "\x1b[2J")
+	checkLines(t, s, "", "", "")
+}
+
+func TestScrollRegion(t *testing.T) {
+	s := NewScreen(10, 5, 10)
+	feed(s, "top\r\na\r\nb\r\nc\r\nbottom")
+	feed(s, "\x1b[2;4r")
+	checkCursor(t, s, 0, 0)
+	feed(s, "\x1b[4;1H\nd")
+	checkLines(t, s, "top", "b", "c", "d", "bottom")
+	if len(s.History()) != 0 {
+		t.Fatalf("scrolling a region must not add history: %q", s.History())
+	}
+
+	feed(s, "\x1b[2;1H\x1bM")
+	checkLines(t, s, "top", "", "b", "c", "bottom")
+
+	feed(s, "\x1b[3;1H\x1b[L")
+	checkLines(t, s, "top", "", "", "b", "bottom")
+	feed(s, "\x1b[2M")
+	checkLines(t, s, "top", "", "", "", "bottom")
+}
+
+func TestAlternateScreen(t *testing.T) {
+	s := NewScreen(10, 3, 10)
+	feed(s, "shell$ vi")
+	feed(s, "\x1b[?1049h")
+	if !s.AltScreen() {
+		t.Fatalf("alternate screen not active")
+	}
+	checkLines(t, s, "", "", "")
+	feed(s, "\x1b[Hediting\r\n\r\n\r\n\r\nmore")
+	if len(s.History()) != 0 {
+		t.Fatalf("alternate screen added history: %q", s.History())
+	}
+	feed(s, "\x1b[?1049l")
+	checkLines(t, s, "shell$ vi")
+	checkCursor(t, s, 9, 0)
+}
+
+func TestSGRAttributes(t *testing.T) {
+	s := NewScreen(10, 2, 0)
+	feed(s, "\x1b[1;31ma\x1b[38;5;200;48;2;1;2;3mb\x1b[22;39mc\x1b[0md")
+
+	if c := s.Cell(0, 0); c.Style != (Style{Fg: PaletteColor(1), Attr: AttrBold}) {
+		t.Fatalf("cell a style = %+v", c.Style)
+	}
+	if c := s.Cell(1, 0); c.Style != (Style{Fg: PaletteColor(200), Bg: RGBColor(1, 2, 3), Attr: AttrBold}) {
+		t.Fatalf("cell b style = %+v", c.Style)
+	}
+	if c := s.Cell(2, 0); c.Style != (Style{Bg: RGBColor(1, 2, 3)}) {
+		t.Fatalf("cell c style = %+v", c.Style)
+	}
+	if c := s.Cell(3, 0); c.Style != (Style{}) {
+		t.Fatalf("cell d style = %+v", c.Style)
+	}
+}
+
+func TestWideAndUTF8Characters(t *testing.T) {
+	s := NewScreen(6, 2, 0)
+	// Split a multi-byte character across writes
+	data := []byte("a日b")
+	_, _ = s.Write(data[:2])
+	_, _ = s.Write(data[2:])
+	checkLines(t, s, "a日b")
+	checkCursor(t, s, 4, 0)
+	if c := s.Cell(2, 0); c.Width != 0 {
+		t.Fatalf("right half of wide character has width %d", c.Width)
+	}
+
+	// Overwriting half of a wide character clears the other half
+	feed(s, "\x1b[1;3Hx")
+	checkLines(t, s, "a xb")
+
+	// A wide character does not fit in the last column
+	feed(s, "\x1b[1;6H本")
+	checkLines(t, s, "a xb", "本")
+
+	s = NewScreen(6, 1, 0)
+	feed(s, "é!")
+	checkLines(t, s, "é!")
+}
+
+func TestTitleAndIgnoredStrings(t *testing.T) {
+	s := NewScreen(10, 2, 0)
+	feed(s, "\x1b]2;my title\x07\x1bPignored\x1b\\ok")
+	if got := s.Title(); got != "my title" {
+		t.Fatalf("title = %q, want %q", got, "my title")
+	}
+	feed(s, "\x1b]0;other\x1b\\")
+	if got := s.Title(); got != "other" {
+		t.Fatalf("title = %q, want %q", got, "other")
+	}
+	checkLines(t, s, "ok")
+	if got := s.Bells(); got != 0 {
+		t.Fatalf("string terminators rang the bell %d times", got)
+	}
+	feed(s, "\a\x07")
+	if got := s.Bells(); got != 2 {
+		t.Fatalf("bells = %d, want 2", got)
+	}
+}
+
+func TestLineDrawingCharset(t *testing.T) {
+	s := NewScreen(10, 1, 0)
+	feed(s, "\x1b(0lqk\x1b(Bx")
+	checkLines(t, s, "┌─┐x")
+}
+
+func TestResize(t *testing.T) {
+	s := NewScreen(10, 4, 10)
+	feed(s, "1\r\n2\r\n3\r\n4")
+	s.Resize(5, 2)
+	checkLines(t, s, "3", "4")
+	checkCursor(t, s, 1, 1)
+	if got := strings.Join(s.History(), ","); got != "1,2" {
+		t.Fatalf("history = %q, want 1,2", got)
+	}
+	s.Resize(8, 3)
+	checkLines(t, s, "3", "4", "")
+	if w, h := s.Size(); w != 8 || h != 3 {
+		t.Fatalf("size = %dx%d, want 8x3", w, h)
+	}
+}
+
+func TestRenderReproducesScreen(t *testing.T) {
+	s := NewScreen(20, 6, 10)
+	feed(s, "plain \x1b[1;4;32mgreen\x1b[0m\r\n")
+	feed(s, "\x1b[7mreverse\x1b[m 日本\r\n")
+	feed(s, "\x1b[3;5r\x1b[?1h\x1b[?25l\x1b[5;3H\x1b[33m")
+
+	var out strings.Builder
+	if err := s.Render(&out); err != nil {
+		t.Fatalf("Render error: %v", err)
+	}
+
+	// Feeding the repaint to a fresh terminal gives the same state
+	r := NewScreen(20, 6, 0)
+	feed(r, out.String())
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 20; x++ {
+			if got, want := r.Cell(x, y), s.Cell(x, y); got != want {
+				t.Fatalf("cell %d,%d = %+v, want %+v", x, y, got, want)
+			}
+		}
+	}
+	if x, y := r.Cursor(); x != 2 || y != 4 {
+		t.Fatalf("rendered cursor = %d,%d, want 2,4", x, y)
+	}
+	if r.CursorVisible() {
+		t.Fatalf("rendered cursor visible, want hidden")
+	}
+	if r.top != 2 || r.bottom != 4 || !r.modes[1] || r.style.Fg != PaletteColor(3) {
+		t.Fatalf("rendered state: region %d-%d modes %v style %+v", r.top, r.bottom, r.modes, r.style)
+	}
+}
+
+func TestRenderRegionPaintsAtOffset(t *testing.T) {
+	s := NewScreen(6, 2, 0)
+	feed(s, "ab\x1b[1mcdef\x1b[0m\r\n日本")
+
+	var out strings.Builder
+	if err := s.RenderRegion(&out, 3, 1, 4, 3); err != nil {
+		t.Fatalf("RenderRegion error: %v", err)
+	}
+
+	// The rectangle is clipped to 4 columns and padded to 3 rows
+	r := NewScreen(10, 5, 0)
+	feed(r, "##########\r\n##########\r\n##########\r\n##########\r\n##########")
+	feed(r, out.String())
+	checkLines(t, r, "##########", "###abcd###", "###日本###", "###    ###", "##########")
+	if got := r.Cell(5, 1).Style.Attr; got != AttrBold {
+		t.Fatalf("cell 5,1 attributes = %v, want bold", got)
+	}
+}
+
+func TestRepeatIsCappedAtTheScreenSize(t *testing.T) {
+	s := NewScreen(5, 2, 100)
+	feed(s, "ab\x1b[3b")
+	checkLines(t, s, "abbbb")
+
+	// A huge count repeats no more than the screen holds
+	feed(s, "\r\nx\x1b[999999b")
+	if n := len(s.History()); n > 3 {
+		t.Fatalf("history after a huge repeat has %d lines, want at most 3", n)
+	}
+	checkLines(t, s, "xxxxx", "x")
+}
@@ -0,0 +1,1272 @@
+//go:build !windows
+// +build !windows
+
+package behavior
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// --- B2.* Interactive tests (attach through a PTY) ---
+
+const interactiveTimeout = 10 * time.Second
+
+// interactiveEnv returns the environment for interactive sgreen runs using
+// homeDir for session state.
+func interactiveEnv(homeDir string) map[string]string {
+	return map[string]string{
+		"HOME":  homeDir,
+		"SHELL": "/bin/sh",
+		"TERM":  "xterm",
+		"PS1":   "$ ",
+	}
+}
+
+// terminal is an sgreen client running on a PTY.
+type terminal struct {
+	tb   testing.TB
+	cmd  *exec.Cmd
+	ptmx *os.File
+
+	mu   sync.Mutex
+	out  bytes.Buffer
+	done chan struct{}
+}
+
+func startTerminal(tb testing.TB, args []string, extraEnv map[string]string) *terminal {
+	tb.Helper()
+	return startTerminalCmd(tb, sgreenCmd(tb, args), extraEnv)
+}
+
+// startShellTerminal runs an sgreen client with args from a shell that
+// prints "shell-survived" once the client returns.
+func startShellTerminal(tb testing.TB, args []string, extraEnv map[string]string) *terminal {
+	tb.Helper()
+	client := sgreenCmd(tb, args)
+	cmd := exec.Command("/bin/sh", "-c", `"$0" "$@"; echo shell-survived`)
+	cmd.Args = append(cmd.Args, client.Args...)
+	cmd.Dir = client.Dir
+	return startTerminalCmd(tb, cmd, extraEnv)
+}
+
+func startTerminalCmd(tb testing.TB, cmd *exec.Cmd, extraEnv map[string]string) *terminal {
+	tb.Helper()
+	env := os.Environ()
+	for k, v := range extraEnv {
+		env = setEnv(env, k, v)
+	}
+	cmd.Env = env
+
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: 24, Cols: 80})
+	if err != nil {
+		tb.Fatalf("start %v on a pty: %v", cmd.Args, err)
+	}
+	t := &terminal{tb: tb, cmd: cmd, ptmx: ptmx, done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		buf := make([]byte, 4096)
+		for {
+			n, err := ptmx.Read(buf)
+			if n > 0 {
+				t.mu.Lock()
+				t.out.Write(buf[:n])
+				t.mu.Unlock()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	tb.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = ptmx.Close()
+	})
+	return t
+}
+
+func (t *terminal) send(keys string) {
+	t.tb.Helper()
+	if _, err := io.WriteString(t.ptmx, keys); err != nil {
+		t.tb.Fatalf("write to sgreen: %v", err)
+	}
+	// Give the server time to act on window commands
+	time.Sleep(200 * time.Millisecond)
+}
+
+func (t *terminal) output() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.out.String()
+}
+
+// wait waits for the client to exit and for its output to be read to the
+// end, and returns its exit code.
+func (t *terminal) wait() int {
+	t.tb.Helper()
+	exited := make(chan error, 1)
+	go func() {
+		exited <- t.cmd.Wait()
+	}()
+	timeout := time.After(interactiveTimeout)
+	var err error
+	select {
+	case err = <-exited:
+	case <-timeout:
+		t.tb.Fatalf("sgreen did not exit\n%s", t.output())
+		return -1
+	}
+	select {
+	case <-t.done:
+	case <-timeout:
+		t.tb.Fatalf("sgreen output did not end\n%s", t.output())
+		return -1
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+// waitForFile waits until path exists with non-empty content and returns it.
+func waitForFile(tb testing.TB, path string) string {
+	tb.Helper()
+	deadline := time.Now().Add(interactiveTimeout)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(path); err == nil && len(bytes.TrimSpace(data)) > 0 {
+			return strings.TrimSpace(string(data))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	tb.Fatalf("timed out waiting for %s", path)
+	return ""
+}
+
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
+
+func TestAllWindowsSurviveDetach(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "multi", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "multi"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS multi: exit code %d\n%s", code, out)
+	}
+
+	// Open two more windows and record the shell PID of each window
+	term := startTerminal(t, []string{"-r", "multi"}, env)
+	const windows = 3
+	for i := 0; i < windows; i++ {
+		if i > 0 {
+			term.send("\x01c")
+		}
+		term.send(fmt.Sprintf("echo $$ > %s\r", filepath.Join(homeDir, fmt.Sprintf("pid%d", i))))
+	}
+	pids := make([]int, windows)
+	for i := range pids {
+		pid, err := strconv.Atoi(waitForFile(t, filepath.Join(homeDir, fmt.Sprintf("pid%d", i))))
+		if err != nil {
+			t.Fatalf("window %d pid: %v", i, err)
+		}
+		pids[i] = pid
+	}
+	term.send("\x01d")
+	if code := term.wait(); code != 0 {
+		t.Fatalf("detach: exit code %d, want 0\n%s", code, term.output())
+	}
+
+	for i, pid := range pids {
+		if !processAlive(pid) {
+			t.Fatalf("window %d (pid %d) did not survive detach", i, pid)
+		}
+	}
+
+	// Every window is reachable through its own PTY after reattaching
+	term = startTerminal(t, []string{"-r", "multi"}, env)
+	for i := 0; i < windows; i++ {
+		term.send(fmt.Sprintf("\x01%d", i))
+		term.send(fmt.Sprintf("echo $$ > %s\r", filepath.Join(homeDir, fmt.Sprintf("again%d", i))))
+	}
+	for i, pid := range pids {
+		got := waitForFile(t, filepath.Join(homeDir, fmt.Sprintf("again%d", i)))
+		if got != strconv.Itoa(pid) {
+			t.Fatalf("window %d answered from pid %s, want %d", i, got, pid)
+		}
+	}
+	term.send("\x01d")
+	if code := term.wait(); code != 0 {
+		t.Fatalf("second detach: exit code %d, want 0\n%s", code, term.output())
+	}
+}
+
+func TestWipeKeepsLiveSession(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "alive", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "alive"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS alive: exit code %d\n%s", code, out)
+	}
+	out, _ = runSgreen(t, []string{"-wipe"}, env)
+	if strings.Contains(out, "Removed") {
+		t.Fatalf("sgreen -wipe removed a live session\n%s", out)
+	}
+
+	out, code = runSgreen(t, []string{"-ls"}, env)
+	if code != 0 || !strings.Contains(out, "(alive)") || !strings.Contains(out, "(Detached)") {
+		t.Fatalf("sgreen -ls after -wipe: exit code %d, want the live session detached\n%s", code, out)
+	}
+}
+
+func TestDetachedOutputIsLoggedAndBellsQueued(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "busy", "-X", "quit"}, env)
+	})
+
+	// The window rings the bell and finishes its output before anyone attaches
+	script := "echo built-while-detached; printf '\\a'; echo ok > " + filepath.Join(homeDir, "done") + "; sleep 30"
+	out, code := runSgreen(t, []string{"-L", "-dmS", "busy", "/bin/sh", "-c", script}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -L -dmS busy: exit code %d\n%s", code, out)
+	}
+	waitForFile(t, filepath.Join(homeDir, "done"))
+	// The monitor writes the log as the output arrives
+	deadline := time.Now().Add(interactiveTimeout)
+	for {
+		logs, _ := filepath.Glob(filepath.Join(homeDir, ".sgreen", "logs", "window-0*.log"))
+		log := ""
+		if len(logs) == 1 {
+			data, _ := os.ReadFile(logs[0])
+			log = string(data)
+		}
+		if strings.Contains(log, "built-while-detached") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("window logs = %v, want one log for window 0 with the detached output: %q", logs, log)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	term := startTerminal(t, []string{"-r", "busy"}, env)
+	deadline = time.Now().Add(interactiveTimeout)
+	for !strings.Contains(term.output(), "Bell in window 0") {
+		if time.Now().After(deadline) {
+			t.Fatalf("the bell rung while detached was not shown on attach\n%q", term.output())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	term.send("\x01d")
+	if code := term.wait(); code != 0 {
+		t.Fatalf("detach: exit code %d, want 0\n%s", code, term.output())
+	}
+}
+
+// waitForList waits until -ls output contains want and returns it.
+func waitForList(tb testing.TB, env map[string]string, want string) string {
+	tb.Helper()
+	deadline := time.Now().Add(interactiveTimeout)
+	for {
+		out, _ := runSgreen(tb, []string{"-ls"}, env)
+		if strings.Contains(out, want) {
+			return out
+		}
+		if time.Now().After(deadline) {
+			tb.Fatalf("sgreen -ls never showed %q\n%s", want, out)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestListShowsAttachedClients(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "shared", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "shared"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS shared: exit code %d\n%s", code, out)
+	}
+	waitForList(t, env, "(Detached)")
+
+	first := startTerminal(t, []string{"-r", "shared"}, env)
+	waitForList(t, env, "(Attached)")
+
+	// A plain -r does not take over an attached session
+	out, code = runSgreenWithPTY(t, []string{"-r", "shared"}, env)
+	if code == 0 || !strings.Contains(out, "is attached") {
+		t.Fatalf("sgreen -r on an attached session: exit code %d, want a refusal\n%s", code, out)
+	}
+
+	second := startTerminal(t, []string{"-x", "shared"}, env)
+	waitForList(t, env, "(Multi, attached)")
+
+	for _, term := range []*terminal{second, first} {
+		term.send("\x01d")
+		if code := term.wait(); code != 0 {
+			t.Fatalf("detach: exit code %d, want 0\n%s", code, term.output())
+		}
+	}
+	waitForList(t, env, "(Detached)")
+}
+
+func TestRemoteDetachAndSteal(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "steal", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "steal"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS steal: exit code %d\n%s", code, out)
+	}
+
+	// -d sends the attached client back to its shell
+	first := startShellTerminal(t, []string{"-r", "steal"}, env)
+	waitForList(t, env, "(Attached)")
+	out, code = runSgreen(t, []string{"-d", "steal"}, env)
+	if code != 0 || !strings.Contains(out, "detached") {
+		t.Fatalf("sgreen -d steal: exit code %d\n%s", code, out)
+	}
+	if code := first.wait(); code != 0 || !strings.Contains(first.output(), "shell-survived") {
+		t.Fatalf("remote detach: exit code %d, want the client's shell to go on\n%s", code, first.output())
+	}
+	waitForList(t, env, "(Detached)")
+
+	// -d -r takes the session over from another terminal
+	second := startTerminal(t, []string{"-r", "steal"}, env)
+	waitForList(t, env, "(Attached)")
+	third := startTerminal(t, []string{"-d", "-r", "steal"}, env)
+	if code := second.wait(); code != 0 {
+		t.Fatalf("stolen client: exit code %d, want 0\n%s", code, second.output())
+	}
+	out = waitForList(t, env, "(Attached)")
+	if strings.Contains(out, "Multi") {
+		t.Fatalf("session still attached to the old terminal\n%s", out)
+	}
+
+	// -D also hangs up the shell the client was started from
+	third.send("\x01d")
+	if code := third.wait(); code != 0 {
+		t.Fatalf("detach: exit code %d, want 0\n%s", code, third.output())
+	}
+	fourth := startShellTerminal(t, []string{"-r", "steal"}, env)
+	waitForList(t, env, "(Attached)")
+	out, code = runSgreen(t, []string{"-D", "steal"}, env)
+	if code != 0 || !strings.Contains(out, "power detached") {
+		t.Fatalf("sgreen -D steal: exit code %d\n%s", code, out)
+	}
+	fourth.wait()
+	if strings.Contains(fourth.output(), "shell-survived") {
+		t.Fatalf("power detach did not hang up the client's shell\n%s", fourth.output())
+	}
+	waitForList(t, env, "(Detached)")
+}
+
+// listing is a session as listed by -ls --json
+type listing struct {
+	ID        string `json:"id"`
+	ServerPid int    `json:"server_pid"`
+	State     string `json:"state"`
+	Windows   []struct {
+		Number     string    `json:"number"`
+		Title      string    `json:"title"`
+		Command    []string  `json:"command"`
+		Alive      bool      `json:"alive"`
+		ExitStatus *int      `json:"exit_status"`
+		EndedAt    time.Time `json:"ended_at"`
+		Type       string    `json:"type"`
+		Group      string    `json:"group"`
+	} `json:"windows"`
+}
+
+// listSessions returns the sessions listed by -ls --json.
+func listSessions(tb testing.TB, env map[string]string) []listing {
+	tb.Helper()
+	out, code := runSgreen(tb, []string{"-ls", "--json"}, env)
+	if code != 0 {
+		tb.Fatalf("sgreen -ls --json: exit code %d\n%s", code, out)
+	}
+	var listings []listing
+	if err := json.Unmarshal([]byte(out), &listings); err != nil {
+		tb.Fatalf("sgreen -ls --json: %v\n%s", err, out)
+	}
+	return listings
+}
+
+func TestListJSON(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "tools", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "tools", "-t", "editor", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS tools: exit code %d\n%s", code, out)
+	}
+	waitForList(t, env, "(Detached)")
+
+	listings := listSessions(t, env)
+	if len(listings) != 1 || listings[0].ID != "tools" || listings[0].State != "detached" {
+		t.Fatalf("sgreen -ls --json: want the detached session tools\n%+v", listings)
+	}
+	windows := listings[0].Windows
+	if len(windows) != 1 || windows[0].Number != "0" || windows[0].Title != "editor" ||
+		!windows[0].Alive || len(windows[0].Command) == 0 || windows[0].Command[0] != "/bin/sh" {
+		t.Fatalf("sgreen -ls --json: want one live /bin/sh window titled editor\n%+v", windows)
+	}
+}
+
+func TestProgramArgumentsAreNotSendCommands(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "tunnel", "-X", "quit"}, env)
+	})
+
+	// A stand-in for ssh, so that -X host reaches the window's program.
+	ssh := filepath.Join(t.TempDir(), "ssh")
+	if err := os.WriteFile(ssh, []byte("#!/bin/sh\nexec sleep 60\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	out, code := runSgreen(t, []string{"-dmS", "tunnel", ssh, "-X", "host"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS tunnel ssh -X host: exit code %d\n%s", code, out)
+	}
+	waitForList(t, env, "(Detached)")
+
+	listings := listSessions(t, env)
+	if len(listings) != 1 || listings[0].ID != "tunnel" || len(listings[0].Windows) != 1 {
+		t.Fatalf("sgreen -ls --json: want the session tunnel with one window\n%+v", listings)
+	}
+	if got := strings.Join(listings[0].Windows[0].Command, " "); got != ssh+" -X host" {
+		t.Fatalf("window command = %q, want %q", got, ssh+" -X host")
+	}
+}
+
+func TestRemoteCommands(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "remote", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "remote"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS remote: exit code %d\n%s", code, out)
+	}
+	for _, command := range [][]string{
+		{"screen", "-t", "build", "/bin/sh", "-c", "sleep 30"},
+		{"select", "0"},
+		{"title", "main shell"},
+	} {
+		args := append([]string{"-S", "remote", "-X"}, command...)
+		if out, code := runSgreen(t, args, env); code != 0 {
+			t.Fatalf("sgreen %s: exit code %d\n%s", strings.Join(args, " "), code, out)
+		}
+	}
+
+	listings := listSessions(t, env)
+	if len(listings) != 1 || len(listings[0].Windows) != 2 {
+		t.Fatalf("sgreen -ls --json: want two windows\n%+v", listings)
+	}
+	windows := listings[0].Windows
+	if windows[0].Title != "main shell" || windows[1].Title != "build" || windows[1].Command[0] != "/bin/sh" {
+		t.Fatalf("sgreen -ls --json: want windows titled main shell and build\n%+v", windows)
+	}
+
+	// -p names the window a command acts on, without selecting it
+	out, code = runSgreen(t, []string{"-S", "remote", "-p", "build", "-X", "title", "compile"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -p build -X title compile: exit code %d\n%s", code, out)
+	}
+	windows = listSessions(t, env)[0].Windows
+	if windows[0].Title != "main shell" || windows[1].Title != "compile" {
+		t.Fatalf("sgreen -ls --json: want window 1 retitled compile\n%+v", windows)
+	}
+	out, code = runSgreen(t, []string{"-S", "remote", "-p", "7", "-X", "title", "nothing"}, env)
+	if code == 0 || !strings.Contains(out, "could not find pre-select window") {
+		t.Fatalf("sgreen -p 7 -X title: exit code %d, want a pre-select error\n%s", code, out)
+	}
+
+	out, code = runSgreen(t, []string{"-S", "remote", "-X", "frobnicate"}, env)
+	if code == 0 || !strings.Contains(out, "unknown command 'frobnicate'") {
+		t.Fatalf("sgreen -X frobnicate: exit code %d, want an unknown command error\n%s", code, out)
+	}
+	out, code = runSgreen(t, []string{"-S", "remote", "-X", "select"}, env)
+	if code == 0 || !strings.Contains(out, "select: one argument required") {
+		t.Fatalf("sgreen -X select: exit code %d, want an argument error\n%s", code, out)
+	}
+}
+
+func TestStuff(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "stuffing", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "stuffing", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS stuffing: exit code %d\n%s", code, out)
+	}
+	out, code = runSgreen(t, []string{"-S", "stuffing", "-X", "screen", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -X screen: exit code %d\n%s", code, out)
+	}
+
+	// Stuff into the background window 0, once at full speed and once paced
+	fast := filepath.Join(homeDir, "fast")
+	out, code = runSgreen(t, []string{"-S", "stuffing", "-p", "0", "-X", "stuff", "echo fast > " + fast + "^M"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -X stuff: exit code %d\n%s", code, out)
+	}
+	if got := waitForFile(t, fast); got != "fast" {
+		t.Fatalf("stuffed command wrote %q, want %q", got, "fast")
+	}
+	paced := filepath.Join(homeDir, "paced")
+	out, code = runSgreen(t, []string{"-S", "stuffing", "-p", "0", "-X", "stuff", "-d", "2", `echo paced\101 > ` + paced + `\r`}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -X stuff -d 2: exit code %d\n%s", code, out)
+	}
+	if got := waitForFile(t, paced); got != "pacedA" {
+		t.Fatalf("paced stuffed command wrote %q, want %q", got, "pacedA")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "asked", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "asked", "-t", "editor", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS asked: exit code %d\n%s", code, out)
+	}
+	out, code = runSgreen(t, []string{"-S", "asked", "-X", "screen", "-t", "build", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -X screen: exit code %d\n%s", code, out)
+	}
+
+	for _, c := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-Q", "windows"}, "0- editor  1* build\n"},
+		{[]string{"-Q", "number"}, "1 (build)\n"},
+		{[]string{"-Q", "title"}, "build\n"},
+		{[]string{"-p", "editor", "-Q", "title"}, "editor\n"},
+		{[]string{"-Q", "select", "0"}, ""},
+	} {
+		args := append([]string{"-S", "asked"}, c.args...)
+		if out, code := runSgreen(t, args, env); code != 0 || out != c.want {
+			t.Fatalf("sgreen %s: exit code %d, output %q, want %q", strings.Join(args, " "), code, out, c.want)
+		}
+	}
+	out, code = runSgreen(t, []string{"-S", "asked", "-Q", "info"}, env)
+	if code != 0 || !strings.HasSuffix(out, " 1(build)\n") || !strings.HasPrefix(out, "(") {
+		t.Fatalf("sgreen -Q info: exit code %d, output %q", code, out)
+	}
+
+	// Failing queries exit with status 1, and queries change nothing
+	for _, args := range [][]string{
+		{"-Q", "select", "7"},
+		{"-Q", "kill"},
+		{"-Q", "title", "renamed"},
+	} {
+		args = append([]string{"-S", "asked"}, args...)
+		if out, code := runSgreen(t, args, env); code != 1 {
+			t.Fatalf("sgreen %s: exit code %d, want 1\n%s", strings.Join(args, " "), code, out)
+		}
+	}
+	if windows := listSessions(t, env)[0].Windows; len(windows) != 2 || windows[1].Title != "build" {
+		t.Fatalf("sgreen -ls --json after failed queries: %+v", windows)
+	}
+}
+
+func TestHardcopy(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "copied", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "copied", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS copied: exit code %d\n%s", code, out)
+	}
+	done := filepath.Join(homeDir, "done")
+	out, code = runSgreen(t, []string{"-S", "copied", "-X", "stuff", `seq 1 200; printf '\\033[1mbold\\033[m\\n'; echo done > ` + done + "^M"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -X stuff: exit code %d\n%s", code, out)
+	}
+	waitForFile(t, done)
+
+	// The screen as shown, without escape sequences, on stdout
+	out, code = runSgreen(t, []string{"-S", "copied", "-p", "0", "-X", "hardcopy", "-"}, env)
+	if code != 0 || !strings.Contains(out, "\nbold\n") || strings.Contains(out, "\x1b") {
+		t.Fatalf("sgreen -X hardcopy -: exit code %d, want the screen text\n%q", code, out)
+	}
+	if strings.Contains(out, "\n100\n") {
+		t.Fatalf("sgreen -X hardcopy -: history included without -h\n%s", out)
+	}
+
+	// With -h, the history comes first
+	file := filepath.Join(homeDir, "with-history")
+	out, code = runSgreen(t, []string{"-S", "copied", "-X", "hardcopy", "-h", file}, env)
+	if code != 0 || !strings.Contains(out, "Screen image written to") {
+		t.Fatalf("sgreen -X hardcopy -h: exit code %d\n%s", code, out)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := "\n" + string(data); !strings.Contains(text, "\n1\n2\n") || !strings.Contains(text, "\nbold\n") {
+		t.Fatalf("hardcopy -h wrote %q, want the history and the screen", text)
+	}
+}
+
+func TestWaitReturnsExitStatus(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "job", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "job", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS job: exit code %d\n%s", code, out)
+	}
+	// The window's program exits once the test writes to release
+	release := filepath.Join(t.TempDir(), "release")
+	if err := syscall.Mkfifo(release, 0o600); err != nil {
+		t.Fatalf("mkfifo: %v", err)
+	}
+	out, code = runSgreen(t, []string{"-S", "job", "-X", "screen", "-t", "make", "/bin/sh", "-c", `read line < "$0"; exit 3`, release}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -X screen: exit code %d\n%s", code, out)
+	}
+
+	type result struct {
+		out  string
+		code int
+	}
+	waited := make(chan result, 1)
+	go func() {
+		out, code := runSgreen(t, []string{"-S", "job", "-p", "make", "-X", "wait"}, env)
+		waited <- result{out, code}
+	}()
+	select {
+	case r := <-waited:
+		t.Fatalf("sgreen -X wait returned before the window exited: exit code %d\n%s", r.code, r.out)
+	case <-time.After(500 * time.Millisecond):
+	}
+	if err := os.WriteFile(release, []byte("exit\n"), 0o600); err != nil {
+		t.Fatalf("release window: %v", err)
+	}
+	select {
+	case r := <-waited:
+		if r.code != 3 {
+			t.Fatalf("sgreen -X wait: exit code %d, want 3\n%s", r.code, r.out)
+		}
+	case <-time.After(interactiveTimeout):
+		t.Fatal("sgreen -X wait did not return after the window exited")
+	}
+	// Once the window has exited, wait returns at once
+	if out, code := runSgreen(t, []string{"-S", "job", "-p", "1", "-X", "wait"}, env); code != 3 {
+		t.Fatalf("sgreen -X wait after the exit: exit code %d, want 3\n%s", code, out)
+	}
+
+	windows := listSessions(t, env)[0].Windows
+	if len(windows) != 2 || windows[1].ExitStatus == nil || *windows[1].ExitStatus != 3 || windows[1].EndedAt.IsZero() {
+		t.Fatalf("sgreen -ls --json: want window 1 to have exited with status 3\n%+v", windows)
+	}
+	if out, _ := runSgreen(t, []string{"-S", "job", "-Q", "windows"}, env); !strings.Contains(out, " make (exited 3)") {
+		t.Fatalf("sgreen -Q windows: want the exit status of window 1\n%s", out)
+	}
+}
+
+func TestZombieWindows(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "zombies", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "zombies", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS zombies: exit code %d\n%s", code, out)
+	}
+	runs := filepath.Join(homeDir, "runs")
+	for _, command := range [][]string{
+		{"zombie", "kr"},
+		{"screen", "-t", "job", "/bin/sh", "-c", "echo ran >> " + runs + "; exit 4"},
+	} {
+		args := append([]string{"-S", "zombies", "-X"}, command...)
+		if out, code := runSgreen(t, args, env); code != 0 {
+			t.Fatalf("sgreen %s: exit code %d\n%s", strings.Join(args, " "), code, out)
+		}
+	}
+	if out, code := runSgreen(t, []string{"-S", "zombies", "-X", "wait"}, env); code != 4 {
+		t.Fatalf("sgreen -X wait: exit code %d, want 4\n%s", code, out)
+	}
+
+	// The dead window stays, with its number, title and exit status
+	term := startTerminal(t, []string{"-r", "zombies"}, env)
+	time.Sleep(200 * time.Millisecond)
+	if !strings.Contains(term.output(), "Window 1 exited with status 4") {
+		t.Fatalf("want the zombie banner of window 1\n%s", term.output())
+	}
+
+	// r reruns the program in place
+	term.send("r")
+	deadline := time.Now().Add(interactiveTimeout)
+	for {
+		if data, _ := os.ReadFile(runs); string(data) == "ran\nran\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the respawned window did not run again\n%s", term.output())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	windows := listSessions(t, env)[0].Windows
+	if len(windows) != 2 || windows[1].Number != "1" || windows[1].Title != "job" {
+		t.Fatalf("sgreen -ls --json after respawning: want window 1 titled job\n%+v", windows)
+	}
+
+	// k closes it
+	time.Sleep(200 * time.Millisecond)
+	term.send("k")
+	if windows := listSessions(t, env)[0].Windows; len(windows) != 1 {
+		t.Fatalf("sgreen -ls --json after closing the zombie: want one window\n%+v", windows)
+	}
+
+	// A session whose windows are all dead stays until they are closed
+	term.send("exit\r")
+	if !strings.Contains(term.output(), "Window 0 exited with status 0") {
+		t.Fatalf("want the zombie banner of window 0\n%s", term.output())
+	}
+	if listings := listSessions(t, env); len(listings) != 1 {
+		t.Fatalf("sgreen -ls --json with only a dead window: want the session\n%+v", listings)
+	}
+	term.send("k")
+	if code := term.wait(); code != 0 {
+		t.Fatalf("closing the last window: exit code %d, want 0\n%s", code, term.output())
+	}
+}
+
+func TestStableWindowNumbers(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "numbered", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "numbered", "-t", "zero", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS numbered: exit code %d\n%s", code, out)
+	}
+	for _, step := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-X", "screen", "-t", "five", "5", "/bin/sh"}, "0- zero  5* five"},
+		{[]string{"-X", "screen", "-t", "one", "/bin/sh"}, "0 zero  1* one  5- five"},
+		{[]string{"-X", "screen", "-t", "two", "/bin/sh"}, "0 zero  1- one  2* two  5 five"},
+		{[]string{"-p", "1", "-X", "kill"}, "0 zero  2* two  5 five"},
+		{[]string{"-X", "number", "0"}, "0* two  2 zero  5 five"},
+		{[]string{"-p", "five", "-X", "number", "-4"}, "0* two  1 five  2 zero"},
+	} {
+		args := append([]string{"-S", "numbered"}, step.args...)
+		if out, code := runSgreen(t, args, env); code != 0 {
+			t.Fatalf("sgreen %s: exit code %d\n%s", strings.Join(args, " "), code, out)
+		}
+		if out, _ := runSgreen(t, []string{"-S", "numbered", "-Q", "windows"}, env); out != step.want+"\n" {
+			t.Fatalf("after sgreen %s: windows %q, want %q", strings.Join(args, " "), out, step.want)
+		}
+	}
+}
+
+func TestMaxWin(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "maxwin", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "maxwin", "-t", "zero", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS maxwin: exit code %d\n%s", code, out)
+	}
+	if out, code := runSgreen(t, []string{"-S", "maxwin", "-X", "screen", "40", "/bin/sh"}, env); code == 0 {
+		t.Fatalf("screen 40 with the default maxwin succeeded\n%s", out)
+	}
+	for _, args := range [][]string{
+		{"-X", "maxwin", "50"},
+		{"-X", "screen", "-t", "forty", "40", "/bin/sh"},
+		{"-X", "select", "0"},
+		{"-p", "40", "-X", "title", "big"},
+		{"-X", "select", "40"},
+	} {
+		args := append([]string{"-S", "maxwin"}, args...)
+		if out, code := runSgreen(t, args, env); code != 0 {
+			t.Fatalf("sgreen %s: exit code %d\n%s", strings.Join(args, " "), code, out)
+		}
+	}
+	if out, _ := runSgreen(t, []string{"-S", "maxwin", "-Q", "maxwin"}, env); out != "maxwin is 50\n" {
+		t.Fatalf("maxwin query = %q", out)
+	}
+	if out, _ := runSgreen(t, []string{"-S", "maxwin", "-Q", "windows"}, env); out != "0- zero  40* big\n" {
+		t.Fatalf("windows = %q", out)
+	}
+}
+
+func TestKillEscalatesToProcessGroup(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "killing", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "killing", "-t", "shell", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS killing: exit code %d\n%s", code, out)
+	}
+	// A job that ignores SIGHUP and SIGTERM, started in the background
+	pidFile := filepath.Join(homeDir, "job.pid")
+	script := "trap '' HUP TERM; sleep 300 & echo $! | tee " + pidFile + "; wait"
+	for _, args := range [][]string{
+		{"-X", "killgrace", "200ms"},
+		{"-X", "screen", "-t", "stubborn", "/bin/sh", "-c", script},
+	} {
+		args := append([]string{"-S", "killing"}, args...)
+		if out, code := runSgreen(t, args, env); code != 0 {
+			t.Fatalf("sgreen %s: exit code %d\n%s", strings.Join(args, " "), code, out)
+		}
+	}
+	pid, err := strconv.Atoi(waitForFile(t, pidFile))
+	if err != nil {
+		t.Fatalf("job pid: %v", err)
+	}
+
+	start := time.Now()
+	if out, code := runSgreen(t, []string{"-S", "killing", "-p", "stubborn", "-X", "kill"}, env); code != 0 {
+		t.Fatalf("sgreen -X kill: exit code %d\n%s", code, out)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("kill returned after %v, before the grace periods", elapsed)
+	}
+	if !processGone(pid) {
+		t.Fatalf("background job %d survived the kill", pid)
+	}
+
+	// kill -SIGNAL signals the foreground job and keeps the window
+	if out, code := runSgreen(t, []string{"-S", "killing", "-X", "screen", "-t", "sleeper", "/bin/sleep", "300"}, env); code != 0 {
+		t.Fatalf("sgreen -X screen: exit code %d\n%s", code, out)
+	}
+	if out, code := runSgreen(t, []string{"-S", "killing", "-p", "sleeper", "-X", "kill", "-TERM"}, env); code != 0 {
+		t.Fatalf("sgreen -X kill -TERM: exit code %d\n%s", code, out)
+	}
+	if _, code := runSgreen(t, []string{"-S", "killing", "-p", "sleeper", "-X", "wait"}, env); code != 128+int(syscall.SIGTERM) {
+		t.Fatalf("sgreen -X wait: exit code %d, want %d", code, 128+int(syscall.SIGTERM))
+	}
+}
+
+func TestServerSignalEndsProcessGroups(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "signalled", "-X", "quit"}, env)
+	})
+
+	// A job that ignores SIGHUP and SIGTERM, started in the background
+	pidFile := filepath.Join(homeDir, "job.pid")
+	script := "trap '' HUP TERM; sleep 300 & echo $! | tee " + pidFile + "; wait"
+	out, code := runSgreen(t, []string{"-dmS", "signalled", "/bin/sh", "-c", script}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS signalled: exit code %d\n%s", code, out)
+	}
+	if out, code := runSgreen(t, []string{"-S", "signalled", "-X", "killgrace", "200ms"}, env); code != 0 {
+		t.Fatalf("sgreen -X killgrace: exit code %d\n%s", code, out)
+	}
+	pid, err := strconv.Atoi(waitForFile(t, pidFile))
+	if err != nil {
+		t.Fatalf("job pid: %v", err)
+	}
+	listings := listSessions(t, env)
+	if len(listings) != 1 || listings[0].ServerPid <= 0 {
+		t.Fatalf("sgreen -ls --json: want the server of session signalled\n%+v", listings)
+	}
+	server := listings[0].ServerPid
+
+	if err := syscall.Kill(server, syscall.SIGTERM); err != nil {
+		t.Fatalf("signal the server: %v", err)
+	}
+	deadline := time.Now().Add(interactiveTimeout)
+	for !processGone(server) || !processGone(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("after SIGTERM: server gone %v, background job gone %v", processGone(server), processGone(pid))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// processGone reports whether the process has exited; an unreaped zombie
+// counts as gone.
+func processGone(pid int) bool {
+	if errors.Is(syscall.Kill(pid, 0), syscall.ESRCH) {
+		return true
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesized command name
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+func TestSplitRegions(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "regions", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "regions", "-t", "one", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS regions: exit code %d\n%s", code, out)
+	}
+	if out, code := runSgreen(t, []string{"-S", "regions", "-X", "screen", "-t", "two", "/bin/sh"}, env); code != 0 {
+		t.Fatalf("sgreen -X screen: exit code %d\n%s", code, out)
+	}
+	term := startTerminal(t, []string{"-r", "regions"}, env)
+	time.Sleep(200 * time.Millisecond)
+
+	// size asks the shell of a window for its terminal size
+	size := func(window, name string) string {
+		t.Helper()
+		file := filepath.Join(homeDir, name)
+		args := []string{"-S", "regions", "-p", window, "-X", "stuff", "stty size > " + file + "^M"}
+		if out, code := runSgreen(t, args, env); code != 0 {
+			t.Fatalf("sgreen %s: exit code %d\n%s", strings.Join(args, " "), code, out)
+		}
+		return waitForFile(t, file)
+	}
+
+	// Window 1 on top and a blank region below, each with a caption row
+	term.send("\x01S")
+	if got := size("1", "split"); got != "11 80" {
+		t.Fatalf("window 1 after C-a S: size %q, want 11 80", got)
+	}
+	// Window 0 in the region below
+	term.send("\x01\t")
+	term.send("\x010")
+	if got := size("0", "focus"); got != "11 80" {
+		t.Fatalf("window 0 in the lower region: size %q, want 11 80", got)
+	}
+	if !strings.Contains(term.output(), "  1 two") || !strings.Contains(term.output(), "  0 one") {
+		t.Fatalf("want the captions of both regions\n%s", term.output())
+	}
+	// Two columns with a separator, then a narrower left one
+	term.send("\x01|")
+	if got := size("0", "vsplit"); got != "11 39" {
+		t.Fatalf("window 0 after C-a |: size %q, want 11 39", got)
+	}
+	term.send("\x01:resize -h 20\r")
+	if got := size("0", "resize"); got != "11 20" {
+		t.Fatalf("window 0 after resize -h 20: size %q, want 11 20", got)
+	}
+	// Removing the blank right region gives its room back; the focus
+	// moves on to the top region
+	term.send("\x01\t")
+	term.send("\x01X")
+	if got := size("0", "remove"); got != "11 80" {
+		t.Fatalf("window 0 after C-a X: size %q, want 11 80", got)
+	}
+	// Back to one region, showing window 1
+	term.send("\x01Q")
+	if got := size("1", "only"); got != "24 80" {
+		t.Fatalf("window 1 after C-a Q: size %q, want 24 80", got)
+	}
+}
+
+func TestLayoutsKeepRegionsAcrossDetach(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "layouts", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "layouts", "-t", "one", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS layouts: exit code %d\n%s", code, out)
+	}
+	term := startTerminal(t, []string{"-r", "layouts"}, env)
+	time.Sleep(200 * time.Millisecond)
+
+	size := func(name string) string {
+		t.Helper()
+		file := filepath.Join(homeDir, name)
+		args := []string{"-S", "layouts", "-p", "0", "-X", "stuff", "stty size > " + file + "^M"}
+		if out, code := runSgreen(t, args, env); code != 0 {
+			t.Fatalf("sgreen %s: exit code %d\n%s", strings.Join(args, " "), code, out)
+		}
+		return waitForFile(t, file)
+	}
+
+	// A split layout and a whole one
+	term.send("\x01:layout new work\r")
+	term.send("\x01S")
+	if got := size("work"); got != "11 80" {
+		t.Fatalf("window 0 in layout work: size %q, want 11 80", got)
+	}
+	term.send("\x01:layout new plain\r")
+	if got := size("plain"); got != "24 80" {
+		t.Fatalf("window 0 in layout plain: size %q, want 24 80", got)
+	}
+	term.send("\x01:layout prev\r")
+	if got := size("prev"); got != "11 80" {
+		t.Fatalf("window 0 back in layout work: size %q, want 11 80", got)
+	}
+	term.send("\x01d")
+	if code := term.wait(); code != 0 {
+		t.Fatalf("detach: exit code %d\n%s", code, term.output())
+	}
+
+	out, code = runSgreen(t, []string{"-S", "layouts", "-Q", "layout", "show"}, env)
+	if code == 0 {
+		t.Fatalf("layout show is not a query, got\n%s", out)
+	}
+	out, code = runSgreen(t, []string{"-S", "layouts", "-X", "layout", "show"}, env)
+	if code != 0 || !strings.Contains(out, "0* work  1 plain") {
+		t.Fatalf("layout show: exit code %d\n%s", code, out)
+	}
+	dump := filepath.Join(homeDir, "dump")
+	if out, code := runSgreen(t, []string{"-S", "layouts", "-X", "layout", "dump", dump}, env); code != 0 {
+		t.Fatalf("layout dump: exit code %d\n%s", code, out)
+	}
+	if got := waitForFile(t, dump); !strings.HasPrefix(got, "layout new work\nsplit\n") {
+		t.Fatalf("layout dump =\n%s", got)
+	}
+
+	// Reattaching shows the layout shown last
+	term = startTerminal(t, []string{"-r", "layouts"}, env)
+	time.Sleep(200 * time.Millisecond)
+	if got := size("reattach"); got != "11 80" {
+		t.Fatalf("window 0 after reattaching: size %q, want 11 80", got)
+	}
+}
+
+func TestWindowGroups(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "groups", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "groups", "-t", "shell", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS groups: exit code %d\n%s", code, out)
+	}
+	// New windows join the group window that is current
+	for _, args := range [][]string{
+		{"-X", "screen", "-t", "dev", "//group"},
+		{"-X", "screen", "-t", "editor", "/bin/sh"},
+		{"-X", "screen", "-t", "build", "/bin/sh"},
+	} {
+		args := append([]string{"-S", "groups"}, args...)
+		if out, code := runSgreen(t, args, env); code != 0 {
+			t.Fatalf("sgreen %s: exit code %d\n%s", strings.Join(args, " "), code, out)
+		}
+	}
+	if out, _ := runSgreen(t, []string{"-S", "groups", "-Q", "windows"}, env); out != "0 shell  1 dev/  2- dev/editor  3* dev/build\n" {
+		t.Fatalf("windows = %q", out)
+	}
+
+	// next stays in the group
+	for _, want := range []string{"2 (editor)\n", "3 (build)\n"} {
+		if out, code := runSgreen(t, []string{"-S", "groups", "-X", "next"}, env); code != 0 {
+			t.Fatalf("sgreen -X next: exit code %d\n%s", code, out)
+		}
+		if out, _ := runSgreen(t, []string{"-S", "groups", "-Q", "number"}, env); out != want {
+			t.Fatalf("number after next = %q, want %q", out, want)
+		}
+	}
+
+	// Selecting a group window lists its windows to choose from
+	term := startTerminal(t, []string{"-r", "groups"}, env)
+	time.Sleep(200 * time.Millisecond)
+	term.send("\x011")
+	if !strings.Contains(term.output(), "Group 1 dev") || !strings.Contains(term.output(), "2: editor") {
+		t.Fatalf("want the windows of group dev\n%s", term.output())
+	}
+	term.send("2\r")
+	if out, _ := runSgreen(t, []string{"-S", "groups", "-Q", "number"}, env); out != "2 (editor)\n" {
+		t.Fatalf("number after selecting from the group = %q", out)
+	}
+
+	listings := listSessions(t, env)
+	if len(listings) != 1 || len(listings[0].Windows) != 4 {
+		t.Fatalf("sgreen -ls --json: want session groups with 4 windows\n%+v", listings)
+	}
+	windows := listings[0].Windows
+	if windows[1].Type != "group" || windows[2].Group != "1" || windows[3].Group != "1" || windows[0].Group != "" {
+		t.Fatalf("sgreen -ls --json: want windows 2 and 3 in group 1\n%+v", windows)
+	}
+}
+
+func TestAttachWhileGroupIsCurrent(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "grouped", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "grouped", "-t", "shell", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS grouped: exit code %d\n%s", code, out)
+	}
+	if out, code := runSgreen(t, []string{"-S", "grouped", "-X", "screen", "-t", "dev", "//group"}, env); code != 0 {
+		t.Fatalf("sgreen -X screen //group: exit code %d\n%s", code, out)
+	}
+	waitForList(t, env, "(Detached)")
+
+	// Attaching to the group window lists its windows to choose from
+	term := startTerminal(t, []string{"-r", "grouped"}, env)
+	time.Sleep(200 * time.Millisecond)
+	if !strings.Contains(term.output(), "Group 1 dev") {
+		t.Fatalf("want the windows of group dev\n%s", term.output())
+	}
+	term.send("0\r")
+	if out, _ := runSgreen(t, []string{"-S", "grouped", "-Q", "number"}, env); out != "0 (shell)\n" {
+		t.Fatalf("number after selecting from the group = %q", out)
+	}
+	term.send("\x01d")
+	if code := term.wait(); code != 0 {
+		t.Fatalf("detach: exit code %d\n%s", code, term.output())
+	}
+}
+
+func TestDisplaysKeepTheirOwnWindow(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "views", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "views", "-t", "zero", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS views: exit code %d\n%s", code, out)
+	}
+	for _, args := range [][]string{
+		{"-X", "screen", "-t", "one", "/bin/sh"},
+		{"-X", "select", "0"},
+	} {
+		args := append([]string{"-S", "views"}, args...)
+		if out, code := runSgreen(t, args, env); code != 0 {
+			t.Fatalf("sgreen %s: exit code %d\n%s", strings.Join(args, " "), code, out)
+		}
+	}
+	pids := make([]string, 2)
+	for i := range pids {
+		file := filepath.Join(homeDir, fmt.Sprintf("pid%d", i))
+		args := []string{"-S", "views", "-p", strconv.Itoa(i), "-X", "stuff", "echo $$ > " + file + "^M"}
+		if out, code := runSgreen(t, args, env); code != 0 {
+			t.Fatalf("sgreen %s: exit code %d\n%s", strings.Join(args, " "), code, out)
+		}
+		pids[i] = waitForFile(t, file)
+	}
+
+	first := startTerminal(t, []string{"-r", "views"}, env)
+	waitForList(t, env, "(Attached)")
+	second := startTerminal(t, []string{"-x", "views"}, env)
+	waitForList(t, env, "(Multi, attached)")
+
+	// Switching windows on one display leaves the other where it was
+	second.send("\x011")
+	for i, term := range []*terminal{first, second} {
+		file := filepath.Join(homeDir, fmt.Sprintf("typed%d", i))
+		term.send("echo $$ > " + file + "\r")
+		if got := waitForFile(t, file); got != pids[i] {
+			t.Fatalf("display %d typed into the shell %s, want window %d (%s)", i, got, i, pids[i])
+		}
+	}
+	// Commands without a display act on the window switched to last
+	if out, _ := runSgreen(t, []string{"-S", "views", "-Q", "number"}, env); out != "1 (one)\n" {
+		t.Fatalf("number = %q, want the window of the second display", out)
+	}
+
+	// Each display goes back to its own last window
+	first.send("\x01n")
+	second.send("\x01\x01")
+	for i, term := range []*terminal{first, second} {
+		file := filepath.Join(homeDir, fmt.Sprintf("toggled%d", i))
+		term.send("echo $$ > " + file + "\r")
+		if got, want := waitForFile(t, file), pids[1-i]; got != want {
+			t.Fatalf("display %d typed into the shell %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestDisplaysListDetachesAnotherDisplay(t *testing.T) {
+	homeDir := t.TempDir()
+	env := interactiveEnv(homeDir)
+	t.Cleanup(func() {
+		_, _ = runSgreen(t, []string{"-S", "displays", "-X", "quit"}, env)
+	})
+
+	out, code := runSgreen(t, []string{"-dmS", "displays", "-t", "zero", "/bin/sh"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -dmS displays: exit code %d\n%s", code, out)
+	}
+	first := startTerminal(t, []string{"-r", "displays"}, env)
+	waitForList(t, env, "(Attached)")
+	second := startTerminal(t, []string{"-x", "displays"}, env)
+	waitForList(t, env, "(Multi, attached)")
+
+	// C-a * lists both displays; 1 d detaches the second one
+	first.send("\x01*")
+	if got := first.output(); strings.Count(got, "80x24") != 2 || !strings.Contains(got, "0 zero") {
+		t.Fatalf("want both displays on window 0 listed\n%s", got)
+	}
+	first.send("1d")
+	if code := second.wait(); code != 0 {
+		t.Fatalf("detached display: exit code %d, want 0\n%s", code, second.output())
+	}
+	waitForList(t, env, "(Attached)")
+}
@@ -678,3 +678,39 @@ func TestShortHRequiresArgument(t *testing.T) {
 		t.Fatalf("sgreen -h: expected usage output\n%s", out)
 	}
 }
+
+func TestListAndWipeDeadSession(t *testing.T) {
+	homeDir := t.TempDir()
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Fatalf("run true: %v", err)
+	}
+	writeSessionFile(t, homeDir, "gone", exited.Process.Pid)
+	env := map[string]string{"HOME": homeDir}
+
+	out, _ := runSgreen(t, []string{"-ls"}, env)
+	if !strings.Contains(out, "(gone)") || !strings.Contains(out, "(Dead ???)") {
+		t.Fatalf("sgreen -ls with a dead session: expected it listed as dead\n%s", out)
+	}
+	if !strings.Contains(out, "sgreen -wipe") {
+		t.Fatalf("sgreen -ls with a dead session: expected a hint to wipe it\n%s", out)
+	}
+
+	out, code := runSgreen(t, []string{"-wipe"}, env)
+	if code != 0 {
+		t.Fatalf("sgreen -wipe with a dead session: exit code %d, want 0\n%s", code, out)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".sgreen", "sessions", "gone.json")); !os.IsNotExist(err) {
+		t.Fatalf("sgreen -wipe left the dead session file behind: %v", err)
+	}
+}
+
+func TestListJSONNoSessions(t *testing.T) {
+	out, code := runSgreen(t, []string{"-ls", "--json"}, map[string]string{"HOME": t.TempDir()})
+	if code != 0 {
+		t.Fatalf("sgreen -ls --json with no sessions: exit code %d, want 0\n%s", code, out)
+	}
+	if strings.TrimSpace(out) != "[]" {
+		t.Fatalf("sgreen -ls --json with no sessions: want an empty JSON array\n%s", out)
+	}
+}